@@ -0,0 +1,15 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/run"
+)
+
+func main() {
+	err := run.RunAdmin(os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
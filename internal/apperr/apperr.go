@@ -0,0 +1,114 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Kind - категория ошибки, по которой Responder выбирает HTTP-статус
+type Kind string
+
+const (
+	KindValidation   Kind = "validation"
+	KindNotFound     Kind = "not_found"
+	KindConflict     Kind = "conflict"
+	KindUnauthorized Kind = "unauthorized"
+	KindForbidden    Kind = "forbidden"
+	KindRateLimited  Kind = "rate_limited"
+)
+
+// Error - ошибка сервисного слоя со стабильным кодом для клиентов.
+// Исходная ошибка сохраняется, поэтому errors.Is продолжает находить сентинелы репозиториев
+type Error struct {
+	Kind   Kind
+	Code   string
+	Fields []FieldError
+	Err    error
+	// RetryAfter - через сколько клиенту можно повторить запрос; ноль - не сообщается
+	RetryAfter time.Duration
+}
+
+// FieldError описывает ошибку в конкретном поле запроса; Field - имя поля в JSON
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind Kind, code string, format string, args []interface{}) *Error {
+	return &Error{
+		Kind: kind,
+		Code: code,
+		Err:  fmt.Errorf(format, args...),
+	}
+}
+
+// Invalid - запрос некорректен целиком, без привязки к полю
+func Invalid(code string, format string, args ...interface{}) error {
+	return newError(KindValidation, code, format, args)
+}
+
+// InvalidField - некорректно значение поля field
+func InvalidField(field string, code string, format string, args ...interface{}) error {
+	err := newError(KindValidation, code, format, args)
+	err.Fields = []FieldError{{Field: field, Code: code, Message: err.Error()}}
+	return err
+}
+
+func NotFound(code string, format string, args ...interface{}) error {
+	return newError(KindNotFound, code, format, args)
+}
+
+func Conflict(code string, format string, args ...interface{}) error {
+	return newError(KindConflict, code, format, args)
+}
+
+func Unauthorized(code string, format string, args ...interface{}) error {
+	return newError(KindUnauthorized, code, format, args)
+}
+
+func Forbidden(code string, format string, args ...interface{}) error {
+	return newError(KindForbidden, code, format, args)
+}
+
+// RateLimited - слишком много попыток; повторить можно через retryAfter
+func RateLimited(code string, retryAfter time.Duration, format string, args ...interface{}) error {
+	err := newError(KindRateLimited, code, format, args)
+	err.RetryAfter = retryAfter
+	return err
+}
+
+// As достаёт типизированную ошибку из цепочки err
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	ok := errors.As(err, &appErr)
+	return appErr, ok
+}
+
+// KindOf возвращает категорию err или пустую строку для нетипизированных ошибок
+func KindOf(err error) Kind {
+	appErr, ok := As(err)
+	if !ok {
+		return ""
+	}
+	return appErr.Kind
+}
+
+// ParseID разбирает идентификатор из пути запроса; field - имя параметра для ответа клиенту
+func ParseID(field string, value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, InvalidField(field, "invalid_id", "invalid %s: %q", field, value)
+	}
+	return id, nil
+}
@@ -0,0 +1,84 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected Kind
+	}{
+		{
+			name:     "validation",
+			err:      Invalid("bad", "bad request"),
+			expected: KindValidation,
+		},
+		{
+			name:     "wrapped not found",
+			err:      fmt.Errorf("load: %w", NotFound("missing", "missing")),
+			expected: KindNotFound,
+		},
+		{
+			name:     "untyped",
+			err:      errors.New("boom"),
+			expected: "",
+		},
+		{
+			name:     "nil",
+			err:      nil,
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, KindOf(tt.err))
+		})
+	}
+}
+
+func TestError_KeepsCause(t *testing.T) {
+	cause := errors.New("pet is not available")
+
+	err := Conflict("pet_unavailable", "%w: 7", cause)
+
+	assert.EqualError(t, err, "pet is not available: 7")
+	assert.ErrorIs(t, err, cause)
+}
+
+func TestInvalidField(t *testing.T) {
+	err := InvalidField("email", "invalid_email", "invalid email: %s", "nope")
+
+	appErr, ok := As(err)
+	assert.True(t, ok)
+	assert.Equal(t, "invalid_email", appErr.Code)
+	assert.Equal(t, []FieldError{{Field: "email", Code: "invalid_email", Message: "invalid email: nope"}}, appErr.Fields)
+}
+
+func TestRateLimited(t *testing.T) {
+	err := RateLimited("login_locked", time.Minute, "too many failed attempts")
+
+	appErr, ok := As(fmt.Errorf("login: %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, KindRateLimited, appErr.Kind)
+	assert.Equal(t, time.Minute, appErr.RetryAfter)
+}
+
+func TestParseID(t *testing.T) {
+	id, err := ParseID("petId", "12")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, id)
+
+	_, err = ParseID("petId", "abc")
+	appErr, ok := As(err)
+	assert.True(t, ok)
+	assert.Equal(t, KindValidation, appErr.Kind)
+	assert.Equal(t, "petId", appErr.Fields[0].Field)
+}
@@ -0,0 +1,74 @@
+package apperr
+
+import (
+	"errors"
+	"strings"
+)
+
+// CodeValidationFailed - код ошибки, объединяющей проверки нескольких полей
+const CodeValidationFailed = "validation_failed"
+
+// Validator собирает результаты проверок всех полей запроса, чтобы клиент получил
+// все ошибки одним ответом, а не исправлял их по одной
+type Validator struct {
+	errs   []error
+	fields []FieldError
+	fatal  error
+}
+
+// Check добавляет результат проверки поля field. Если у типизированной ошибки нет
+// своих полей, она привязывается к field. Нетипизированная ошибка (например, ошибка базы)
+// прерывает валидацию: остальные проверки уже не важны
+func (v *Validator) Check(field string, err error) {
+	if err == nil || v.fatal != nil {
+		return
+	}
+
+	appErr, ok := As(err)
+	if !ok {
+		v.fatal = err
+		return
+	}
+
+	v.errs = append(v.errs, err)
+	if len(appErr.Fields) > 0 {
+		v.fields = append(v.fields, appErr.Fields...)
+		return
+	}
+	v.fields = append(v.fields, FieldError{Field: field, Code: appErr.Code, Message: appErr.Error()})
+}
+
+// Required проверяет, что строковое поле заполнено
+func (v *Validator) Required(field string, value string, message string) bool {
+	if strings.TrimSpace(value) != "" {
+		return true
+	}
+	v.Check(field, InvalidField(field, "required", "%s", message))
+	return false
+}
+
+// Err возвращает nil, если все поля корректны. Единственная ошибка возвращается как есть,
+// чтобы не терять её категорию (например, 409 для занятого имени), несколько - объединяются
+// в одну ошибку валидации со списком полей
+func (v *Validator) Err() error {
+	switch {
+	case v.fatal != nil:
+		return v.fatal
+	case len(v.errs) == 0:
+		return nil
+	case len(v.errs) == 1:
+		return v.errs[0]
+	}
+
+	messages := make([]string, 0, len(v.errs))
+	for _, err := range v.errs {
+		messages = append(messages, err.Error())
+	}
+
+	return &Error{
+		Kind:   KindValidation,
+		Code:   CodeValidationFailed,
+		Fields: v.fields,
+		Err:    errors.New(strings.Join(messages, "; ")),
+	}
+}
@@ -0,0 +1,55 @@
+package apperr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator_Valid(t *testing.T) {
+	var v Validator
+
+	v.Required("name", "Rex", "name is required")
+	v.Check("status", nil)
+
+	assert.NoError(t, v.Err())
+}
+
+func TestValidator_SingleErrorKeepsKind(t *testing.T) {
+	var v Validator
+
+	v.Check("username", Conflict("username_taken", "username not available"))
+
+	assert.Equal(t, KindConflict, KindOf(v.Err()))
+}
+
+func TestValidator_CollectsAllFields(t *testing.T) {
+	var v Validator
+
+	v.Check("username", Conflict("username_taken", "username not available"))
+	v.Check("email", InvalidField("email", "invalid_email", "invalid email"))
+	v.Required("phone", " ", "phone is required")
+
+	appErr, ok := As(v.Err())
+	assert.True(t, ok)
+	assert.Equal(t, KindValidation, appErr.Kind)
+	assert.Equal(t, CodeValidationFailed, appErr.Code)
+	assert.Equal(t, []FieldError{
+		{Field: "username", Code: "username_taken", Message: "username not available"},
+		{Field: "email", Code: "invalid_email", Message: "invalid email"},
+		{Field: "phone", Code: "required", Message: "phone is required"},
+	}, appErr.Fields)
+	assert.EqualError(t, appErr, "username not available; invalid email; phone is required")
+}
+
+func TestValidator_UntypedErrorStops(t *testing.T) {
+	var v Validator
+	dbErr := errors.New("connection refused")
+
+	v.Check("email", InvalidField("email", "invalid_email", "invalid email"))
+	v.Check("username", dbErr)
+	v.Check("phone", InvalidField("phone", "invalid_phone", "invalid phone number"))
+
+	assert.Equal(t, dbErr, v.Err())
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Типы событий безопасности
+const (
+	LoginFailed     = "login_failed"
+	LoginBlocked    = "login_blocked"
+	AccountLocked   = "account_locked"
+	AccountUnlocked = "account_unlocked"
+	AddressLocked   = "address_locked"
+)
+
+// Event - событие журнала аудита. Пустые поля в журнал не пишутся
+type Event struct {
+	Type       string
+	Time       time.Time
+	Username   string
+	IP         string
+	Reason     string
+	Failures   int
+	RetryAfter time.Duration
+}
+
+// Recorder записывает события аудита. Запись не должна мешать запросу,
+// поэтому ошибки реализация обрабатывает сама
+type Recorder interface {
+	Record(ctx context.Context, event Event)
+}
+
+// LogRecorder пишет события в отдельный именованный логгер "audit"
+type LogRecorder struct {
+	logger *zap.Logger
+}
+
+func NewLogRecorder(logger *zap.Logger) *LogRecorder {
+	return &LogRecorder{logger: logger.Named("audit")}
+}
+
+func (r *LogRecorder) Record(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	fields := []zap.Field{
+		zap.String("event", event.Type),
+		zap.Time("time", event.Time.UTC()),
+	}
+	if event.Username != "" {
+		fields = append(fields, zap.String("username", event.Username))
+	}
+	if event.IP != "" {
+		fields = append(fields, zap.String("ip", event.IP))
+	}
+	if event.Reason != "" {
+		fields = append(fields, zap.String("reason", event.Reason))
+	}
+	if event.Failures > 0 {
+		fields = append(fields, zap.Int("failures", event.Failures))
+	}
+	if event.RetryAfter > 0 {
+		fields = append(fields, zap.Duration("retryAfter", event.RetryAfter))
+	}
+
+	r.logger.Info("audit", fields...)
+}
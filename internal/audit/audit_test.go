@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogRecorder(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	recorder := NewLogRecorder(zap.New(core))
+
+	recorder.Record(context.Background(), Event{
+		Type:       AccountLocked,
+		Username:   "alice",
+		IP:         "10.0.0.1",
+		Reason:     "bad_password",
+		Failures:   10,
+		RetryAfter: 15 * time.Minute,
+	})
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "audit", entries[0].LoggerName)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, AccountLocked, fields["event"])
+	assert.Equal(t, "alice", fields["username"])
+	assert.Equal(t, "10.0.0.1", fields["ip"])
+	assert.Equal(t, "bad_password", fields["reason"])
+	assert.Equal(t, int64(10), fields["failures"])
+	assert.Equal(t, 15*time.Minute, fields["retryAfter"])
+	assert.Contains(t, fields, "time")
+}
+
+func TestLogRecorder_SkipsEmptyFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	recorder := NewLogRecorder(zap.New(core))
+
+	recorder.Record(context.Background(), Event{Type: AccountUnlocked, Username: "alice"})
+
+	fields := logs.All()[0].ContextMap()
+	assert.NotContains(t, fields, "ip")
+	assert.NotContains(t, fields, "failures")
+	assert.NotContains(t, fields, "retryAfter")
+}
@@ -0,0 +1,38 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	ctx := context.Background()
+
+	err := store.Put(ctx, "pets/1/image.png", strings.NewReader("content"), 7, "image/png")
+	assert.NoError(t, err)
+
+	r, err := store.Get(ctx, "pets/1/image.png")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "content", string(data))
+
+	assert.NoError(t, store.Delete(ctx, "pets/1/image.png"))
+
+	_, err = store.Get(ctx, "pets/1/image.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, store.Delete(ctx, "pets/1/image.png"), "Удаление отсутствующего объекта не должно быть ошибкой")
+}
+
+func TestLocalStore_InvalidKey(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+
+	err := store.Put(context.Background(), "../outside", strings.NewReader(""), 0, "")
+	assert.Error(t, err)
+}
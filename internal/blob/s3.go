@@ -0,0 +1,39 @@
+package blob
+
+import (
+	"context"
+	"io"
+)
+
+// ObjectClient - операции S3-совместимого клиента, которые нужны хранилищу.
+// Реализация должна возвращать ErrNotFound, если объекта нет.
+type ObjectClient interface {
+	PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	RemoveObject(ctx context.Context, bucket, key string) error
+}
+
+// S3Store хранит объекты в бакете S3-совместимого хранилища
+type S3Store struct {
+	client ObjectClient
+	bucket string
+}
+
+func NewS3Store(client ObjectClient, bucket string) *S3Store {
+	return &S3Store{
+		client: client,
+		bucket: bucket,
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return s.client.PutObject(ctx, s.bucket, key, r, size, contentType)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key)
+}
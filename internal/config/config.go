@@ -0,0 +1,568 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/lockout"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
+)
+
+// Config - настройки приложения. Значения берутся по возрастанию приоритета:
+// значения по умолчанию, файл конфигурации, переменные окружения, флаги командной строки
+type Config struct {
+	Server  Server  `yaml:"server" json:"server"`
+	DB      DB      `yaml:"db" json:"db"`
+	Auth    Auth    `yaml:"auth" json:"auth"`
+	Storage Storage `yaml:"storage" json:"storage"`
+	Mail    Mail    `yaml:"mail" json:"mail"`
+}
+
+type Server struct {
+	Addr            string   `yaml:"addr" json:"addr"`
+	ReadTimeout     Duration `yaml:"readTimeout" json:"readTimeout"`
+	WriteTimeout    Duration `yaml:"writeTimeout" json:"writeTimeout"`
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" json:"shutdownTimeout"`
+}
+
+type DB struct {
+	Driver         string   `yaml:"driver" json:"driver"`
+	Host           string   `yaml:"host" json:"host"`
+	Port           string   `yaml:"port" json:"port"`
+	User           string   `yaml:"user" json:"user"`
+	Password       string   `yaml:"password" json:"password"`
+	PasswordFile   string   `yaml:"passwordFile" json:"passwordFile"`
+	Name           string   `yaml:"name" json:"name"`
+	SSLMode        string   `yaml:"sslMode" json:"sslMode"`
+	ConnectTimeout Duration `yaml:"connectTimeout" json:"connectTimeout"`
+	Migrations     string   `yaml:"migrations" json:"migrations"`
+}
+
+type Auth struct {
+	JWTSecret       string   `yaml:"jwtSecret" json:"jwtSecret"`
+	JWTSecretFile   string   `yaml:"jwtSecretFile" json:"jwtSecretFile"`
+	AccessTokenTTL  Duration `yaml:"accessTokenTTL" json:"accessTokenTTL"`
+	RefreshTokenTTL Duration `yaml:"refreshTokenTTL" json:"refreshTokenTTL"`
+	// Password - политика паролей при регистрации, изменении и сбросе пароля
+	Password password.Policy `yaml:"password" json:"password"`
+	// RequireVerifiedEmail закрывает вход, пока пользователь не подтвердил адрес почты
+	RequireVerifiedEmail bool     `yaml:"requireVerifiedEmail" json:"requireVerifiedEmail"`
+	VerifyTokenTTL       Duration `yaml:"verifyTokenTTL" json:"verifyTokenTTL"`
+	ResetTokenTTL        Duration `yaml:"resetTokenTTL" json:"resetTokenTTL"`
+	// TOTPIssuer - имя сервиса в приложении-аутентификаторе
+	TOTPIssuer string `yaml:"totpIssuer" json:"totpIssuer"`
+	// ChallengeTTL - сколько ждать код второго фактора после ввода пароля
+	ChallengeTTL Duration `yaml:"challengeTTL" json:"challengeTTL"`
+	// Lockout - защита входа от подбора пароля
+	Lockout LoginLockout `yaml:"lockout" json:"lockout"`
+	// LegacyLogin оставляет устаревший GET /user/login с паролем в query string для старых клиентов
+	LegacyLogin bool `yaml:"legacyLogin" json:"legacyLogin"`
+}
+
+// LoginLockout - ограничения неудачных входов по имени пользователя и по IP-адресу.
+// Для адреса пороги выше: за одним адресом может быть много пользователей
+type LoginLockout struct {
+	User LockoutPolicy `yaml:"user" json:"user"`
+	IP   LockoutPolicy `yaml:"ip" json:"ip"`
+}
+
+// LockoutPolicy - начиная с BackoffAfter неудач следующая попытка откладывается на BaseDelay
+// с удвоением до MaxDelay, после LockAfter неудач вход закрывается на LockDuration.
+// Ноль в BackoffAfter или LockAfter выключает соответствующую ступень
+type LockoutPolicy struct {
+	BackoffAfter int      `yaml:"backoffAfter" json:"backoffAfter"`
+	BaseDelay    Duration `yaml:"baseDelay" json:"baseDelay"`
+	MaxDelay     Duration `yaml:"maxDelay" json:"maxDelay"`
+	LockAfter    int      `yaml:"lockAfter" json:"lockAfter"`
+	LockDuration Duration `yaml:"lockDuration" json:"lockDuration"`
+}
+
+func (p LockoutPolicy) Policy() lockout.Policy {
+	return lockout.Policy{
+		BackoffAfter: p.BackoffAfter,
+		BaseDelay:    p.BaseDelay.Std(),
+		MaxDelay:     p.MaxDelay.Std(),
+		LockAfter:    p.LockAfter,
+		LockDuration: p.LockDuration.Std(),
+	}
+}
+
+// validate проверяет политику; name - путь к ней в файле конфигурации
+func (p LockoutPolicy) validate(name string) []error {
+	var errs []error
+
+	if p.BackoffAfter < 0 {
+		errs = append(errs, fmt.Errorf("%s.backoffAfter must not be negative", name))
+	}
+	if p.BackoffAfter > 0 && p.BaseDelay <= 0 {
+		errs = append(errs, fmt.Errorf("%s.baseDelay must be positive", name))
+	}
+	if p.BackoffAfter > 0 && p.MaxDelay < p.BaseDelay {
+		errs = append(errs, fmt.Errorf("%s.maxDelay must not be less than baseDelay", name))
+	}
+	if p.LockAfter < 0 {
+		errs = append(errs, fmt.Errorf("%s.lockAfter must not be negative", name))
+	}
+	if p.LockAfter > 0 && p.LockDuration <= 0 {
+		errs = append(errs, fmt.Errorf("%s.lockDuration must be positive", name))
+	}
+
+	return errs
+}
+
+type Storage struct {
+	UploadDir string `yaml:"uploadDir" json:"uploadDir"`
+}
+
+// Mail - отправка писем для подтверждения почты и сброса пароля.
+// BaseURL - адрес сайта, на который ведут ссылки из писем
+type Mail struct {
+	Driver  string `yaml:"driver" json:"driver"`
+	From    string `yaml:"from" json:"from"`
+	BaseURL string `yaml:"baseURL" json:"baseURL"`
+	Dir     string `yaml:"dir" json:"dir"`
+	SMTP    SMTP   `yaml:"smtp" json:"smtp"`
+}
+
+type SMTP struct {
+	Host         string `yaml:"host" json:"host"`
+	Port         string `yaml:"port" json:"port"`
+	User         string `yaml:"user" json:"user"`
+	Password     string `yaml:"password" json:"password"`
+	PasswordFile string `yaml:"passwordFile" json:"passwordFile"`
+}
+
+// Драйверы хранилища: postgres, sqlite для одного узла или in-memory, которому
+// не нужны внешние сервисы
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// Драйверы почты: smtp отправляет письма, file складывает их в каталог Mail.Dir,
+// log пишет в журнал - для локальной разработки
+const (
+	MailSMTP = "smtp"
+	MailFile = "file"
+	MailLog  = "log"
+)
+
+// Режимы миграций при старте: auto применяет неприменённые миграции,
+// check отказывается запускать сервер, пока схема отстаёт
+const (
+	MigrationsAuto  = "auto"
+	MigrationsCheck = "check"
+)
+
+// minSecretLength - минимальная длина ключа подписи JWT
+const minSecretLength = 16
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Default возвращает настройки по умолчанию. Ключа JWT среди них нет, его нужно задать явно
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:            ":8080",
+			ReadTimeout:     Duration(10 * time.Second),
+			WriteTimeout:    Duration(10 * time.Second),
+			ShutdownTimeout: Duration(5 * time.Second),
+		},
+		DB: DB{
+			Driver:         DriverPostgres,
+			Port:           "5432",
+			SSLMode:        "disable",
+			ConnectTimeout: Duration(5 * time.Second),
+			Migrations:     MigrationsAuto,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  Duration(15 * time.Minute),
+			RefreshTokenTTL: Duration(30 * 24 * time.Hour),
+			Password:        password.DefaultPolicy(),
+
+			RequireVerifiedEmail: true,
+			VerifyTokenTTL:       Duration(24 * time.Hour),
+			ResetTokenTTL:        Duration(time.Hour),
+			TOTPIssuer:           "Petstore",
+			ChallengeTTL:         Duration(5 * time.Minute),
+			LegacyLogin:          true,
+			Lockout: LoginLockout{
+				User: LockoutPolicy{
+					BackoffAfter: 3,
+					BaseDelay:    Duration(time.Second),
+					MaxDelay:     Duration(time.Minute),
+					LockAfter:    10,
+					LockDuration: Duration(15 * time.Minute),
+				},
+				IP: LockoutPolicy{
+					BackoffAfter: 20,
+					BaseDelay:    Duration(time.Second),
+					MaxDelay:     Duration(time.Minute),
+					LockAfter:    100,
+					LockDuration: Duration(15 * time.Minute),
+				},
+			},
+		},
+		Storage: Storage{
+			UploadDir: "uploads",
+		},
+		Mail: Mail{
+			Driver:  MailLog,
+			From:    "petstore@localhost",
+			BaseURL: "http://localhost:8080",
+			Dir:     "mail",
+			SMTP: SMTP{
+				Port: "587",
+			},
+		},
+	}
+}
+
+// option - настройка, которую можно задать переменной окружения и флагом
+type option struct {
+	env   string
+	flag  string
+	usage string
+	set   func(value string) error
+}
+
+func (c *Config) options() []option {
+	return []option{
+		{"HTTP_ADDR", "addr", "HTTP listen address", stringValue(&c.Server.Addr)},
+		{"HTTP_READ_TIMEOUT", "read-timeout", "HTTP read timeout", durationValue(&c.Server.ReadTimeout)},
+		{"HTTP_WRITE_TIMEOUT", "write-timeout", "HTTP write timeout", durationValue(&c.Server.WriteTimeout)},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "graceful shutdown timeout", durationValue(&c.Server.ShutdownTimeout)},
+		{"DB_DRIVER", "db-driver", "storage driver: postgres, sqlite or memory", stringValue(&c.DB.Driver)},
+		{"DB_HOST", "db-host", "database host", stringValue(&c.DB.Host)},
+		{"DB_PORT", "db-port", "database port", stringValue(&c.DB.Port)},
+		{"DB_USER", "db-user", "database user", stringValue(&c.DB.User)},
+		{"DB_PASSWORD", "db-password", "database password", stringValue(&c.DB.Password)},
+		{"DB_PASSWORD_FILE", "db-password-file", "file containing the database password", stringValue(&c.DB.PasswordFile)},
+		{"DB_NAME", "db-name", "database name (file path for sqlite)", stringValue(&c.DB.Name)},
+		{"DB_SSLMODE", "db-sslmode", "postgres sslmode", stringValue(&c.DB.SSLMode)},
+		{"DB_CONNECT_TIMEOUT", "db-connect-timeout", "how long to wait for the database on startup", durationValue(&c.DB.ConnectTimeout)},
+		{"DB_MIGRATIONS", "db-migrations", "migrations on startup: auto or check", stringValue(&c.DB.Migrations)},
+		{"JWT_SECRET", "jwt-secret", "JWT signing key", stringValue(&c.Auth.JWTSecret)},
+		{"JWT_SECRET_FILE", "jwt-secret-file", "file containing the JWT signing key", stringValue(&c.Auth.JWTSecretFile)},
+		{"ACCESS_TOKEN_TTL", "access-token-ttl", "access token lifetime", durationValue(&c.Auth.AccessTokenTTL)},
+		{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "refresh token lifetime", durationValue(&c.Auth.RefreshTokenTTL)},
+		{"PASSWORD_MIN_LENGTH", "password-min-length", "minimum password length", intValue(&c.Auth.Password.MinLength)},
+		{"PASSWORD_MAX_LENGTH", "password-max-length", "maximum password length", intValue(&c.Auth.Password.MaxLength)},
+		{"PASSWORD_REQUIRE_LOWER", "password-require-lower", "require a lowercase letter in passwords", boolValue(&c.Auth.Password.RequireLower)},
+		{"PASSWORD_REQUIRE_UPPER", "password-require-upper", "require an uppercase letter in passwords", boolValue(&c.Auth.Password.RequireUpper)},
+		{"PASSWORD_REQUIRE_DIGIT", "password-require-digit", "require a digit in passwords", boolValue(&c.Auth.Password.RequireDigit)},
+		{"PASSWORD_REQUIRE_SYMBOL", "password-require-symbol", "require a symbol in passwords", boolValue(&c.Auth.Password.RequireSymbol)},
+		{"PASSWORD_PASSPHRASE_LENGTH", "password-passphrase-length", "length from which character classes are not required, 0 to disable", intValue(&c.Auth.Password.PassphraseLength)},
+		{"PASSWORD_MIN_SCORE", "password-min-score", "minimum password strength score, 0-4", intValue(&c.Auth.Password.MinScore)},
+		{"PASSWORD_BREACHED_LIST", "password-breached-list", "file with breached passwords, one per line", stringValue(&c.Auth.Password.BreachedList)},
+		{"REQUIRE_VERIFIED_EMAIL", "require-verified-email", "deny login until the email address is verified", boolValue(&c.Auth.RequireVerifiedEmail)},
+		{"VERIFY_TOKEN_TTL", "verify-token-ttl", "email verification link lifetime", durationValue(&c.Auth.VerifyTokenTTL)},
+		{"RESET_TOKEN_TTL", "reset-token-ttl", "password reset link lifetime", durationValue(&c.Auth.ResetTokenTTL)},
+		{"TOTP_ISSUER", "totp-issuer", "service name shown in authenticator apps", stringValue(&c.Auth.TOTPIssuer)},
+		{"LOGIN_CHALLENGE_TTL", "login-challenge-ttl", "time to enter the two-factor code after the password", durationValue(&c.Auth.ChallengeTTL)},
+		{"LEGACY_LOGIN", "legacy-login", "keep the deprecated GET /user/login with credentials in the query string", boolValue(&c.Auth.LegacyLogin)},
+		{"LOCKOUT_USER_BACKOFF_AFTER", "lockout-user-backoff-after", "failed logins per username before delays start, 0 to disable", intValue(&c.Auth.Lockout.User.BackoffAfter)},
+		{"LOCKOUT_USER_BASE_DELAY", "lockout-user-base-delay", "first delay after failed logins per username", durationValue(&c.Auth.Lockout.User.BaseDelay)},
+		{"LOCKOUT_USER_MAX_DELAY", "lockout-user-max-delay", "longest delay after failed logins per username", durationValue(&c.Auth.Lockout.User.MaxDelay)},
+		{"LOCKOUT_USER_LOCK_AFTER", "lockout-user-lock-after", "failed logins per username before lockout, 0 to disable", intValue(&c.Auth.Lockout.User.LockAfter)},
+		{"LOCKOUT_USER_DURATION", "lockout-user-duration", "lockout duration per username", durationValue(&c.Auth.Lockout.User.LockDuration)},
+		{"LOCKOUT_IP_BACKOFF_AFTER", "lockout-ip-backoff-after", "failed logins per IP address before delays start, 0 to disable", intValue(&c.Auth.Lockout.IP.BackoffAfter)},
+		{"LOCKOUT_IP_BASE_DELAY", "lockout-ip-base-delay", "first delay after failed logins per IP address", durationValue(&c.Auth.Lockout.IP.BaseDelay)},
+		{"LOCKOUT_IP_MAX_DELAY", "lockout-ip-max-delay", "longest delay after failed logins per IP address", durationValue(&c.Auth.Lockout.IP.MaxDelay)},
+		{"LOCKOUT_IP_LOCK_AFTER", "lockout-ip-lock-after", "failed logins per IP address before lockout, 0 to disable", intValue(&c.Auth.Lockout.IP.LockAfter)},
+		{"LOCKOUT_IP_DURATION", "lockout-ip-duration", "lockout duration per IP address", durationValue(&c.Auth.Lockout.IP.LockDuration)},
+		{"UPLOAD_DIR", "upload-dir", "directory for uploaded images", stringValue(&c.Storage.UploadDir)},
+		{"MAIL_DRIVER", "mail-driver", "mail delivery: smtp, file or log", stringValue(&c.Mail.Driver)},
+		{"MAIL_FROM", "mail-from", "sender address", stringValue(&c.Mail.From)},
+		{"MAIL_BASE_URL", "mail-base-url", "site address used in links sent by mail", stringValue(&c.Mail.BaseURL)},
+		{"MAIL_DIR", "mail-dir", "directory for messages of the file driver", stringValue(&c.Mail.Dir)},
+		{"SMTP_HOST", "smtp-host", "SMTP server host", stringValue(&c.Mail.SMTP.Host)},
+		{"SMTP_PORT", "smtp-port", "SMTP server port", stringValue(&c.Mail.SMTP.Port)},
+		{"SMTP_USER", "smtp-user", "SMTP user", stringValue(&c.Mail.SMTP.User)},
+		{"SMTP_PASSWORD", "smtp-password", "SMTP password", stringValue(&c.Mail.SMTP.Password)},
+		{"SMTP_PASSWORD_FILE", "smtp-password-file", "file containing the SMTP password", stringValue(&c.Mail.SMTP.PasswordFile)},
+	}
+}
+
+// Load собирает конфигурацию из файла, окружения и флагов args и проверяет её.
+// Путь к файлу задаётся флагом -config или переменной CONFIG_FILE
+func Load(args []string) (Config, error) {
+	cfg, _, err := LoadArgs(args)
+	return cfg, err
+}
+
+// LoadArgs - то же, что Load, но дополнительно возвращает аргументы после флагов,
+// например подкоманду
+func LoadArgs(args []string) (Config, []string, error) {
+	cfg := Default()
+	options := cfg.options()
+
+	fs := flag.NewFlagSet("petstore", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or JSON config file")
+
+	// Флаги применяются последними, поэтому при разборе только запоминаем их значения
+	var flagValues []func() error
+	for _, opt := range options {
+		set := opt.set
+		name := opt.flag
+		fs.Func(name, opt.usage+" (env "+opt.env+")", func(value string) error {
+			flagValues = append(flagValues, func() error {
+				if err := set(value); err != nil {
+					return fmt.Errorf("flag -%s: %w", name, err)
+				}
+				return nil
+			})
+			return nil
+		})
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	if *configFile != "" {
+		err = cfg.loadFile(*configFile)
+		if err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	// Пустые переменные окружения считаются незаданными
+	for _, opt := range options {
+		value := os.Getenv(opt.env)
+		if value == "" {
+			continue
+		}
+		if err := opt.set(value); err != nil {
+			return Config{}, nil, fmt.Errorf("env %s: %w", opt.env, err)
+		}
+	}
+
+	for _, apply := range flagValues {
+		if err := apply(); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	err = cfg.readSecrets()
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, c)
+	} else {
+		err = yaml.Unmarshal(data, c)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readSecrets подставляет секреты из файлов; файл имеет приоритет над значением, заданным напрямую
+func (c *Config) readSecrets() error {
+	secrets := []struct {
+		path  string
+		value *string
+	}{
+		{c.DB.PasswordFile, &c.DB.Password},
+		{c.Auth.JWTSecretFile, &c.Auth.JWTSecret},
+		{c.Mail.SMTP.PasswordFile, &c.Mail.SMTP.Password},
+	}
+
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("read secret: %w", err)
+		}
+		*secret.value = strings.TrimSpace(string(data))
+	}
+
+	return nil
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+
+	durations := []struct {
+		name  string
+		value Duration
+	}{
+		{"server.readTimeout", c.Server.ReadTimeout},
+		{"server.writeTimeout", c.Server.WriteTimeout},
+		{"server.shutdownTimeout", c.Server.ShutdownTimeout},
+		{"db.connectTimeout", c.DB.ConnectTimeout},
+		{"auth.accessTokenTTL", c.Auth.AccessTokenTTL},
+		{"auth.refreshTokenTTL", c.Auth.RefreshTokenTTL},
+		{"auth.verifyTokenTTL", c.Auth.VerifyTokenTTL},
+		{"auth.resetTokenTTL", c.Auth.ResetTokenTTL},
+		{"auth.challengeTTL", c.Auth.ChallengeTTL},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.name))
+		}
+	}
+
+	if c.Auth.AccessTokenTTL >= c.Auth.RefreshTokenTTL {
+		errs = append(errs, errors.New("auth.accessTokenTTL must be shorter than auth.refreshTokenTTL"))
+	}
+
+	if len(c.Auth.JWTSecret) < minSecretLength {
+		errs = append(errs, fmt.Errorf("auth.jwtSecret must be at least %d characters", minSecretLength))
+	}
+
+	if c.Auth.TOTPIssuer == "" {
+		errs = append(errs, errors.New("auth.totpIssuer is required"))
+	}
+
+	errs = append(errs, c.Auth.Lockout.User.validate("auth.lockout.user")...)
+	errs = append(errs, c.Auth.Lockout.IP.validate("auth.lockout.ip")...)
+
+	err := c.Auth.Password.Validate()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.DB.Driver {
+	case DriverMemory:
+	case DriverSQLite:
+		if c.DB.Name == "" {
+			errs = append(errs, errors.New("db.name is required: path to the sqlite database file"))
+		}
+	case DriverPostgres:
+		if c.DB.Host == "" {
+			errs = append(errs, errors.New("db.host is required"))
+		}
+		if c.DB.Name == "" {
+			errs = append(errs, errors.New("db.name is required"))
+		}
+		if !contains(sslModes, c.DB.SSLMode) {
+			errs = append(errs, fmt.Errorf("db.sslMode must be one of %s", strings.Join(sslModes, ", ")))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported db.driver: %q", c.DB.Driver))
+	}
+
+	if c.DB.Driver != DriverMemory && c.DB.Migrations != MigrationsAuto && c.DB.Migrations != MigrationsCheck {
+		errs = append(errs, fmt.Errorf("db.migrations must be %s or %s", MigrationsAuto, MigrationsCheck))
+	}
+
+	if c.Storage.UploadDir == "" {
+		errs = append(errs, errors.New("storage.uploadDir is required"))
+	}
+
+	if c.Mail.From == "" {
+		errs = append(errs, errors.New("mail.from is required"))
+	}
+	if c.Mail.BaseURL == "" {
+		errs = append(errs, errors.New("mail.baseURL is required"))
+	}
+
+	switch c.Mail.Driver {
+	case MailLog:
+	case MailFile:
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("mail.dir is required for the file driver"))
+		}
+	case MailSMTP:
+		if c.Mail.SMTP.Host == "" {
+			errs = append(errs, errors.New("mail.smtp.host is required"))
+		}
+		if c.Mail.SMTP.Port == "" {
+			errs = append(errs, errors.New("mail.smtp.port is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported mail.driver: %q", c.Mail.Driver))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func intValue(target *int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = n
+		return nil
+	}
+}
+
+func boolValue(target *bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = b
+		return nil
+	}
+}
+
+func durationValue(target *Duration) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = Duration(d)
+		return nil
+	}
+}
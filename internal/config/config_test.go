@@ -0,0 +1,292 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/lockout"
+)
+
+const testSecret = "0123456789abcdef"
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_NAME", "petstore")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":8080", cfg.Server.Addr)
+	assert.Equal(t, 10*time.Second, cfg.Server.ReadTimeout.Std())
+	assert.Equal(t, "disable", cfg.DB.SSLMode)
+	assert.Equal(t, 5*time.Second, cfg.DB.ConnectTimeout.Std())
+	assert.Equal(t, "uploads", cfg.Storage.UploadDir)
+	assert.Equal(t, "Petstore", cfg.Auth.TOTPIssuer)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.ChallengeTTL.Std())
+	assert.True(t, cfg.Auth.LegacyLogin)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  addr: ":7000"
+  readTimeout: 3s
+db:
+  host: file-host
+  name: file-db
+  sslMode: require
+auth:
+  jwtSecret: `+testSecret+`
+`)
+
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("HTTP_ADDR", ":7001")
+
+	cfg, err := Load([]string{"-config", path, "-addr", ":7002"})
+	require.NoError(t, err)
+
+	// флаг важнее окружения, окружение важнее файла
+	assert.Equal(t, ":7002", cfg.Server.Addr)
+	assert.Equal(t, "env-host", cfg.DB.Host)
+	assert.Equal(t, "file-db", cfg.DB.Name)
+	assert.Equal(t, "require", cfg.DB.SSLMode)
+	assert.Equal(t, 3*time.Second, cfg.Server.ReadTimeout.Std())
+	assert.Equal(t, 10*time.Second, cfg.Server.WriteTimeout.Std())
+}
+
+func TestLoadJSONFromEnv(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+		"db": {"host": "json-host", "name": "json-db", "connectTimeout": "30s"},
+		"auth": {"jwtSecret": "`+testSecret+`"}
+	}`)
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "json-host", cfg.DB.Host)
+	assert.Equal(t, 30*time.Second, cfg.DB.ConnectTimeout.Std())
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	jwtFile := writeFile(t, "jwt", "  file-secret-0123456789\n")
+	passwordFile := writeFile(t, "db_password", "s3cr3t\n")
+
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_NAME", "petstore")
+	t.Setenv("DB_PASSWORD", "inline")
+	t.Setenv("JWT_SECRET_FILE", jwtFile)
+
+	cfg, err := Load([]string{"-db-password-file", passwordFile})
+	require.NoError(t, err)
+
+	assert.Equal(t, "file-secret-0123456789", cfg.Auth.JWTSecret)
+	assert.Equal(t, "s3cr3t", cfg.DB.Password)
+}
+
+func TestLoadMemoryDriver(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	// in-memory хранилищу настройки подключения к базе не нужны
+	cfg, err := Load([]string{"-db-driver", DriverMemory})
+	require.NoError(t, err)
+
+	assert.Equal(t, DriverMemory, cfg.DB.Driver)
+}
+
+func TestLoadArgs(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	cfg, args, err := LoadArgs([]string{"-db-driver", DriverSQLite, "-db-name", "petstore.db", "migrate", "up"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "petstore.db", cfg.DB.Name)
+	assert.Equal(t, MigrationsAuto, cfg.DB.Migrations)
+	assert.Equal(t, []string{"migrate", "up"}, args)
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+auth:
+  jwtSecret: `+testSecret+`
+  password:
+    minLength: 12
+    requireUpper: true
+`)
+	t.Setenv("PASSWORD_REQUIRE_DIGIT", "true")
+
+	cfg, err := Load([]string{"-config", path, "-db-driver", DriverMemory, "-password-min-score", "3"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 12, cfg.Auth.Password.MinLength)
+	assert.True(t, cfg.Auth.Password.RequireUpper)
+	assert.True(t, cfg.Auth.Password.RequireDigit)
+	assert.Equal(t, 3, cfg.Auth.Password.MinScore)
+	// не заданные в файле значения остаются по умолчанию
+	assert.Equal(t, 64, cfg.Auth.Password.MaxLength)
+}
+
+func TestLoadMail(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+auth:
+  jwtSecret: `+testSecret+`
+  resetTokenTTL: 30m
+mail:
+  driver: smtp
+  from: shop@example.com
+  smtp:
+    host: smtp.example.com
+`)
+	passwordFile := writeFile(t, "smtp_password", "mail-secret\n")
+	t.Setenv("SMTP_PASSWORD_FILE", passwordFile)
+
+	cfg, err := Load([]string{"-config", path, "-db-driver", DriverMemory, "-require-verified-email=false"})
+	require.NoError(t, err)
+
+	assert.Equal(t, MailSMTP, cfg.Mail.Driver)
+	assert.Equal(t, "smtp.example.com", cfg.Mail.SMTP.Host)
+	assert.Equal(t, "587", cfg.Mail.SMTP.Port)
+	assert.Equal(t, "mail-secret", cfg.Mail.SMTP.Password)
+	assert.False(t, cfg.Auth.RequireVerifiedEmail)
+	assert.Equal(t, 30*time.Minute, cfg.Auth.ResetTokenTTL.Std())
+	assert.Equal(t, 24*time.Hour, cfg.Auth.VerifyTokenTTL.Std())
+}
+
+func TestLoadLockout(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+auth:
+  jwtSecret: `+testSecret+`
+  lockout:
+    user:
+      lockAfter: 5
+      lockDuration: 1h
+`)
+	t.Setenv("LOCKOUT_IP_LOCK_AFTER", "0")
+	t.Setenv("LEGACY_LOGIN", "false")
+
+	cfg, err := Load([]string{"-config", path, "-db-driver", DriverMemory, "-lockout-user-max-delay", "30s"})
+	require.NoError(t, err)
+
+	assert.Equal(t, lockout.Policy{
+		BackoffAfter: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockAfter:    5,
+		LockDuration: time.Hour,
+	}, cfg.Auth.Lockout.User.Policy())
+	assert.Zero(t, cfg.Auth.Lockout.IP.LockAfter)
+	assert.Equal(t, 20, cfg.Auth.Lockout.IP.BackoffAfter)
+	assert.False(t, cfg.Auth.LegacyLogin)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{
+			name: "missing jwt secret",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore"},
+		},
+		{
+			name: "short jwt secret",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore", "JWT_SECRET": "short"},
+		},
+		{
+			name: "missing db host",
+			env:  map[string]string{"DB_NAME": "petstore", "JWT_SECRET": testSecret},
+		},
+		{
+			name: "bad sslmode",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore", "JWT_SECRET": testSecret, "DB_SSLMODE": "sometimes"},
+		},
+		{
+			name: "bad duration",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore", "JWT_SECRET": testSecret, "HTTP_READ_TIMEOUT": "ten"},
+		},
+		{
+			name: "unknown driver",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore", "JWT_SECRET": testSecret},
+			args: []string{"-db-driver", "oracle"},
+		},
+		{
+			name: "sqlite without file",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverSQLite},
+		},
+		{
+			name: "bad migrations mode",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore", "JWT_SECRET": testSecret, "DB_MIGRATIONS": "sometimes"},
+		},
+		{
+			name: "missing secret file",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_NAME": "petstore", "JWT_SECRET_FILE": "/nonexistent/jwt"},
+		},
+		{
+			name: "bad password policy",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "PASSWORD_MIN_SCORE": "9"},
+		},
+		{
+			name: "bad password length",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "PASSWORD_MIN_LENGTH": "eight"},
+		},
+		{
+			name: "unknown mail driver",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "MAIL_DRIVER": "pigeon"},
+		},
+		{
+			name: "smtp without host",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "MAIL_DRIVER": MailSMTP},
+		},
+		{
+			name: "zero challenge ttl",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "LOGIN_CHALLENGE_TTL": "0s"},
+		},
+		{
+			name: "negative lockout threshold",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "LOCKOUT_USER_LOCK_AFTER": "-1"},
+		},
+		{
+			name: "lockout max delay below base",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_DRIVER": DriverMemory, "LOCKOUT_IP_MAX_DELAY": "500ms"},
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-no-such-flag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load(tt.args)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Addr = ""
+
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "server.addr")
+	assert.Contains(t, err.Error(), "auth.jwtSecret")
+	assert.Contains(t, err.Error(), "db.host")
+}
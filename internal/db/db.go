@@ -1,56 +1,50 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
+	"strings"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
 )
 
-type DB interface {
-	AutoMigrate(dst ...interface{}) error
-}
-
-type dbConf struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Name     string
-	Driver   string
-}
-
-func NewDbConf() *dbConf {
-	return &dbConf{
-		Host:     os.Getenv("DB_HOST"),
-		Port:     os.Getenv("DB_PORT"),
-		User:     os.Getenv("DB_USER"),
-		Password: os.Getenv("DB_PASSWORD"),
-		Name:     os.Getenv("DB_NAME"),
-		Driver:   os.Getenv("DB_DRIVER"),
+// NewDB открывает базу драйвером conf.Driver
+func NewDB(conf config.DB) (*gorm.DB, error) {
+	switch conf.Driver {
+	case config.DriverPostgres:
+		return newPostgres(conf)
+	case config.DriverSQLite:
+		return newSQLite(conf)
+	default:
+		return nil, fmt.Errorf("unsupported db driver: %q", conf.Driver)
 	}
 }
 
-func NewDB(dbConf dbConf) (*gorm.DB, error) {
+// newPostgres подключается к базе, повторяя попытки раз в секунду, пока не истечёт conf.ConnectTimeout
+func newPostgres(conf config.DB) (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbConf.Host, dbConf.Port, dbConf.User, dbConf.Password, dbConf.Name,
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		conf.Host, conf.Port, conf.User, conf.Password, conf.Name, conf.SSLMode,
 	)
 
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
-	timeoutExceeded := time.After(time.Second * time.Duration(5))
+	timeoutExceeded := time.After(conf.ConnectTimeout.Std())
 
 	for {
 		select {
 		case <-timeoutExceeded:
-			return nil, fmt.Errorf("db connection failed after %d timeout", 5)
+			return nil, fmt.Errorf("db connection failed after %s timeout", conf.ConnectTimeout)
 		case <-ticker.C:
 			db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+			if err != nil {
+				continue
+			}
 			sqlDB, err := db.DB()
 			if err != nil {
 				return nil, err
@@ -63,16 +57,44 @@ func NewDB(dbConf dbConf) (*gorm.DB, error) {
 	}
 }
 
-func MigrateDB(db DB) error {
+// newSQLite открывает файл базы conf.Name. Внешние ключи в SQLite по умолчанию выключены,
+// а SELECT ... FOR UPDATE не поддерживается, поэтому соединение одно: транзакции
+// выполняются строго по очереди и резерв питомца не может быть выдан дважды
+func newSQLite(conf config.DB) (*gorm.DB, error) {
+	dsn := conf.Name
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	}
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", conf.Name, err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = sqlDB.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", conf.Name, err)
+	}
+
+	return db, nil
+}
+
+// MigrateDB применяет все неприменённые миграции
+func MigrateDB(db *gorm.DB) error {
 	log.Println("Running database migrations...")
-	err := db.AutoMigrate(
-		&models.User{},
-		&models.Tag{},
-		&models.Category{},
-		&models.Pet{},
-		&models.PhotoUrl{},
-		&models.Order{},
-	)
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	err = migrator.Up(context.Background())
 	if err != nil {
 		log.Printf("Migration error: %v", err)
 		return err
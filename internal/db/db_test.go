@@ -1,75 +1,172 @@
 package db
 
 import (
-	"os"
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 )
 
-type MockGormDB struct {
-	mock.Mock
-}
+func newSQLiteDB(t *testing.T) *gorm.DB {
+	conf := config.Default().DB
+	conf.Driver = config.DriverSQLite
+	conf.Name = filepath.Join(t.TempDir(), "petstore.db")
 
-func (m *MockGormDB) AutoMigrate(models ...interface{}) error {
-	args := m.Called(models)
-	return args.Error(0)
+	db, err := NewDB(conf)
+	require.NoError(t, err)
+	return db
 }
 
 func TestMigrateDB(t *testing.T) {
-	mockDB := new(MockGormDB)
+	db := newSQLiteDB(t)
 
-	t.Run("Success", func(t *testing.T) {
-		mockDB.On("AutoMigrate", mock.Anything).Return(nil)
+	require.NoError(t, MigrateDB(db))
+	// повторный запуск ничего не делает
+	require.NoError(t, MigrateDB(db))
 
-		err := MigrateDB(mockDB)
-		if err != nil {
-			t.Errorf("Expected no error, got %v", err)
-		}
+	err := db.Create(&models.Category{Name: "dogs"}).Error
+	assert.NoError(t, err)
 
-		mockDB.AssertCalled(t, "AutoMigrate", mock.Anything)
-		mockDB.AssertExpectations(t)
-	})
+	// внешние ключи включены, как в Postgres
+	err = db.Create(&models.Pet{Name: "Rex", CategoryID: 42}).Error
+	assert.Error(t, err)
 }
 
-func TestNewDbConf(t *testing.T) {
-	envs := map[string]string{
-		"DB_HOST":     "localhost",
-		"DB_PORT":     "5432",
-		"DB_USER":     "test_user",
-		"DB_PASSWORD": "test_password",
-		"DB_NAME":     "test_db",
-		"DB_DRIVER":   "postgres",
-	}
+func TestNewDB_UnknownDriver(t *testing.T) {
+	conf := config.Default().DB
+	conf.Driver = "oracle"
+
+	_, err := NewDB(conf)
+	assert.Error(t, err)
+}
+
+func TestMigrator(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
 
-	for key, value := range envs {
-		assert.NoError(t, os.Setenv(key, value), "Failed to set environment variable")
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, migrator.Check(ctx), ErrSchemaBehind)
+
+	require.NoError(t, migrator.Up(ctx))
+	assert.NoError(t, migrator.Check(ctx))
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "migration %d", status.Version)
 	}
 
-	conf := NewDbConf()
+	require.NoError(t, migrator.Down(ctx))
+	assert.ErrorIs(t, migrator.Check(ctx), ErrSchemaBehind)
+
+	require.NoError(t, migrator.To(ctx, 0))
+	assert.False(t, db.Migrator().HasTable("pets"))
 
-	assert.Equal(t, envs["DB_HOST"], conf.Host, "DB_HOST mismatch")
-	assert.Equal(t, envs["DB_PORT"], conf.Port, "DB_PORT mismatch")
-	assert.Equal(t, envs["DB_USER"], conf.User, "DB_USER mismatch")
-	assert.Equal(t, envs["DB_PASSWORD"], conf.Password, "DB_PASSWORD mismatch")
-	assert.Equal(t, envs["DB_NAME"], conf.Name, "DB_NAME mismatch")
-	assert.Equal(t, envs["DB_DRIVER"], conf.Driver, "DB_DRIVER mismatch")
+	require.NoError(t, migrator.To(ctx, migrator.Latest()))
+	assert.True(t, db.Migrator().HasTable("order_transitions"))
 
-	for key := range envs {
-		assert.NoError(t, os.Unsetenv(key), "Failed to unset environment variable")
+	assert.ErrorIs(t, migrator.To(ctx, 9999), ErrUnknownMigration)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(fstest.MapFS{
+		"0002_add_column.up.sql":   {Data: []byte("ALTER TABLE a ADD b text;")},
+		"0002_add_column.down.sql": {Data: []byte("ALTER TABLE a DROP b;")},
+		"0001_init.up.sql":         {Data: []byte("CREATE TABLE a (id int);")},
+		"0001_init.down.sql":       {Data: []byte("DROP TABLE a;")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "add_column", migrations[1].Name)
+
+	_, err = LoadMigrations(fstest.MapFS{
+		"0001_init.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	})
+	assert.Error(t, err, "Миграция без down-файла должна отклоняться")
+
+	_, err = LoadMigrations(fstest.MapFS{
+		"init.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	})
+	assert.Error(t, err)
+}
+
+// У каждого диалекта должен быть одинаковый набор миграций
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	var versions [][]string
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		dir, err := fs.Sub(migrationFiles, "migrations/"+dialect)
+		require.NoError(t, err)
+
+		migrations, err := LoadMigrations(dir)
+		require.NoError(t, err)
+
+		var names []string
+		for _, migration := range migrations {
+			names = append(names, fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+		versions = append(versions, names)
 	}
+
+	assert.Equal(t, versions[0], versions[1])
 }
 
-func TestNewDbConf_EmptyEnvironment(t *testing.T) {
-	os.Clearenv()
+// baselineSchema - таблицы, которые создавал AutoMigrate до перехода на миграции
+const baselineSchema = `
+CREATE TABLE users (id integer PRIMARY KEY AUTOINCREMENT, username text, first_name text, last_name text,
+	email text, password text, phone text, user_status integer);
+CREATE TABLE categories (id integer PRIMARY KEY AUTOINCREMENT, name text);
+CREATE TABLE tags (id integer PRIMARY KEY AUTOINCREMENT, name text);
+CREATE TABLE pets (id integer PRIMARY KEY AUTOINCREMENT, category_id integer, name text, status text);
+CREATE TABLE pet_tags (pet_id integer, tag_id integer, PRIMARY KEY (pet_id, tag_id));
+CREATE TABLE photo_urls (id integer PRIMARY KEY AUTOINCREMENT, photo_url text, pet_refer_id integer);
+CREATE TABLE orders (id integer PRIMARY KEY AUTOINCREMENT, pet_id integer, quantity integer,
+	ship_date datetime, status text, complete numeric);
+INSERT INTO users (username, email, password, user_status) VALUES ('old', 'old@example.com', 'hash', 0);
+INSERT INTO categories (name) VALUES ('dogs');
+INSERT INTO pets (category_id, name, status) VALUES (1, 'Rex', 'available');
+INSERT INTO orders (pet_id, quantity, status, complete) VALUES (1, 1, 'placed', false);
+`
+
+func TestMigrator_AdoptsAutoMigrateSchema(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec(baselineSchema).Error)
+
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(ctx))
+	assert.NoError(t, migrator.Check(ctx))
+
+	for _, column := range legacyColumns {
+		assert.True(t, db.Migrator().HasColumn(column.table, column.column), "%s.%s", column.table, column.column)
+	}
+
+	var user models.User
+	require.NoError(t, db.Where("username = ?", "old").First(&user).Error)
+	assert.Equal(t, models.RoleCustomer, user.Role)
+	assert.EqualValues(t, 1, user.Version)
+	assert.True(t, user.EmailVerified)
+
+	var pet models.Pet
+	require.NoError(t, db.First(&pet, 1).Error)
+	assert.EqualValues(t, 1, pet.Version)
 
-	conf := NewDbConf()
+	var order models.Order
+	require.NoError(t, db.First(&order, 1).Error)
+	assert.EqualValues(t, 1, order.Version)
 
-	assert.Empty(t, conf.Host, "Expected Host to be empty")
-	assert.Empty(t, conf.Port, "Expected Port to be empty")
-	assert.Empty(t, conf.User, "Expected User to be empty")
-	assert.Empty(t, conf.Password, "Expected Password to be empty")
-	assert.Empty(t, conf.Name, "Expected Name to be empty")
-	assert.Empty(t, conf.Driver, "Expected Driver to be empty")
+	err = db.Create(&models.Order{PetID: pet.ID, Quantity: 1, UserID: user.ID, Status: "placed"}).Error
+	assert.NoError(t, err)
 }
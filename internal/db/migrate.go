@@ -0,0 +1,355 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaBehind     = errors.New("database schema is behind")
+	ErrUnknownMigration = errors.New("unknown migration version")
+)
+
+// migrationName - файлы миграций называются NNNN_описание.up.sql и NNNN_описание.down.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator применяет и откатывает миграции, записывая применённые версии в schema_migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator берёт встроенные в бинарник миграции для диалекта базы db
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	dir, err := fs.Sub(migrationFiles, path.Join("migrations", db.Dialector.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations for %s", db.Dialector.Name())
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// LoadMigrations читает миграции из fsys по возрастанию версий; у каждой должны быть оба файла
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected file in migrations: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest возвращает версию последней известной бинарнику миграции
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status перечисляет известные миграции; у неприменённых AppliedAt пустой
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			appliedAt := appliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Check возвращает ErrSchemaBehind, если в базе применены не все миграции
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.pending(ctx, m.Latest())
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations, latest is %d", ErrSchemaBehind, len(pending), m.Latest())
+	}
+
+	return nil
+}
+
+// Up применяет все неприменённые миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down откатывает последнюю применённую миграцию
+func (m *Migrator) Down(ctx context.Context) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if _, ok := applied[m.migrations[i].Version]; ok {
+			return m.apply(ctx, m.migrations[i], false)
+		}
+	}
+
+	return nil
+}
+
+// To приводит схему к версии version: применяет миграции до неё включительно
+// и откатывает более новые. Версия 0 откатывает все миграции
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; ok && migration.Version > version {
+			err = m.apply(ctx, migration, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	pending, err := m.pending(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		err = m.apply(ctx, migration, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply выполняет миграцию и меняет запись о ней в одной транзакции
+func (m *Migrator) apply(ctx context.Context, migration Migration, up bool) error {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if !up {
+			err := tx.Exec(migration.Down).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+		}
+
+		if migration.Version == m.migrations[0].Version {
+			err := addLegacyColumns(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Exec(migration.Up).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			migration.Version, migration.Name, time.Now().UTC(),
+		).Error
+	})
+
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	if err != nil {
+		return fmt.Errorf("migration %d_%s %s: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	return nil
+}
+
+// legacyColumn - столбец, которого нет в базах, созданных AutoMigrate до перехода на миграции
+type legacyColumn struct {
+	table    string
+	column   string
+	postgres string
+	sqlite   string
+}
+
+// legacyColumns добавляет первая миграция: её CREATE TABLE IF NOT EXISTS пропускает таблицы,
+// которые уже создал AutoMigrate, и без этих столбцов запросы к ним падают
+var legacyColumns = []legacyColumn{
+	{"users", "role", "text NOT NULL DEFAULT 'customer'", "text NOT NULL DEFAULT 'customer'"},
+	{"users", "version", "bigint NOT NULL DEFAULT 1", "integer NOT NULL DEFAULT 1"},
+	{"pets", "version", "bigint NOT NULL DEFAULT 1", "integer NOT NULL DEFAULT 1"},
+	{"photo_urls", "object_key", "text", "text"},
+	{"photo_urls", "content_type", "text", "text"},
+	{"photo_urls", "size", "bigint", "integer"},
+	{"photo_urls", "additional_metadata", "text", "text"},
+	{"orders", "version", "bigint NOT NULL DEFAULT 1", "integer NOT NULL DEFAULT 1"},
+	{"orders", "user_id", "bigint", "integer"},
+	{"orders", "created_at", "timestamptz", "datetime"},
+}
+
+// addLegacyColumns дополняет схему, созданную AutoMigrate, до состояния перед первой миграцией.
+// В новой базе таблиц ещё нет, и ничего не меняется
+func addLegacyColumns(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+
+	for _, column := range legacyColumns {
+		if !migrator.HasTable(column.table) || migrator.HasColumn(column.table, column.column) {
+			continue
+		}
+
+		definition := column.postgres
+		if tx.Dialector.Name() == "sqlite" {
+			definition = column.sqlite
+		}
+
+		err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.column, definition)).Error
+		if err != nil {
+			return fmt.Errorf("add %s.%s: %w", column.table, column.column, err)
+		}
+	}
+
+	return nil
+}
+
+// pending возвращает неприменённые миграции с версией не выше version
+func (m *Migrator) pending(ctx context.Context, version int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	err := m.db.WithContext(ctx).Exec(
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamp NOT NULL)",
+	).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Version   int
+		AppliedAt time.Time
+	}
+	err = m.db.WithContext(ctx).
+		Table("schema_migrations").
+		Select("version, applied_at").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+-- Базовая схема. IF NOT EXISTS позволяет применить миграцию к базе, созданной раньше
+-- через AutoMigrate: недостающие в её таблицах столбцы Migrator добавляет перед этой
+-- миграцией (legacyColumns в migrate.go), остальные таблицы и индексы создаются здесь
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    username text,
+    first_name text,
+    last_name text,
+    email text,
+    password text,
+    phone text,
+    user_status bigint,
+    role text NOT NULL DEFAULT 'customer',
+    version bigint NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    user_id bigint,
+    token_hash text,
+    expires_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti text PRIMARY KEY,
+    expires_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    name text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags (name);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id bigserial PRIMARY KEY,
+    name text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);
+
+CREATE TABLE IF NOT EXISTS pets (
+    id bigserial PRIMARY KEY,
+    category_id bigint,
+    name text,
+    status text,
+    version bigint NOT NULL DEFAULT 1,
+    CONSTRAINT fk_pets_category FOREIGN KEY (category_id) REFERENCES categories (id)
+);
+
+CREATE TABLE IF NOT EXISTS pet_tags (
+    pet_id bigint,
+    tag_id bigint,
+    PRIMARY KEY (pet_id, tag_id),
+    CONSTRAINT fk_pet_tags_pet FOREIGN KEY (pet_id) REFERENCES pets (id) ON DELETE CASCADE,
+    CONSTRAINT fk_pet_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS photo_urls (
+    id bigserial PRIMARY KEY,
+    photo_url text,
+    pet_refer_id bigint,
+    object_key text,
+    content_type text,
+    size bigint,
+    additional_metadata text,
+    CONSTRAINT fk_pets_photo_urls FOREIGN KEY (pet_refer_id) REFERENCES pets (id)
+);
+
+CREATE TABLE IF NOT EXISTS photo_variants (
+    id bigserial PRIMARY KEY,
+    photo_id bigint,
+    name text,
+    photo_url text,
+    object_key text,
+    content_type text,
+    size bigint,
+    width bigint,
+    height bigint,
+    CONSTRAINT fk_photo_urls_variants FOREIGN KEY (photo_id) REFERENCES photo_urls (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id bigserial PRIMARY KEY,
+    pet_id bigint,
+    quantity bigint,
+    ship_date text,
+    status text,
+    complete boolean,
+    version bigint NOT NULL DEFAULT 1,
+    user_id bigint,
+    created_at timestamptz,
+    CONSTRAINT fk_orders_pet FOREIGN KEY (pet_id) REFERENCES pets (id)
+);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
+
+CREATE TABLE IF NOT EXISTS order_transitions (
+    id bigserial PRIMARY KEY,
+    order_id bigint,
+    from_status text,
+    to_status text,
+    comment text,
+    created_at timestamptz
+);
@@ -0,0 +1,17 @@
+-- Второй фактор: секреты TOTP и хэши кодов восстановления
+CREATE TABLE IF NOT EXISTS user_totps (
+    user_id bigint PRIMARY KEY,
+    secret text,
+    confirmed_at timestamptz,
+    last_step bigint NOT NULL DEFAULT 0,
+    created_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint,
+    code_hash text,
+    used_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_code_hash ON recovery_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
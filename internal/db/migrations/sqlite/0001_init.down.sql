@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS order_transitions;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS photo_variants;
+DROP TABLE IF EXISTS photo_urls;
+DROP TABLE IF EXISTS pet_tags;
+DROP TABLE IF EXISTS pets;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,108 @@
+-- Базовая схема. IF NOT EXISTS позволяет применить миграцию к базе, созданной раньше
+-- через AutoMigrate: недостающие в её таблицах столбцы Migrator добавляет перед этой
+-- миграцией (legacyColumns в migrate.go), остальные таблицы и индексы создаются здесь
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    username text,
+    first_name text,
+    last_name text,
+    email text,
+    password text,
+    phone text,
+    user_status integer,
+    role text NOT NULL DEFAULT 'customer',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    token_hash text,
+    expires_at datetime,
+    revoked_at datetime,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti text PRIMARY KEY,
+    expires_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags (name);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);
+
+CREATE TABLE IF NOT EXISTS pets (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    category_id integer,
+    name text,
+    status text,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT fk_pets_category FOREIGN KEY (category_id) REFERENCES categories (id)
+);
+
+CREATE TABLE IF NOT EXISTS pet_tags (
+    pet_id integer,
+    tag_id integer,
+    PRIMARY KEY (pet_id, tag_id),
+    CONSTRAINT fk_pet_tags_pet FOREIGN KEY (pet_id) REFERENCES pets (id) ON DELETE CASCADE,
+    CONSTRAINT fk_pet_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS photo_urls (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    photo_url text,
+    pet_refer_id integer,
+    object_key text,
+    content_type text,
+    size integer,
+    additional_metadata text,
+    CONSTRAINT fk_pets_photo_urls FOREIGN KEY (pet_refer_id) REFERENCES pets (id)
+);
+
+CREATE TABLE IF NOT EXISTS photo_variants (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    photo_id integer,
+    name text,
+    photo_url text,
+    object_key text,
+    content_type text,
+    size integer,
+    width integer,
+    height integer,
+    CONSTRAINT fk_photo_urls_variants FOREIGN KEY (photo_id) REFERENCES photo_urls (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    pet_id integer,
+    quantity integer,
+    ship_date text,
+    status text,
+    complete numeric,
+    version integer NOT NULL DEFAULT 1,
+    user_id integer,
+    created_at datetime,
+    CONSTRAINT fk_orders_pet FOREIGN KEY (pet_id) REFERENCES pets (id)
+);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
+
+CREATE TABLE IF NOT EXISTS order_transitions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    order_id integer,
+    from_status text,
+    to_status text,
+    comment text,
+    created_at datetime
+);
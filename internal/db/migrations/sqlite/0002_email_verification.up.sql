@@ -0,0 +1,17 @@
+-- Подтверждение почты и сброс пароля. Уже зарегистрированные пользователи
+-- считаются подтверждёнными, чтобы обновление не закрыло им вход
+ALTER TABLE users ADD COLUMN email_verified numeric NOT NULL DEFAULT false;
+UPDATE users SET email_verified = true;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    purpose text,
+    token_hash text,
+    email text,
+    expires_at datetime,
+    used_at datetime,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_tokens_token_hash ON user_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
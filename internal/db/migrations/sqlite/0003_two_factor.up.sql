@@ -0,0 +1,17 @@
+-- Второй фактор: секреты TOTP и хэши кодов восстановления
+CREATE TABLE IF NOT EXISTS user_totps (
+    user_id integer PRIMARY KEY,
+    secret text,
+    confirmed_at datetime,
+    last_step integer NOT NULL DEFAULT 0,
+    created_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    code_hash text,
+    used_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_code_hash ON recovery_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
@@ -0,0 +1,72 @@
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMissing  = errors.New("If-Match header is required")
+	ErrMismatch = errors.New("resource was modified by another request")
+)
+
+// Format возвращает значение ETag для версии записи
+func Format(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+func Set(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", Format(version))
+}
+
+// Check сверяет заголовок If-Match с текущей версией записи (RFC 9110, 13.1.1).
+// Подходит "*" или список ETag, в котором есть текущая версия.
+// Check вызывают для существующей записи, поэтому "*" всегда проходит
+func Check(r *http.Request, version int) error {
+	header := strings.TrimSpace(strings.Join(r.Header.Values("If-Match"), ","))
+	if header == "" {
+		return ErrMissing
+	}
+
+	if header == "*" {
+		return nil
+	}
+
+	current := Format(version)
+	for _, tag := range parseList(header) {
+		if tag == current {
+			return nil
+		}
+	}
+
+	return ErrMismatch
+}
+
+// parseList разбирает список ETag через запятую. Слабые ETag сравниваем так же, как сильные:
+// версия одна на всё представление, поэтому префикс W/ отбрасывается.
+// Разбор останавливается на первом некорректном элементе
+func parseList(header string) []string {
+	var tags []string
+
+	for {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			return tags
+		}
+
+		header = strings.TrimPrefix(header, "W/")
+		if !strings.HasPrefix(header, `"`) {
+			return tags
+		}
+
+		end := strings.IndexByte(header[1:], '"')
+		if end < 0 {
+			return tags
+		}
+
+		tags = append(tags, header[:end+2])
+		header = header[end+2:]
+	}
+}
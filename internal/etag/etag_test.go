@@ -0,0 +1,100 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		ifMatch  string
+		expected error
+	}{
+		{
+			name:     "missing header",
+			ifMatch:  "",
+			expected: ErrMissing,
+		},
+		{
+			name:     "matching version",
+			ifMatch:  `"3"`,
+			expected: nil,
+		},
+		{
+			name:     "weak matching version",
+			ifMatch:  `W/"3"`,
+			expected: nil,
+		},
+		{
+			name:     "stale version",
+			ifMatch:  `"2"`,
+			expected: ErrMismatch,
+		},
+		{
+			name:     "any version",
+			ifMatch:  `*`,
+			expected: nil,
+		},
+		{
+			name:     "list with matching version",
+			ifMatch:  `"1", "3"`,
+			expected: nil,
+		},
+		{
+			name:     "list with weak matching version",
+			ifMatch:  `"1",W/"3"`,
+			expected: nil,
+		},
+		{
+			name:     "list with stale versions",
+			ifMatch:  `"1", W/"2"`,
+			expected: ErrMismatch,
+		},
+		{
+			name:     "list with comma inside tag",
+			ifMatch:  `"1,3", "2"`,
+			expected: ErrMismatch,
+		},
+		{
+			name:     "unquoted version",
+			ifMatch:  `3`,
+			expected: ErrMismatch,
+		},
+		{
+			name:     "malformed list",
+			ifMatch:  `"1", 3, "3"`,
+			expected: ErrMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			assert.Equal(t, tt.expected, Check(req, 3))
+		})
+	}
+}
+
+func TestCheck_SeveralHeaders(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "/", nil)
+	req.Header.Add("If-Match", `"1"`)
+	req.Header.Add("If-Match", `"3"`)
+
+	assert.NoError(t, Check(req, 3))
+}
+
+func TestSet(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	Set(rr, 7)
+
+	assert.Equal(t, `"7"`, rr.Header().Get("ETag"))
+}
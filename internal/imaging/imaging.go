@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// Регистрация декодеров для image.Decode
+	_ "image/gif"
+)
+
+const jpegQuality = 85
+
+// Fit уменьшает изображение так, чтобы большая сторона не превышала maxSide.
+// Изображения меньше maxSide возвращаются без изменений.
+func Fit(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= maxSide && height <= maxSide {
+		return src
+	}
+
+	if width >= height {
+		height = height * maxSide / width
+		width = maxSide
+	} else {
+		width = width * maxSide / height
+		height = maxSide
+	}
+
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	return Resize(src, width, height)
+}
+
+// Resize масштабирует изображение усреднением по площади (box filter),
+// что даёт приемлемое качество при уменьшении без сторонних библиотек
+func Resize(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	srcWidth, srcHeight := b.Dx(), b.Dy()
+
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, srcHeight, height)
+
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, srcWidth, width)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(rgba.Pix[offset])
+					g += uint64(rgba.Pix[offset+1])
+					bl += uint64(rgba.Pix[offset+2])
+					a += uint64(rgba.Pix[offset+3])
+					n++
+					offset += 4
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(bl / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// span возвращает диапазон исходных пикселей, попадающих в пиксель i результата
+func span(i, srcSize, dstSize int) (int, int) {
+	from := i * srcSize / dstSize
+	to := (i + 1) * srcSize / dstSize
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// Encode кодирует изображение в JPEG, если исходник был JPEG, иначе в PNG.
+// Возвращает Content-Type результата.
+func Encode(w io.Writer, img image.Image, contentType string) (string, error) {
+	if contentType == "image/jpeg" {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return "image/png", png.Encode(w, img)
+}
@@ -0,0 +1,49 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	resized := Fit(src, 100)
+	assert.Equal(t, 100, resized.Bounds().Dx())
+	assert.Equal(t, 50, resized.Bounds().Dy())
+
+	small := Fit(src, 1000)
+	assert.Equal(t, src, small, "Изображение меньше ограничения не должно увеличиваться")
+}
+
+func TestResize_AveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 200, A: 255})
+	src.Set(1, 0, color.RGBA{R: 100, A: 255})
+
+	dst := Resize(src, 1, 1)
+
+	assert.Equal(t, color.RGBA{R: 150, A: 255}, dst.RGBAAt(0, 0))
+}
+
+func TestEncode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+
+	var buf bytes.Buffer
+	contentType, err := Encode(&buf, img, "image/jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+
+	buf.Reset()
+	contentType, err = Encode(&buf, img, "image/gif")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+
+	_, format, err := image.Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "png", format)
+}
@@ -0,0 +1,363 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrTestFailed = errors.New("patch test operation failed")
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// MergePatch применяет JSON Merge Patch (RFC 7396) к документу
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target, patchValue interface{}
+
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(patch, &patchValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %v", err)
+	}
+
+	return json.Marshal(merge(target, patchValue))
+}
+
+func merge(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = merge(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// Apply применяет JSON Patch (RFC 6902) к документу. Операции выполняются
+// по порядку; при ошибке любой из них документ не меняется.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	var operations []operation
+
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json patch: %v", err)
+	}
+
+	for i, op := range operations {
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(doc interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New("path is required")
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value is required")
+		}
+
+		var value interface{}
+		err = json.Unmarshal(*op.Value, &value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		return remove(doc, path)
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("from is required")
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			value, err = deepCopy(value)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+
+		if len(path) > len(from) && isPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+
+		doc, err = remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	}
+
+	return nil, fmt.Errorf("unknown operation: %s", op.Op)
+}
+
+// parsePointer разбирает JSON Pointer (RFC 6901) на токены
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer: %s", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex разбирает индекс массива; size - максимально допустимое значение плюс один
+func arrayIndex(token string, size int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index: %s", token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= size {
+		return 0, fmt.Errorf("array index out of range: %s", token)
+	}
+
+	return index, nil
+}
+
+// update спускается по пути до родителя целевого элемента и передаёт его в leaf.
+// leaf возвращает изменённый контейнер, который записывается обратно в дерево.
+func update(node interface{}, path []string, leaf func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return leaf(node, path[0])
+	}
+
+	token := path[0]
+
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("path not found: %s", token)
+		}
+
+		child, err := update(child, path[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = child
+		return container, nil
+
+	case []interface{}:
+		index, err := arrayIndex(token, len(container))
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := update(container[index], path[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = child
+		return container, nil
+	}
+
+	return nil, fmt.Errorf("path not found: %s", token)
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	node := doc
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			child, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			node = child
+
+		case []interface{}:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			node = container[index]
+
+		default:
+			return nil, fmt.Errorf("path not found: %s", token)
+		}
+	}
+	return node, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(node interface{}, token string) (interface{}, error) {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+
+		case []interface{}:
+			if token == "-" {
+				return append(container, value), nil
+			}
+
+			index, err := arrayIndex(token, len(container)+1)
+			if err != nil {
+				return nil, err
+			}
+
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+
+		return nil, fmt.Errorf("path not found: %s", token)
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+
+	return update(doc, path, func(node interface{}, token string) (interface{}, error) {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			delete(container, token)
+			return container, nil
+
+		case []interface{}:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:index], container[index+1:]...), nil
+		}
+
+		return nil, fmt.Errorf("path not found: %s", token)
+	})
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(node interface{}, token string) (interface{}, error) {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			container[token] = value
+			return container, nil
+
+		case []interface{}:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container[index] = value
+			return container, nil
+		}
+
+		return nil, fmt.Errorf("path not found: %s", token)
+	})
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied interface{}
+	err = json.Unmarshal(data, &copied)
+	return copied, err
+}
@@ -0,0 +1,161 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "replace value",
+			doc:      `{"a":"b"}`,
+			patch:    `{"a":"c"}`,
+			expected: `{"a":"c"}`,
+		},
+		{
+			name:     "null removes key",
+			doc:      `{"a":"b","b":"c"}`,
+			patch:    `{"a":null}`,
+			expected: `{"b":"c"}`,
+		},
+		{
+			name:     "nested objects are merged",
+			doc:      `{"a":{"b":"c","d":"e"}}`,
+			patch:    `{"a":{"d":null,"f":"g"}}`,
+			expected: `{"a":{"b":"c","f":"g"}}`,
+		},
+		{
+			name:     "arrays are replaced",
+			doc:      `{"a":[1,2]}`,
+			patch:    `{"a":[3]}`,
+			expected: `{"a":[3]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "add object member",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux"}]`,
+			expected: `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:     "insert into array",
+			doc:      `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			expected: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:     "append to array",
+			doc:      `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/-","value":"baz"}]`,
+			expected: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "remove array element",
+			doc:      `{"foo":["bar","qux","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/1"}]`,
+			expected: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "replace value",
+			doc:      `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			expected: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:     "move value",
+			doc:      `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:    `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:     "copy value",
+			doc:      `{"a":{"b":1}}`,
+			patch:    `[{"op":"copy","from":"/a","path":"/c"}]`,
+			expected: `{"a":{"b":1},"c":{"b":1}}`,
+		},
+		{
+			name:     "escaped pointer",
+			doc:      `{"a/b":1,"m~n":2}`,
+			patch:    `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`,
+			expected: `{"a/b":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{
+			name:  "failed test",
+			doc:   `{"baz":"qux"}`,
+			patch: `[{"op":"test","path":"/baz","value":"bar"}]`,
+		},
+		{
+			name:  "missing path",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":1}]`,
+		},
+		{
+			name:  "index out of range",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/5","value":1}]`,
+		},
+		{
+			name:  "leading zero index",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/01"}]`,
+		},
+		{
+			name:  "move into child",
+			doc:   `{"a":{"b":{}}}`,
+			patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+		},
+		{
+			name:  "unknown operation",
+			doc:   `{}`,
+			patch: `[{"op":"merge","path":"/a","value":1}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultWindow - через сколько без новых неудач счётчик забывается, если блокировка выключена
+const defaultWindow = 15 * time.Minute
+
+// Policy - ограничения неудачных попыток для одного ключа. Начиная с BackoffAfter неудач
+// каждая следующая попытка откладывается на BaseDelay, удваиваясь до MaxDelay; после LockAfter
+// неудач ключ блокируется на LockDuration. Нулевые BackoffAfter и LockAfter выключают ограничение
+type Policy struct {
+	BackoffAfter int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockAfter    int
+	LockDuration time.Duration
+}
+
+// Status - состояние ключа: сколько подряд неудач и сколько ждать до следующей попытки
+type Status struct {
+	Failures   int
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+// Blocked сообщает, что попытку сейчас делать нельзя
+func (s Status) Blocked() bool {
+	return s.RetryAfter > 0
+}
+
+// Tracker считает неудачные попытки по ключу. Реализация в памяти процесса годится
+// для одного узла; для нескольких узлов её можно заменить общей, например в Redis
+type Tracker interface {
+	Status(ctx context.Context, key string) (Status, error)
+	Fail(ctx context.Context, key string) (Status, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type entry struct {
+	failures     int
+	last         time.Time
+	blockedUntil time.Time
+	locked       bool
+}
+
+// MemoryTracker хранит счётчики в памяти процесса
+type MemoryTracker struct {
+	mu        sync.Mutex
+	policy    Policy
+	entries   map[string]*entry
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewMemoryTracker(policy Policy) *MemoryTracker {
+	return &MemoryTracker{
+		policy:  policy,
+		entries: map[string]*entry{},
+		now:     time.Now,
+	}
+}
+
+func (t *MemoryTracker) Status(ctx context.Context, key string) (Status, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.entry(key, t.now())
+	if e == nil {
+		return Status{}, nil
+	}
+
+	return t.status(e, t.now()), nil
+}
+
+// Fail учитывает неудачную попытку и возвращает новое состояние ключа
+func (t *MemoryTracker) Fail(ctx context.Context, key string) (Status, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+
+	e := t.entry(key, now)
+	if e == nil {
+		e = &entry{}
+		t.entries[key] = e
+	}
+
+	e.failures++
+	e.last = now
+
+	switch {
+	case t.policy.LockAfter > 0 && e.failures >= t.policy.LockAfter:
+		e.locked = true
+		e.blockedUntil = now.Add(t.policy.LockDuration)
+	case t.policy.BackoffAfter > 0 && e.failures >= t.policy.BackoffAfter:
+		e.blockedUntil = now.Add(t.delay(e.failures))
+	}
+
+	return t.status(e, now), nil
+}
+
+func (t *MemoryTracker) Reset(ctx context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, key)
+
+	return nil
+}
+
+// delay - задержка после failures неудач: BaseDelay, 2*BaseDelay, 4*BaseDelay... но не больше MaxDelay
+func (t *MemoryTracker) delay(failures int) time.Duration {
+	delay := t.policy.BaseDelay
+	for i := t.policy.BackoffAfter; i < failures; i++ {
+		delay *= 2
+		if delay >= t.policy.MaxDelay {
+			return t.policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (t *MemoryTracker) status(e *entry, now time.Time) Status {
+	status := Status{Failures: e.failures}
+	if now.Before(e.blockedUntil) {
+		status.RetryAfter = e.blockedUntil.Sub(now)
+		status.Locked = e.locked
+	}
+	return status
+}
+
+// entry возвращает живую запись ключа. Истёкшая блокировка и давние неудачи забываются:
+// после блокировки счёт начинается заново
+func (t *MemoryTracker) entry(key string, now time.Time) *entry {
+	e, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if t.expired(e, now) {
+		delete(t.entries, key)
+		return nil
+	}
+
+	return e
+}
+
+func (t *MemoryTracker) expired(e *entry, now time.Time) bool {
+	if e.locked {
+		return !now.Before(e.blockedUntil)
+	}
+	return now.Sub(e.last) >= t.window()
+}
+
+func (t *MemoryTracker) window() time.Duration {
+	window := defaultWindow
+	if t.policy.LockDuration > window {
+		window = t.policy.LockDuration
+	}
+	if t.policy.MaxDelay > window {
+		window = t.policy.MaxDelay
+	}
+	return window
+}
+
+// prune удаляет забытые записи не чаще раза за окно, чтобы перебор ключей
+// с разных адресов не раздувал память
+func (t *MemoryTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.window() {
+		return
+	}
+	t.lastPrune = now
+
+	for key, e := range t.entries {
+		if t.expired(e, now) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// Guard ограничивает попытки входа сразу по имени пользователя и по IP-адресу:
+// первое защищает учётную запись от подбора пароля, второе - от перебора множества учётных записей
+type Guard struct {
+	users Tracker
+	ips   Tracker
+}
+
+func NewGuard(users Tracker, ips Tracker) *Guard {
+	return &Guard{
+		users: users,
+		ips:   ips,
+	}
+}
+
+// Check возвращает самое долгое из ограничений по имени и по адресу
+func (g *Guard) Check(ctx context.Context, username string, ip string) (Status, error) {
+	user, err := g.users.Status(ctx, userKey(username))
+	if err != nil {
+		return Status{}, err
+	}
+
+	if ip == "" {
+		return user, nil
+	}
+
+	address, err := g.ips.Status(ctx, ipKey(ip))
+	if err != nil {
+		return Status{}, err
+	}
+
+	return merge(user, address), nil
+}
+
+// Fail учитывает неудачу по имени и по адресу и возвращает состояние каждого ключа:
+// блокировка учётной записи и блокировка адреса - разные события
+func (g *Guard) Fail(ctx context.Context, username string, ip string) (user Status, address Status, err error) {
+	user, err = g.users.Fail(ctx, userKey(username))
+	if err != nil {
+		return Status{}, Status{}, err
+	}
+
+	if ip == "" {
+		return user, Status{}, nil
+	}
+
+	address, err = g.ips.Fail(ctx, ipKey(ip))
+	if err != nil {
+		return Status{}, Status{}, err
+	}
+
+	return user, address, nil
+}
+
+// Unlock сбрасывает счётчик пользователя: после успешного входа, сброса пароля или администратором.
+// Счётчик адреса не сбрасывается, иначе вход в свою учётную запись обнулял бы перебор чужих
+func (g *Guard) Unlock(ctx context.Context, username string) error {
+	return g.users.Reset(ctx, userKey(username))
+}
+
+func merge(user Status, address Status) Status {
+	status := user
+	if address.RetryAfter > status.RetryAfter {
+		status.RetryAfter = address.RetryAfter
+	}
+	status.Locked = status.Locked || address.Locked
+	return status
+}
+
+func userKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
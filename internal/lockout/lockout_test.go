@@ -0,0 +1,134 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTracker(policy Policy) (*MemoryTracker, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tracker := NewMemoryTracker(policy)
+	tracker.now = c.Now
+	return tracker, c
+}
+
+var testPolicy = Policy{
+	BackoffAfter: 2,
+	BaseDelay:    time.Second,
+	MaxDelay:     5 * time.Second,
+	LockAfter:    6,
+	LockDuration: time.Minute,
+}
+
+func TestMemoryTracker_Backoff(t *testing.T) {
+	tracker, _ := newTracker(testPolicy)
+	ctx := context.Background()
+
+	status, err := tracker.Fail(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, status.Blocked(), "Первая неудача не задерживает")
+
+	var delays []time.Duration
+	for i := 0; i < 4; i++ {
+		status, err = tracker.Fail(ctx, "k")
+		require.NoError(t, err)
+		delays = append(delays, status.RetryAfter)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}, delays)
+	assert.False(t, status.Locked)
+
+	other, err := tracker.Status(ctx, "other")
+	require.NoError(t, err)
+	assert.Equal(t, Status{}, other)
+}
+
+func TestMemoryTracker_Lockout(t *testing.T) {
+	tracker, c := newTracker(testPolicy)
+	ctx := context.Background()
+
+	var status Status
+	for i := 0; i < testPolicy.LockAfter; i++ {
+		var err error
+		status, err = tracker.Fail(ctx, "k")
+		require.NoError(t, err)
+	}
+	assert.True(t, status.Locked)
+	assert.Equal(t, time.Minute, status.RetryAfter)
+
+	c.now = c.now.Add(59 * time.Second)
+	status, err := tracker.Status(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, status.RetryAfter)
+
+	// после блокировки счёт начинается заново
+	c.now = c.now.Add(time.Second)
+	status, err = tracker.Status(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, Status{}, status)
+}
+
+func TestMemoryTracker_ForgetsOldFailures(t *testing.T) {
+	tracker, c := newTracker(testPolicy)
+	ctx := context.Background()
+
+	_, err := tracker.Fail(ctx, "k")
+	require.NoError(t, err)
+
+	c.now = c.now.Add(defaultWindow)
+	status, err := tracker.Fail(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.Failures)
+
+	require.NoError(t, tracker.Reset(ctx, "k"))
+	status, err = tracker.Status(ctx, "k")
+	require.NoError(t, err)
+	assert.Zero(t, status.Failures)
+}
+
+func TestGuard(t *testing.T) {
+	users, _ := newTracker(testPolicy)
+	ips, _ := newTracker(Policy{LockAfter: 3, LockDuration: time.Hour})
+	guard := NewGuard(users, ips)
+	ctx := context.Background()
+
+	// перебор разных имён с одного адреса блокирует адрес
+	for _, username := range []string{"alice", "bob", "carol"} {
+		_, _, err := guard.Fail(ctx, username, "10.0.0.1")
+		require.NoError(t, err)
+	}
+
+	status, err := guard.Check(ctx, "dave", "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, status.Locked)
+	assert.Equal(t, time.Hour, status.RetryAfter)
+
+	status, err = guard.Check(ctx, "dave", "10.0.0.2")
+	require.NoError(t, err)
+	assert.False(t, status.Blocked())
+
+	// подбор пароля одного пользователя с разных адресов задерживается по имени
+	_, _, err = guard.Fail(ctx, "erin", "10.0.0.3")
+	require.NoError(t, err)
+	user, address, err := guard.Fail(ctx, "erin", "10.0.0.4")
+	require.NoError(t, err)
+	assert.Equal(t, 2, user.Failures)
+	assert.True(t, user.Blocked())
+	assert.Equal(t, 1, address.Failures)
+
+	require.NoError(t, guard.Unlock(ctx, "erin"))
+	status, err = guard.Check(ctx, "erin", "")
+	require.NoError(t, err)
+	assert.False(t, status.Blocked())
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// FileMailer складывает письма в каталог файлами .eml, которые открывает любой почтовый клиент
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+func NewFileMailer(from string, dir string) *FileMailer {
+	return &FileMailer{
+		from: from,
+		dir:  dir,
+	}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+
+	data, err := Format(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Время в имени файла упорядочивает письма, случайный суффикс не даёт им перезаписать друг друга
+	f, err := os.CreateTemp(m.dir, now.Format("20060102-150405")+"-*.eml")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
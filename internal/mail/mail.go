@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+)
+
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+// Message - текстовое письмо одному получателю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - интерфейс отправки писем
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создаёт отправителя по настройкам: smtp для боевого окружения,
+// file и log - чтобы читать письма локально без почтового сервера
+func New(cfg config.Mail, logger *zap.Logger) (Mailer, error) {
+	switch cfg.Driver {
+	case config.MailSMTP:
+		return NewSMTPMailer(cfg.From, cfg.SMTP), nil
+	case config.MailFile:
+		return NewFileMailer(cfg.From, cfg.Dir), nil
+	case config.MailLog:
+		return NewLogMailer(logger), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %q", cfg.Driver)
+	}
+}
+
+// Format собирает письмо в формате RFC 5322. Тема кодируется по RFC 2047,
+// тело - quoted-printable, поэтому кириллица доходит без искажений
+func Format(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\n", "\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	_, err := w.Write([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// LogMailer пишет письма в журнал вместо отправки. Ссылки из писем остаются в журнале,
+// поэтому он подходит только для локальной разработки
+type LogMailer struct {
+	logger *zap.Logger
+}
+
+func NewLogMailer(logger *zap.Logger) *LogMailer {
+	return &LogMailer{
+		logger: logger,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Info("mail",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	data, err := Format("shop@example.com", Message{
+		To:      "alice@example.com",
+		Subject: "Подтвердите адрес",
+		Body:    "Здравствуйте!\nСсылка: https://example.com/verify?token=abc",
+	}, date)
+	require.NoError(t, err)
+
+	parsed, err := netmail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Подтвердите адрес", subject)
+	assert.Equal(t, "alice@example.com", parsed.Header.Get("To"))
+	assert.Equal(t, "quoted-printable", parsed.Header.Get("Content-Transfer-Encoding"))
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "Здравствуйте!\r\nСсылка: https://example.com/verify?token=abc", string(body))
+}
+
+func TestFormat_RejectsHeaderInjection(t *testing.T) {
+	_, err := Format("shop@example.com", Message{
+		To:      "alice@example.com\r\nBcc: everyone@example.com",
+		Subject: "hello",
+	}, time.Now())
+
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := NewFileMailer("shop@example.com", dir)
+
+	require.NoError(t, mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "first", Body: "one"}))
+	require.NoError(t, mailer.Send(context.Background(), Message{To: "bob@example.com", Subject: "second", Body: "two"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	parsed, err := netmail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "shop@example.com", parsed.Header.Get("From"))
+}
+
+func TestSMTPMailer_CanceledContext(t *testing.T) {
+	mailer := NewSMTPMailer("shop@example.com", config.SMTP{Host: "127.0.0.1", Port: "1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := mailer.Send(ctx, Message{To: "alice@example.com", Subject: "hello"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.Default().Mail
+
+	mailer, err := New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &LogMailer{}, mailer)
+
+	cfg.Driver = config.MailFile
+	mailer, err = New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &FileMailer{}, mailer)
+
+	cfg.Driver = config.MailSMTP
+	mailer, err = New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, mailer)
+
+	cfg.Driver = "pigeon"
+	_, err = New(cfg, zap.NewNop())
+	assert.Error(t, err)
+}
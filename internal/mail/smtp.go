@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+)
+
+// SMTPMailer отправляет письма через SMTP-сервер. Если сервер поддерживает STARTTLS,
+// соединение шифруется; пароль передаётся только по зашифрованному соединению
+type SMTPMailer struct {
+	from string
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(from string, cfg config.SMTP) *SMTPMailer {
+	m := &SMTPMailer{
+		from: from,
+		addr: net.JoinHostPort(cfg.Host, cfg.Port),
+	}
+
+	if cfg.User != "" {
+		m.auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)
+	}
+
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := Format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// net/smtp не принимает контекст, поэтому отмену проверяем хотя бы перед отправкой
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+}
@@ -0,0 +1,147 @@
+package memdb
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+var (
+	ErrDuplicate  = errors.New("duplicate key value violates unique constraint")
+	ErrForeignKey = errors.New("violates foreign key constraint")
+)
+
+// DB - общее хранилище in-memory репозиториев. Таблицы разделяются между модулями,
+// как в одной базе: заказы резервируют питомцев, категории считают своих питомцев и т.д.
+// Ассоциации хранятся только ключами, репозитории собирают модели сами.
+// Все обращения к таблицам выполняются под мьютексом DB
+type DB struct {
+	sync.RWMutex
+
+	Users         map[int]models.User
+	RefreshTokens map[int]models.RefreshToken
+	RevokedTokens map[string]models.RevokedToken
+	UserTokens    map[int]models.UserToken
+	TOTPs         map[int]models.UserTOTP
+	RecoveryCodes map[int]models.RecoveryCode
+	APIKeys       map[int]models.APIKey
+	Categories    map[int]models.Category
+	Tags          map[int]models.Tag
+	Pets          map[int]models.Pet
+	PetTags       map[int][]int
+	Photos        map[int]models.PhotoUrl
+	Variants      map[int]models.PhotoVariant
+	Orders        map[int]models.Order
+	Transitions   map[int]models.OrderTransition
+
+	sequences map[string]int
+}
+
+func New() *DB {
+	return &DB{
+		Users:         map[int]models.User{},
+		RefreshTokens: map[int]models.RefreshToken{},
+		RevokedTokens: map[string]models.RevokedToken{},
+		UserTokens:    map[int]models.UserToken{},
+		TOTPs:         map[int]models.UserTOTP{},
+		RecoveryCodes: map[int]models.RecoveryCode{},
+		APIKeys:       map[int]models.APIKey{},
+		Categories:    map[int]models.Category{},
+		Tags:          map[int]models.Tag{},
+		Pets:          map[int]models.Pet{},
+		PetTags:       map[int][]int{},
+		Photos:        map[int]models.PhotoUrl{},
+		Variants:      map[int]models.PhotoVariant{},
+		Orders:        map[int]models.Order{},
+		Transitions:   map[int]models.OrderTransition{},
+		sequences:     map[string]int{},
+	}
+}
+
+// NextID выдаёт следующий ID таблицы, как автоинкремент в базе
+func (db *DB) NextID(table string) int {
+	db.sequences[table]++
+	return db.sequences[table]
+}
+
+// Reserve сдвигает последовательность таблицы за явно заданный ID, чтобы NextID его не выдал
+func (db *DB) Reserve(table string, id int) {
+	if db.sequences[table] < id {
+		db.sequences[table] = id
+	}
+}
+
+// IDs возвращает ключи таблицы по возрастанию
+func IDs[V any](table map[int]V) []int {
+	ids := make([]int, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (db *DB) CategoryByName(name string) (models.Category, bool) {
+	for _, id := range IDs(db.Categories) {
+		if db.Categories[id].Name == name {
+			return db.Categories[id], true
+		}
+	}
+	return models.Category{}, false
+}
+
+func (db *DB) TagByName(name string) (models.Tag, bool) {
+	for _, id := range IDs(db.Tags) {
+		if db.Tags[id].Name == name {
+			return db.Tags[id], true
+		}
+	}
+	return models.Tag{}, false
+}
+
+// SaveCategory вставляет категорию: без ID - как новую с уникальным именем,
+// с ID - только если такой ещё нет, как upsert ассоциаций в GORM
+func (db *DB) SaveCategory(category *models.Category) error {
+	if category.ID != 0 {
+		if _, ok := db.Categories[category.ID]; ok {
+			return nil
+		}
+	}
+
+	if _, ok := db.CategoryByName(category.Name); ok {
+		return ErrDuplicate
+	}
+
+	if category.ID == 0 {
+		category.ID = db.NextID("categories")
+	} else {
+		db.Reserve("categories", category.ID)
+	}
+	db.Categories[category.ID] = *category
+
+	return nil
+}
+
+// SaveTag - то же, что SaveCategory, для тегов
+func (db *DB) SaveTag(tag *models.Tag) error {
+	if tag.ID != 0 {
+		if _, ok := db.Tags[tag.ID]; ok {
+			return nil
+		}
+	}
+
+	if _, ok := db.TagByName(tag.Name); ok {
+		return ErrDuplicate
+	}
+
+	if tag.ID == 0 {
+		tag.ID = db.NextID("tags")
+	} else {
+		db.Reserve("tags", tag.ID)
+	}
+	db.Tags[tag.ID] = *tag
+
+	return nil
+}
@@ -1,25 +1,134 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
 	"github.com/lestrrat-go/jwx/jwt"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
 )
 
+// APIKeyHeader - заголовок с API-ключом машинного клиента
+const APIKeyHeader = "api_key"
+
+const (
+	// claimAPIKey - ID ключа в токене, собранном из API-ключа; у пользовательских JWT его нет
+	claimAPIKey = "api_key_id"
+	// claimScope - права API-ключа через пробел
+	claimScope = "scope"
+)
+
+var (
+	ErrTokenRevoked  = errors.New("token is revoked")
+	ErrTokenNoExpiry = errors.New("token has no expiration")
+	ErrAPIKeyInvalid = errors.New("api key is invalid, expired or revoked")
+
+	errInvalidToken = errors.New("invalid or missing token")
+	errPermission   = errors.New("permission error")
+	errScope        = errors.New("api key scope does not allow this request")
+	errSessionOnly  = errors.New("api keys are not accepted here, log in with a password")
+)
+
+// Revoker сообщает, отозван ли access-токен с данным jti
+type Revoker interface {
+	IsRevoked(ctx context.Context, jti string) bool
+}
+
+// APIKeys находит владельца и права API-ключа
+type APIKeys interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (models.APIKeyPrincipal, error)
+}
+
+// Verifier проверяет подпись и срок действия токена, а также сверяет его со списком отозванных.
+// Токен берётся из заголовка Authorization (с префиксом Bearer или без него) или из cookie jwt.
+// Если передан заголовок api_key, вместо JWT проверяется ключ
+func Verifier(tokenAuth *jwtauth.JWTAuth, revoker Revoker, keys APIKeys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(APIKeyHeader); key != "" {
+				token, err := apiKeyToken(r.Context(), keys, key)
+				ctx := jwtauth.NewContext(r.Context(), token, err)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			token, err := jwtauth.VerifyRequest(tokenAuth, r, tokenFromHeader, jwtauth.TokenFromCookie)
+			switch {
+			case err != nil:
+			case token.Expiration().IsZero():
+				// Бессрочные токены, выданные до появления exp, больше не принимаются
+				err = ErrTokenNoExpiry
+			case revoker.IsRevoked(r.Context(), token.JwtID()):
+				err = ErrTokenRevoked
+			}
+
+			ctx := jwtauth.NewContext(r.Context(), token, err)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiKeyToken собирает из ключа токен в памяти с теми же claims, что у пользовательского JWT,
+// поэтому UserUnloggedIn, RequireRole и Username работают для ключей без изменений.
+// Токен не подписывается и никуда не уходит: он живёт только до конца запроса
+func apiKeyToken(ctx context.Context, keys APIKeys, key string) (jwt.Token, error) {
+	principal, err := keys.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	claims := map[string]interface{}{
+		"username":  principal.Username,
+		"role":      principal.Role,
+		claimScope:  strings.Join(principal.Scopes, " "),
+		claimAPIKey: principal.KeyID,
+	}
+	if principal.ExpiresAt != nil {
+		claims[jwt.ExpirationKey] = *principal.ExpiresAt
+	}
+
+	token := jwt.New()
+	for name, value := range claims {
+		err = token.Set(name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+func tokenFromHeader(r *http.Request) string {
+	if token := jwtauth.TokenFromHeader(r); token != "" {
+		return token
+	}
+
+	authorization := strings.TrimSpace(r.Header.Get("Authorization"))
+	if strings.Count(authorization, ".") != 2 {
+		return ""
+	}
+
+	return authorization
+}
+
 func UserUnloggedIn(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username := chi.URLParam(r, "username")
 
 		token, _, err := jwtauth.FromContext(r.Context())
-		if err != nil {
-			http.Error(w, "invalid or missing token", http.StatusForbidden)
+		if err != nil || token == nil {
+			unauthorized(w, errInvalidToken)
 			return
 		}
 
-		if token == nil || jwt.Validate(token, jwt.WithClaimValue("username", username)) != nil {
-			http.Error(w, "permission error", http.StatusForbidden)
+		if jwt.Validate(token, jwt.WithClaimValue("username", username)) != nil {
+			forbidden(w, errPermission)
 			return
 		}
 
@@ -27,16 +136,12 @@ func UserUnloggedIn(next http.Handler) http.Handler {
 	})
 }
 
-func UnloggedInDelete(next http.Handler) http.Handler {
+// UnloggedIn пропускает запрос с любым действующим токеном, проверенным Verifier
+func UnloggedIn(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get("api_key")
-		var tokenString string
-
-		tokenString = apiKey
-
-		token, err := jwt.Parse([]byte(tokenString))
-		if err != nil || jwt.Validate(token) != nil {
-			http.Error(w, "invalid token", http.StatusForbidden)
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err != nil || token == nil {
+			unauthorized(w, errInvalidToken)
 			return
 		}
 
@@ -44,19 +149,155 @@ func UnloggedInDelete(next http.Handler) http.Handler {
 	})
 }
 
-func UnloggedIn(next http.Handler) http.Handler {
+// RequireRole пропускает запрос, только если в проверенном jwtauth.Verifier токене
+// указана одна из перечисленных ролей
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, claims, err := jwtauth.FromContext(r.Context())
+			if err != nil || token == nil || jwt.Validate(token) != nil {
+				unauthorized(w, errInvalidToken)
+				return
+			}
+
+			role, _ := claims["role"].(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			forbidden(w, errPermission)
+		})
+	}
+}
+
+// RequireSelfOrRole пропускает владельца учётной записи из пути или пользователя с одной из ролей
+func RequireSelfOrRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, claims, err := jwtauth.FromContext(r.Context())
+			if err != nil || token == nil || jwt.Validate(token) != nil {
+				unauthorized(w, errInvalidToken)
+				return
+			}
+
+			username, _ := claims["username"].(string)
+			if username != "" && username == chi.URLParam(r, "username") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			role, _ := claims["role"].(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			forbidden(w, errPermission)
+		})
+	}
+}
+
+// APIKeyScopes ограничивает запросы по API-ключу его правами: чтение ресурса требует "<ресурс>:read",
+// остальные методы - "<ресурс>:write". Запросы с пользовательским JWT не ограничиваются
+func APIKeyScopes(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		Authorization := r.Header.Get("Authorization")
+		token, claims, err := jwtauth.FromContext(r.Context())
+		if err != nil || token == nil || !isAPIKey(claims) {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		tokenString := Authorization
+		scopes, _ := claims[claimScope].(string)
+		required := RequiredScope(r)
+		for _, scope := range strings.Fields(scopes) {
+			if scope == required {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		forbidden(w, errScope)
+	})
+}
 
-		token, err := jwt.Parse([]byte(tokenString))
+// RequiredScope - право, которое нужно API-ключу для запроса; ресурс - первый сегмент пути
+func RequiredScope(r *http.Request) string {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
 
-		if err != nil || jwt.Validate(token) != nil {
-			http.Error(w, "invalid token", http.StatusForbidden)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+// SessionOnly закрывает маршрут для API-ключей: ключом нельзя выпустить новый ключ
+// или изменить учётную запись и второй фактор
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		if isAPIKey(claims) {
+			forbidden(w, errSessionOnly)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+func isAPIKey(claims map[string]interface{}) bool {
+	_, ok := claims[claimAPIKey]
+	return ok
+}
+
+// Username возвращает имя пользователя из проверенного jwtauth.Verifier токена
+// или пустую строку, если токена нет или он недействителен
+func Username(ctx context.Context) string {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil || jwt.Validate(token) != nil {
+		return ""
+	}
+
+	username, _ := claims["username"].(string)
+
+	return username
+}
+
+// Role возвращает роль из проверенного jwtauth.Verifier токена
+// или пустую строку, если токена нет или он недействителен
+func Role(ctx context.Context) string {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil || jwt.Validate(token) != nil {
+		return ""
+	}
+
+	role, _ := claims["role"].(string)
+
+	return role
+}
+
+// TokenID возвращает jti и срок действия проверенного токена или пустые значения, если токена нет
+func TokenID(ctx context.Context) (string, time.Time) {
+	token, _, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return "", time.Time{}
+	}
+
+	return token.JwtID(), token.Expiration()
+}
+
+// unauthorized отвечает 401: токена нет или он недействителен
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	_ = responder.WriteProblem(w, responder.NewProblem(http.StatusUnauthorized, responder.CodeUnauthorized, err))
+}
+
+// forbidden отвечает 403: токен действителен, но прав не хватает
+func forbidden(w http.ResponseWriter, err error) {
+	_ = responder.WriteProblem(w, responder.NewProblem(http.StatusForbidden, responder.CodeForbidden, err))
+}
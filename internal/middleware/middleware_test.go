@@ -1,13 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
 	"github.com/stretchr/testify/assert"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
 )
 
 func TestUserUnloggedIn(t *testing.T) {
@@ -21,13 +26,13 @@ func TestUserUnloggedIn(t *testing.T) {
 			name:           "invalid token",
 			username:       "testuser",
 			token:          "invalid-token",
-			expectedStatus: http.StatusForbidden,
+			expectedStatus: http.StatusUnauthorized,
 		},
 		{
 			name:           "missing token",
 			username:       "testuser",
 			token:          "",
-			expectedStatus: http.StatusForbidden,
+			expectedStatus: http.StatusUnauthorized,
 		},
 	}
 
@@ -50,84 +55,435 @@ func TestUserUnloggedIn(t *testing.T) {
 			r.ServeHTTP(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if rr.Code != http.StatusOK {
+				assert.Equal(t, responder.ProblemContentType, rr.Header().Get("Content-Type"))
+			}
 		})
 	}
 }
 
-func TestUnloggedInDelete(t *testing.T) {
+func TestUnloggedIn(t *testing.T) {
 	tests := []struct {
 		name           string
-		apiKey         string
+		authorization  string
 		expectedStatus int
 	}{
 		{
 			name:           "invalid token",
-			apiKey:         "invalid-token",
-			expectedStatus: http.StatusForbidden,
+			authorization:  "invalid-token",
+			expectedStatus: http.StatusUnauthorized,
 		},
 		{
 			name:           "missing token",
-			apiKey:         "",
-			expectedStatus: http.StatusForbidden,
+			authorization:  "",
+			expectedStatus: http.StatusUnauthorized,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Use(UnloggedInDelete)
-			r.Delete("/", func(w http.ResponseWriter, r *http.Request) {
+			r.Use(UnloggedIn)
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if rr.Code != http.StatusOK {
+				assert.Equal(t, responder.ProblemContentType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+type revokedSet map[string]bool
+
+func (s revokedSet) IsRevoked(ctx context.Context, jti string) bool {
+	return s[jti]
+}
+
+func TestVerifier(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	encode := func(claims map[string]interface{}) string {
+		_, tokenString, _ := tokenAuth.Encode(claims)
+		return tokenString
+	}
+	valid := encode(map[string]interface{}{"username": "testuser", "jti": "a", "exp": time.Now().Add(time.Hour).Unix()})
+	revoked := encode(map[string]interface{}{"username": "testuser", "jti": "b", "exp": time.Now().Add(time.Hour).Unix()})
+	expired := encode(map[string]interface{}{"username": "testuser", "jti": "c", "exp": time.Now().Add(-time.Hour).Unix()})
+	endless := encode(map[string]interface{}{"username": "testuser", "jti": "d"})
+
+	tests := []struct {
+		name          string
+		authorization string
+		valid         bool
+	}{
+		{name: "bearer token", authorization: "Bearer " + valid, valid: true},
+		{name: "raw token", authorization: valid, valid: true},
+		{name: "revoked token", authorization: "Bearer " + revoked, valid: false},
+		{name: "expired token", authorization: "Bearer " + expired, valid: false},
+		{name: "token without exp", authorization: "Bearer " + endless, valid: false},
+		{name: "missing token", authorization: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(Verifier(tokenAuth, revokedSet{"b": true}, keySet{}))
+			r.Use(UnloggedIn)
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			req, _ := http.NewRequest("DELETE", "/", nil)
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if tt.valid {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			} else {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+type keySet map[string]models.APIKeyPrincipal
+
+func (s keySet) AuthenticateAPIKey(ctx context.Context, key string) (models.APIKeyPrincipal, error) {
+	principal, ok := s[key]
+	if !ok {
+		return models.APIKeyPrincipal{}, errors.New("unknown key")
+	}
+	return principal, nil
+}
+
+func TestVerifier_APIKey(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	expired := time.Now().Add(-time.Hour)
+	keys := keySet{
+		"psk_valid":   {KeyID: 1, Username: "testuser", Role: models.RoleCustomer, Scopes: []string{models.ScopePetRead}},
+		"psk_expired": {KeyID: 2, Username: "testuser", Role: models.RoleCustomer, ExpiresAt: &expired},
+	}
+
+	tests := []struct {
+		name           string
+		apiKey         string
+		expectedStatus int
+		expectedUser   string
+	}{
+		{name: "valid key", apiKey: "psk_valid", expectedStatus: http.StatusOK, expectedUser: "testuser"},
+		{name: "unknown key", apiKey: "psk_unknown", expectedStatus: http.StatusUnauthorized},
+		{name: "expired key", apiKey: "psk_expired", expectedStatus: http.StatusUnauthorized},
+		{name: "jwt in api_key header", apiKey: "eyJhbGciOiJub25lIn0.eyJ1c2VybmFtZSI6InRlc3R1c2VyIn0.", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var username string
+
+			r := chi.NewRouter()
+			r.Use(Verifier(tokenAuth, revokedSet{}, keys))
+			r.With(RequireRole(models.RoleCustomer)).Get("/", func(w http.ResponseWriter, r *http.Request) {
+				username = Username(r.Context())
+			})
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedUser, username)
+		})
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, userToken, _ := tokenAuth.Encode(map[string]interface{}{"username": "testuser", "exp": time.Now().Add(time.Hour).Unix()})
+	keys := keySet{
+		"psk_reader": {KeyID: 1, Username: "testuser", Scopes: []string{models.ScopePetRead, models.ScopeStoreWrite}},
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		apiKey         string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "read scope", method: "GET", path: "/pet/1", apiKey: "psk_reader", expectedStatus: http.StatusOK},
+		{name: "missing write scope", method: "DELETE", path: "/pet/1", apiKey: "psk_reader", expectedStatus: http.StatusForbidden},
+		{name: "write scope", method: "POST", path: "/store/order", apiKey: "psk_reader", expectedStatus: http.StatusOK},
+		{name: "other resource", method: "GET", path: "/user/testuser", apiKey: "psk_reader", expectedStatus: http.StatusForbidden},
+		{name: "user token is not limited", method: "DELETE", path: "/pet/1", authorization: "Bearer " + userToken, expectedStatus: http.StatusOK},
+		{name: "anonymous request", method: "GET", path: "/user/testuser", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(Verifier(tokenAuth, revokedSet{}, keys))
+			r.Use(APIKeyScopes)
+			r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
 			if tt.apiKey != "" {
-				req.Header.Set("api_key", tt.apiKey)
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
 			}
 
 			rr := httptest.NewRecorder()
 			r.ServeHTTP(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if rr.Code != http.StatusOK {
+				assert.Equal(t, responder.ProblemContentType, rr.Header().Get("Content-Type"))
+			}
 		})
 	}
 }
 
-func TestUnloggedIn(t *testing.T) {
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{method: "GET", path: "/pet/findByStatus", expected: models.ScopePetRead},
+		{method: "HEAD", path: "/category", expected: models.ScopeCategoryRead},
+		{method: "PUT", path: "/user/testuser", expected: models.ScopeUserWrite},
+		{method: "DELETE", path: "/store/order/1", expected: models.ScopeStoreWrite},
+		{method: "POST", path: "/tag/", expected: models.ScopeTagWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			assert.Equal(t, tt.expected, RequiredScope(req))
+		})
+	}
+}
+
+func TestSessionOnly(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, userToken, _ := tokenAuth.Encode(map[string]interface{}{"username": "testuser", "exp": time.Now().Add(time.Hour).Unix()})
+	keys := keySet{
+		"psk_writer": {KeyID: 1, Username: "testuser", Scopes: []string{models.ScopeUserWrite}},
+	}
+
 	tests := []struct {
 		name           string
+		apiKey         string
 		authorization  string
 		expectedStatus int
+	}{
+		{name: "user token", authorization: "Bearer " + userToken, expectedStatus: http.StatusOK},
+		{name: "api key", apiKey: "psk_writer", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(Verifier(tokenAuth, revokedSet{}, keys))
+			r.Use(SessionOnly)
+			r.Post("/user/{username}/api-keys", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("POST", "/user/testuser/api-keys", nil)
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestRequireSelfOrRole(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	tests := []struct {
+		name           string
+		claims         map[string]interface{}
+		expectedStatus int
 	}{
 		{
-			name:           "invalid token",
-			authorization:  "invalid-token",
+			name:           "owner",
+			claims:         map[string]interface{}{"username": "testuser", "role": "customer"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "admin",
+			claims:         map[string]interface{}{"username": "root", "role": "admin"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "another user",
+			claims:         map[string]interface{}{"username": "other", "role": "customer"},
 			expectedStatus: http.StatusForbidden,
 		},
 		{
 			name:           "missing token",
-			authorization:  "",
+			claims:         nil,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(jwtauth.Verifier(tokenAuth))
+			r.With(RequireSelfOrRole("admin")).Get("/{username}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/testuser", nil)
+			if tt.claims != nil {
+				_, tokenString, _ := tokenAuth.Encode(tt.claims)
+				req.Header.Set("Authorization", "Bearer "+tokenString)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	tests := []struct {
+		name           string
+		claims         map[string]interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "allowed role",
+			claims:         map[string]interface{}{"username": "testuser", "role": "staff"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "another allowed role",
+			claims:         map[string]interface{}{"username": "testuser", "role": "admin"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "forbidden role",
+			claims:         map[string]interface{}{"username": "testuser", "role": "customer"},
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name:           "no role claim",
+			claims:         map[string]interface{}{"username": "testuser"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing token",
+			claims:         nil,
+			expectedStatus: http.StatusUnauthorized,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Use(UnloggedIn)
+			r.Use(jwtauth.Verifier(tokenAuth))
+			r.Use(RequireRole("staff", "admin"))
 			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			})
 
 			req, _ := http.NewRequest("GET", "/", nil)
-			if tt.authorization != "" {
-				req.Header.Set("Authorization", tt.authorization)
+			if tt.claims != nil {
+				_, tokenString, _ := tokenAuth.Encode(tt.claims)
+				req.Header.Set("Authorization", "Bearer "+tokenString)
 			}
 
 			rr := httptest.NewRecorder()
 			r.ServeHTTP(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if rr.Code != http.StatusOK {
+				assert.Equal(t, responder.ProblemContentType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestUsername(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"username": "testuser"})
+
+	tests := []struct {
+		name          string
+		authorization string
+		expected      string
+	}{
+		{
+			name:          "valid token",
+			authorization: "Bearer " + tokenString,
+			expected:      "testuser",
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer invalid-token",
+			expected:      "",
+		},
+		{
+			name:          "missing token",
+			authorization: "",
+			expected:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var username string
+
+			r := chi.NewRouter()
+			r.Use(jwtauth.Verifier(tokenAuth))
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				username = Username(r.Context())
+			})
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.expected, username)
 		})
 	}
 }
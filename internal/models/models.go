@@ -1,16 +1,26 @@
 package models
 
+import "time"
+
 type LoginForm struct {
-	Username string `form:"username"`
-	Password string `form:"password"`
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+}
+
+type PageForm struct {
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
+	Sort   string `form:"sort"`
 }
 
 type StatusForm struct {
 	Statuses []string `form:"status"`
+	PageForm
 }
 
 type TagsForm struct {
 	Tags []string `form:"tags"`
+	PageForm
 }
 
 type PetIdForm struct {
@@ -27,25 +37,291 @@ type User struct {
 	Password   string `json:"password"`
 	Phone      string `json:"phone"`
 	UserStatus int    `json:"userStatus"`
+	Role       string `json:"role" gorm:"not null;default:customer"`
+	Version    int    `json:"-" gorm:"not null;default:1"`
+	// EmailVerified - адрес подтверждён по ссылке из письма; без этого вход закрыт
+	EmailVerified bool `json:"emailVerified" gorm:"not null;default:false"`
 }
 
-type Order struct {
+// Роли пользователей: покупатели, сотрудники магазина и администраторы
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+type RoleForm struct {
+	Role string `json:"role"`
+}
+
+type RoleListForm struct {
+	Role string `form:"role"`
+}
+
+// RefreshToken хранит хэш выданного refresh-токена; сам токен на сервере не сохраняется
+type RefreshToken struct {
+	ID        int        `json:"-"`
+	UserID    int        `json:"-" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"-"`
+	RevokedAt *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// Назначение одноразовых токенов из писем
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	// TokenLoginChallenge выдаётся после пароля и обменивается на JWT вместе с кодом второго фактора
+	TokenLoginChallenge = "login_challenge"
+)
+
+// UserToken - одноразовый токен из письма: подтверждение почты или сброс пароля.
+// Как и для refresh-токенов, на сервере хранится только хэш
+type UserToken struct {
+	ID        int        `json:"-"`
+	UserID    int        `json:"-" gorm:"index"`
+	Purpose   string     `json:"-"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	Email     string     `json:"-"`
+	ExpiresAt time.Time  `json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+type TokenForm struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordForm - пользователь указывает имя или адрес почты
+type ForgotPasswordForm struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type ResetPasswordForm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// UserTOTP - секрет TOTP пользователя. Второй фактор включается только после
+// подтверждения кодом; LastStep не даёт принять один и тот же код дважды
+type UserTOTP struct {
+	UserID      int        `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Secret      string     `json:"-"`
+	ConfirmedAt *time.Time `json:"-"`
+	LastStep    int64      `json:"-"`
+	CreatedAt   time.Time  `json:"-"`
+}
+
+// RecoveryCode - одноразовый код восстановления; хранится только хэш
+type RecoveryCode struct {
+	ID       int        `json:"-"`
+	UserID   int        `json:"-" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt   *time.Time `json:"-"`
+}
+
+// TOTPEnrollment - секрет для ввода вручную и ссылка otpauth для QR-кода
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+// RecoveryCodes показываются один раз: при включении второго фактора и при перевыпуске
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type CodeForm struct {
+	Code string `json:"code"`
+}
+
+// LoginChallenge - ответ на вход по паролю, когда включён второй фактор
+type LoginChallenge struct {
+	TwoFactorRequired bool      `json:"twoFactorRequired"`
+	ChallengeToken    string    `json:"challengeToken"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// TwoFactorLoginForm - код из приложения или код восстановления
+type TwoFactorLoginForm struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// Права API-ключей: чтение или изменение ресурса - первого сегмента пути запроса
+const (
+	ScopePetRead       = "pet:read"
+	ScopePetWrite      = "pet:write"
+	ScopeStoreRead     = "store:read"
+	ScopeStoreWrite    = "store:write"
+	ScopeUserRead      = "user:read"
+	ScopeUserWrite     = "user:write"
+	ScopeCategoryRead  = "category:read"
+	ScopeCategoryWrite = "category:write"
+	ScopeTagRead       = "tag:read"
+	ScopeTagWrite      = "tag:write"
+)
+
+var APIKeyScopes = []string{
+	ScopePetRead, ScopePetWrite,
+	ScopeStoreRead, ScopeStoreWrite,
+	ScopeUserRead, ScopeUserWrite,
+	ScopeCategoryRead, ScopeCategoryWrite,
+	ScopeTagRead, ScopeTagWrite,
+}
+
+// APIKey - долгоживущий ключ машинного клиента. Хранится только хэш; Prefix - открытое начало ключа,
+// по которому владелец узнаёт его в списке. Scopes - права через пробел
+type APIKey struct {
+	ID         int        `json:"-"`
+	UserID     int        `json:"-" gorm:"index"`
+	Name       string     `json:"-"`
+	Prefix     string     `json:"-"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     string     `json:"-"`
+	ExpiresAt  *time.Time `json:"-"`
+	LastUsedAt *time.Time `json:"-"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+}
+
+// APIKeyForm - запрос на новый ключ; без ExpiresAt ключ бессрочный
+type APIKeyForm struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// APIKeyInfo - ключ в списке, без самого ключа
+type APIKeyInfo struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// NewAPIKey - только что созданный ключ; Key показывается один раз
+type NewAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// APIKeyPrincipal - владелец и права предъявленного ключа для проверки доступа
+type APIKeyPrincipal struct {
+	KeyID     int
+	Username  string
+	Role      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// RevokedToken - отозванный access-токен; запись нужна только до истечения срока токена
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+type RefreshForm struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenPair struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+type PasswordForm struct {
+	Password string `json:"password"`
+}
+
+// PasswordStrength - оценка пароля по шкале 0-4 и нарушенные требования политики
+type PasswordStrength struct {
+	Score   int             `json:"score"`
+	Label   string          `json:"label"`
+	Entropy float64         `json:"entropy"`
+	Valid   bool            `json:"valid"`
+	Errors  []PasswordError `json:"errors"`
+}
+
+type PasswordError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type UserRole struct {
 	ID       int    `json:"id"`
-	PetID    int    `json:"petId"`
-	Pet      Pet    `gorm:"foreignKey:PetID"`
-	Quantity int    `json:"quantity"`
-	ShipDate string `json:"shipDate"`
-	Status   string `json:"status"`
-	Complete bool   `json:"complete"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type Order struct {
+	ID        int       `json:"id"`
+	PetID     int       `json:"petId"`
+	Pet       Pet       `gorm:"foreignKey:PetID"`
+	Quantity  int       `json:"quantity"`
+	ShipDate  string    `json:"shipDate"`
+	Status    string    `json:"status"`
+	Complete  bool      `json:"complete"`
+	Version   int       `json:"-" gorm:"not null;default:1"`
+	UserID    int       `json:"userId,omitempty" gorm:"index"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 type OrderResponse struct {
-	ID       int    `json:"id"`
-	PetID    int    `json:"petId"`
-	Quantity int    `json:"quantity"`
-	ShipDate string `json:"shipDate"`
-	Status   string `json:"status"`
-	Complete bool   `json:"complete"`
+	ID        int       `json:"id"`
+	PetID     int       `json:"petId"`
+	Quantity  int       `json:"quantity"`
+	ShipDate  string    `json:"shipDate"`
+	Status    string    `json:"status"`
+	Complete  bool      `json:"complete"`
+	Version   int       `json:"-"`
+	UserID    int       `json:"userId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OrderListForm struct {
+	Statuses []string `form:"status"`
+	PetID    int      `form:"petId"`
+	From     string   `form:"from"`
+	To       string   `form:"to"`
+	PageForm
+}
+
+type OrderFilter struct {
+	Statuses []string
+	PetID    int
+	UserID   int
+	From     *time.Time
+	To       *time.Time
+	Desc     bool
+	AfterID  int
+	Limit    int
+}
+
+type OrderPage struct {
+	Orders     []OrderResponse `json:"orders"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+	Total      int64           `json:"total"`
+}
+
+type OrderStatusForm struct {
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+}
+
+type OrderTransition struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"orderId"`
+	FromStatus string    `json:"from"`
+	ToStatus   string    `json:"to"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
 }
 
 type Pet struct {
@@ -56,33 +332,85 @@ type Pet struct {
 	PhotoUrls  []PhotoUrl `json:"-" gorm:"foreignKey:PetReferID"`
 	Tags       []Tag      `json:"tags" gorm:"many2many:pet_tags;constraint:OnDelete:CASCADE"`
 	Status     string     `json:"status"`
+	Version    int        `json:"-" gorm:"not null;default:1"`
 }
 
 type PetJSON struct {
-	ID        int      `json:"id"`
-	Category  Category `json:"category"`
-	Name      string   `json:"name"`
-	PhotoUrls []string `json:"photoUrls"`
-	Tags      []Tag    `json:"tags"`
-	Status    string   `json:"status"`
+	ID        int         `json:"id"`
+	Category  Category    `json:"category"`
+	Name      string      `json:"name"`
+	PhotoUrls []string    `json:"photoUrls"`
+	Photos    []PhotoJSON `json:"photos,omitempty"`
+	Tags      []Tag       `json:"tags"`
+	Status    string      `json:"status"`
+}
+
+type PhotoJSON struct {
+	URL                string         `json:"url"`
+	AdditionalMetadata string         `json:"additionalMetadata,omitempty"`
+	Variants           []PhotoVariant `json:"variants,omitempty"`
 }
 
 type PhotoUrl struct {
-	ID         int    `json:"-"`
-	PhotoUrl   string `json:"photo_url"`
-	PetReferID int    `json:"-"`
+	ID                 int            `json:"-"`
+	PhotoUrl           string         `json:"photo_url"`
+	PetReferID         int            `json:"-"`
+	ObjectKey          string         `json:"-"`
+	ContentType        string         `json:"-"`
+	Size               int64          `json:"-"`
+	AdditionalMetadata string         `json:"-"`
+	Variants           []PhotoVariant `json:"-" gorm:"foreignKey:PhotoID;constraint:OnDelete:CASCADE"`
+}
+
+type PhotoVariant struct {
+	ID          int    `json:"-"`
+	PhotoID     int    `json:"-"`
+	Name        string `json:"name"`
+	PhotoUrl    string `json:"url"`
+	ObjectKey   string `json:"-"`
+	ContentType string `json:"-"`
+	Size        int64  `json:"-"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
 }
 
 type Category struct {
 	ID   int    `json:"id"`
-	Name string `json:"name"`
+	Name string `json:"name" gorm:"uniqueIndex"`
 }
 
 type Tag struct {
 	ID   int    `json:"id"`
+	Name string `json:"name" gorm:"uniqueIndex"`
+}
+
+type NameForm struct {
 	Name string `json:"name"`
 }
 
+type MergeForm struct {
+	TargetID int `json:"targetId"`
+}
+
+type PetFilter struct {
+	Statuses []string
+	Tags     []string
+	Sort     string
+	After    *PetCursor
+	Limit    int
+}
+
+type PetCursor struct {
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type PetPage struct {
+	Pets       []PetJSON `json:"pets"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+	Total      int64     `json:"total"`
+}
+
 type PetsStatuses struct {
 	Available int `json:"available"`
 	Pending   int `json:"pending"`
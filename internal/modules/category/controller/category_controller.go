@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"net/http"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/category/service"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
+)
+
+type Data struct {
+	Message string `json:"message"`
+}
+
+type CategoryResponse struct {
+	Success   bool `json:"success"`
+	ErrorCode int  `json:"error_code,omitempty"`
+	Data      Data `json:"data"`
+}
+
+type Categorer interface {
+	CreateCategory(w http.ResponseWriter, r *http.Request)
+	ListCategories(w http.ResponseWriter, r *http.Request)
+	GetCategory(w http.ResponseWriter, r *http.Request)
+	RenameCategory(w http.ResponseWriter, r *http.Request)
+	MergeCategory(w http.ResponseWriter, r *http.Request)
+	DeleteCategory(w http.ResponseWriter, r *http.Request)
+}
+
+type Category struct {
+	service service.Categorer
+	responder.Responder
+}
+
+func NewCategory(service service.Categorer, responder responder.Responder) *Category {
+	return &Category{
+		service:   service,
+		Responder: responder,
+	}
+}
+
+func (c *Category) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req models.NameForm
+	err := c.service.Decode(r.Body, &req)
+	if err != nil {
+		c.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	category, err := c.service.CreateCategory(r.Context(), req.Name)
+	if err != nil {
+		c.Responder.Error(w, err)
+		return
+	}
+
+	c.OutputJSON(w, category)
+}
+
+func (c *Category) ListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := c.service.ListCategories(r.Context())
+	if err != nil {
+		c.Responder.Error(w, err)
+		return
+	}
+
+	c.OutputJSON(w, categories)
+}
+
+func (c *Category) GetCategory(w http.ResponseWriter, r *http.Request) {
+	id := c.service.URLParam(r, "categoryId")
+
+	category, err := c.service.GetCategory(r.Context(), id)
+	if err != nil {
+		c.Responder.Error(w, err)
+		return
+	}
+
+	c.OutputJSON(w, category)
+}
+
+func (c *Category) RenameCategory(w http.ResponseWriter, r *http.Request) {
+	id := c.service.URLParam(r, "categoryId")
+
+	var req models.NameForm
+	err := c.service.Decode(r.Body, &req)
+	if err != nil {
+		c.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	category, err := c.service.RenameCategory(r.Context(), id, req.Name)
+	if err != nil {
+		c.Responder.Error(w, err)
+		return
+	}
+
+	c.OutputJSON(w, category)
+}
+
+func (c *Category) MergeCategory(w http.ResponseWriter, r *http.Request) {
+	id := c.service.URLParam(r, "categoryId")
+
+	var req models.MergeForm
+	err := c.service.Decode(r.Body, &req)
+	if err != nil {
+		c.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	err = c.service.MergeCategory(r.Context(), id, req.TargetID)
+	if err != nil {
+		c.Responder.Error(w, err)
+		return
+	}
+
+	c.OutputJSON(w, CategoryResponse{
+		Success: true,
+		Data: Data{
+			Message: "category merged successfully",
+		},
+	})
+}
+
+func (c *Category) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id := c.service.URLParam(r, "categoryId")
+
+	err := c.service.DeleteCategory(r.Context(), id, r.URL.Query().Get("reassignTo"))
+	if err != nil {
+		c.Responder.Error(w, err)
+		return
+	}
+
+	c.OutputJSON(w, CategoryResponse{
+		Success: true,
+		Data: Data{
+			Message: "category deleted successfully",
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+// CategoryMemory - CategoryRepository поверх memdb
+type CategoryMemory struct {
+	db *memdb.DB
+}
+
+func NewCategoryMemory(db *memdb.DB) *CategoryMemory {
+	return &CategoryMemory{
+		db: db,
+	}
+}
+
+func (s *CategoryMemory) Create(ctx context.Context, category models.Category) (models.Category, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	category.ID = 0
+	err := s.db.SaveCategory(&category)
+
+	return category, err
+}
+
+func (s *CategoryMemory) GetByID(ctx context.Context, id int) (models.Category, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	category, ok := s.db.Categories[id]
+	if !ok {
+		return models.Category{}, gorm.ErrRecordNotFound
+	}
+
+	return category, nil
+}
+
+func (s *CategoryMemory) GetByName(ctx context.Context, name string) (models.Category, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	category, ok := s.db.CategoryByName(name)
+	if !ok {
+		return models.Category{}, gorm.ErrRecordNotFound
+	}
+
+	return category, nil
+}
+
+func (s *CategoryMemory) List(ctx context.Context) ([]models.Category, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var categories []models.Category
+	for _, id := range memdb.IDs(s.db.Categories) {
+		categories = append(categories, s.db.Categories[id])
+	}
+
+	sort.SliceStable(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+
+	return categories, nil
+}
+
+func (s *CategoryMemory) CountPets(ctx context.Context, category models.Category) (int64, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	return s.countPets(category.ID), nil
+}
+
+func (s *CategoryMemory) Rename(ctx context.Context, category models.Category, name string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, ok := s.db.Categories[category.ID]
+	if !ok {
+		return nil
+	}
+
+	if other, ok := s.db.CategoryByName(name); ok && other.ID != category.ID {
+		return memdb.ErrDuplicate
+	}
+
+	existing.Name = name
+	s.db.Categories[category.ID] = existing
+
+	return nil
+}
+
+// Merge переносит всех питомцев из source в target и удаляет source.
+// Версии перенесённых питомцев растут, чтобы их старые ETag перестали подходить
+func (s *CategoryMemory) Merge(ctx context.Context, source models.Category, target models.Category) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	if _, ok := s.db.Categories[target.ID]; !ok {
+		return memdb.ErrForeignKey
+	}
+
+	for id, pet := range s.db.Pets {
+		if pet.CategoryID == source.ID {
+			pet.CategoryID = target.ID
+			pet.Version++
+			s.db.Pets[id] = pet
+		}
+	}
+
+	delete(s.db.Categories, source.ID)
+
+	return nil
+}
+
+func (s *CategoryMemory) Delete(ctx context.Context, category models.Category) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	// питомцы ссылаются на категорию внешним ключом
+	if s.countPets(category.ID) > 0 {
+		return memdb.ErrForeignKey
+	}
+
+	delete(s.db.Categories, category.ID)
+
+	return nil
+}
+
+func (s *CategoryMemory) countPets(categoryID int) int64 {
+	var count int64
+	for _, pet := range s.db.Pets {
+		if pet.CategoryID == categoryID {
+			count++
+		}
+	}
+	return count
+}
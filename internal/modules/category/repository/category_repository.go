@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+type CategoryRepository interface {
+	Create(ctx context.Context, category models.Category) (models.Category, error)
+
+	GetByID(ctx context.Context, id int) (models.Category, error)
+	GetByName(ctx context.Context, name string) (models.Category, error)
+	List(ctx context.Context) ([]models.Category, error)
+	CountPets(ctx context.Context, category models.Category) (int64, error)
+
+	Rename(ctx context.Context, category models.Category, name string) error
+	Merge(ctx context.Context, source models.Category, target models.Category) error
+
+	Delete(ctx context.Context, category models.Category) error
+}
+
+// ErrCategoryNotFound возвращают GetByID и GetByName; in-memory реализация отдаёт ту же ошибку, что и GORM
+var ErrCategoryNotFound = gorm.ErrRecordNotFound
+
+type CategoryStorage struct {
+	adapter *gorm.DB
+}
+
+func NewCategoryStorage(adapter *gorm.DB) *CategoryStorage {
+	return &CategoryStorage{
+		adapter: adapter,
+	}
+}
+
+func (s *CategoryStorage) Create(ctx context.Context, category models.Category) (models.Category, error) {
+	err := s.adapter.WithContext(ctx).Create(&category).Error
+	return category, err
+}
+
+func (s *CategoryStorage) GetByID(ctx context.Context, id int) (models.Category, error) {
+	var category models.Category
+
+	err := s.adapter.WithContext(ctx).First(&category, id).Error
+
+	return category, err
+}
+
+func (s *CategoryStorage) GetByName(ctx context.Context, name string) (models.Category, error) {
+	var category models.Category
+
+	err := s.adapter.WithContext(ctx).Where("name = ?", name).First(&category).Error
+
+	return category, err
+}
+
+func (s *CategoryStorage) List(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+
+	err := s.adapter.WithContext(ctx).Order("name").Find(&categories).Error
+
+	return categories, err
+}
+
+func (s *CategoryStorage) CountPets(ctx context.Context, category models.Category) (int64, error) {
+	var count int64
+
+	err := s.adapter.WithContext(ctx).
+		Model(&models.Pet{}).
+		Where("category_id = ?", category.ID).
+		Count(&count).Error
+
+	return count, err
+}
+
+func (s *CategoryStorage) Rename(ctx context.Context, category models.Category, name string) error {
+	return s.adapter.WithContext(ctx).Model(&category).Update("name", name).Error
+}
+
+// Merge переносит всех питомцев из source в target и удаляет source.
+// Версии перенесённых питомцев растут, чтобы их старые ETag перестали подходить
+func (s *CategoryStorage) Merge(ctx context.Context, source models.Category, target models.Category) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Pet{}).
+			Where("category_id = ?", source.ID).
+			Updates(map[string]interface{}{
+				"category_id": target.ID,
+				"version":     gorm.Expr("version + 1"),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&source).Error
+	})
+}
+
+func (s *CategoryStorage) Delete(ctx context.Context, category models.Category) error {
+	return s.adapter.WithContext(ctx).Delete(&category).Error
+}
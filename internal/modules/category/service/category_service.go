@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/category/repository"
+)
+
+type Categorer interface {
+	CreateCategory(ctx context.Context, name string) (models.Category, error)
+	GetCategory(ctx context.Context, id string) (models.Category, error)
+	ListCategories(ctx context.Context) ([]models.Category, error)
+	RenameCategory(ctx context.Context, id string, name string) (models.Category, error)
+	MergeCategory(ctx context.Context, id string, targetID int) error
+	DeleteCategory(ctx context.Context, id string, reassignTo string) error
+
+	Decode(r io.ReadCloser, data interface{}) error
+	URLParam(r *http.Request, param string) string
+}
+
+type CategoryService struct {
+	storage repository.CategoryRepository
+}
+
+func NewCategoryService(storage repository.CategoryRepository) *CategoryService {
+	return &CategoryService{
+		storage: storage,
+	}
+}
+
+func (s *CategoryService) Decode(r io.ReadCloser, data interface{}) error {
+	return json.NewDecoder(r).Decode(data)
+}
+
+func (s *CategoryService) URLParam(r *http.Request, param string) string {
+	return chi.URLParam(r, param)
+}
+
+func (s *CategoryService) nameCheck(ctx context.Context, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", apperr.InvalidField("name", "required", "category name is required")
+	}
+
+	_, err := s.storage.GetByName(ctx, name)
+	if err == nil {
+		return "", apperr.Conflict("category_exists", "a category with that name already exists")
+	}
+	if !errors.Is(err, repository.ErrCategoryNotFound) {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func (s *CategoryService) CreateCategory(ctx context.Context, name string) (models.Category, error) {
+	name, err := s.nameCheck(ctx, name)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return s.storage.Create(ctx, models.Category{Name: name})
+}
+
+func (s *CategoryService) GetCategory(ctx context.Context, id string) (models.Category, error) {
+	intId, err := apperr.ParseID("categoryId", id)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	category, err := s.storage.GetByID(ctx, intId)
+	if errors.Is(err, repository.ErrCategoryNotFound) {
+		return models.Category{}, apperr.NotFound("category_not_found", "category with that id does not exist: %v", id)
+	}
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return category, nil
+}
+
+func (s *CategoryService) ListCategories(ctx context.Context) ([]models.Category, error) {
+	categories, err := s.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if categories == nil {
+		categories = []models.Category{}
+	}
+
+	return categories, nil
+}
+
+func (s *CategoryService) RenameCategory(ctx context.Context, id string, name string) (models.Category, error) {
+	category, err := s.GetCategory(ctx, id)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	name, err = s.nameCheck(ctx, name)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	err = s.storage.Rename(ctx, category, name)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	category.Name = name
+	return category, nil
+}
+
+func (s *CategoryService) MergeCategory(ctx context.Context, id string, targetID int) error {
+	source, err := s.GetCategory(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.GetCategory(ctx, strconv.Itoa(targetID))
+	if err != nil {
+		return err
+	}
+
+	if source.ID == target.ID {
+		return apperr.Invalid("merge_into_itself", "cannot merge a category into itself")
+	}
+
+	return s.storage.Merge(ctx, source, target)
+}
+
+// DeleteCategory удаляет категорию. Если на неё ссылаются питомцы, удаление
+// возможно только с переносом их в другую категорию (reassignTo).
+func (s *CategoryService) DeleteCategory(ctx context.Context, id string, reassignTo string) error {
+	category, err := s.GetCategory(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if reassignTo != "" {
+		targetID, err := strconv.Atoi(reassignTo)
+		if err != nil {
+			return apperr.InvalidField("reassignTo", "invalid_id", "invalid reassignTo: %s", reassignTo)
+		}
+		return s.MergeCategory(ctx, id, targetID)
+	}
+
+	count, err := s.storage.CountPets(ctx, category)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return apperr.Conflict("category_in_use", "category is used by %d pets, pass reassignTo to move them", count)
+	}
+
+	return s.storage.Delete(ctx, category)
+}
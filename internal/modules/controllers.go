@@ -1,22 +1,28 @@
 package modules
 
 import (
+	category "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/category/controller"
 	pet "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/controller"
 	store "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/controller"
+	tag "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/tag/controller"
 	user "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/controller"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
 )
 
 type Controllers struct {
-	User  user.Userer
-	Store store.Storer
-	Pet   pet.Peter
+	User     user.Userer
+	Store    store.Storer
+	Pet      pet.Peter
+	Category category.Categorer
+	Tag      tag.Tagger
 }
 
 func NewControllers(services *Services, responder responder.Responder) *Controllers {
 	return &Controllers{
-		User:  user.NewUser(services.User, responder),
-		Store: store.NewStore(services.Store, responder),
-		Pet:   pet.NewPet(services.Pet, responder),
+		User:     user.NewUser(services.User, responder),
+		Store:    store.NewStore(services.Store, responder),
+		Pet:      pet.NewPet(services.Pet, responder),
+		Category: category.NewCategory(services.Category, responder),
+		Tag:      tag.NewTag(services.Tag, responder),
 	}
 }
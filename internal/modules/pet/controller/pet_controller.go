@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/service"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
@@ -18,6 +22,16 @@ type PetResponse struct {
 	Data      Data `json:"data"`
 }
 
+type ImageData struct {
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+type ImageResponse struct {
+	Success bool      `json:"success"`
+	Data    ImageData `json:"data"`
+}
+
 type Peter interface {
 	CreatePet(w http.ResponseWriter, r *http.Request)
 	GetByID(w http.ResponseWriter, r *http.Request)
@@ -26,7 +40,9 @@ type Peter interface {
 	UpdateByPetId(w http.ResponseWriter, r *http.Request)
 	DeleteByPetId(w http.ResponseWriter, r *http.Request)
 	UpdatePet(w http.ResponseWriter, r *http.Request)
+	PatchPet(w http.ResponseWriter, r *http.Request)
 	UploadImage(w http.ResponseWriter, r *http.Request)
+	GetImage(w http.ResponseWriter, r *http.Request)
 }
 
 type Pet struct {
@@ -49,26 +65,20 @@ func (p *Pet) CreatePet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = p.service.StatusCheck(pet.Status)
+	err = p.service.ValidatePet(r.Context(), pet)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
 	dbPet := p.service.PetToDB(pet)
 
-	err = p.service.ExistingPet(r.Context(), dbPet.Name)
-	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
-		return
-	}
-
 	p.service.ExistingCategory(r.Context(), &dbPet)
 	p.service.ExistingTag(r.Context(), &dbPet)
 
 	err = p.service.CreatePet(r.Context(), dbPet)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
@@ -85,11 +95,12 @@ func (p *Pet) GetByID(w http.ResponseWriter, r *http.Request) {
 
 	pet, err := p.service.GetPetByID(r.Context(), id)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
-	p.OutputJSON(w, pet)
+	etag.Set(w, pet.Version)
+	p.OutputJSON(w, p.service.PetFromDB(pet))
 }
 
 func (p *Pet) FindByStatus(w http.ResponseWriter, r *http.Request) {
@@ -101,7 +112,11 @@ func (p *Pet) FindByStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pets, _ := p.service.FindByStatus(r.Context(), query.Statuses)
+	pets, err := p.service.FindByStatus(r.Context(), query)
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
 
 	p.OutputJSON(w, pets)
 }
@@ -115,9 +130,9 @@ func (p *Pet) FindByTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pets, err := p.service.FindByTags(r.Context(), query.Tags)
+	pets, err := p.service.FindByTags(r.Context(), query)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
@@ -129,34 +144,36 @@ func (p *Pet) UpdateByPetId(w http.ResponseWriter, r *http.Request) {
 
 	pet, err := p.service.GetPetByID(r.Context(), id)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
-	form, err := p.service.ValuesFromForm(r)
+	err = etag.Check(r, pet.Version)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.ErrorPrecondition(w, err)
 		return
 	}
 
-	err = p.service.ExistingPet(r.Context(), form.Name)
+	form, err := p.service.ValuesFromForm(r)
 	if err != nil {
 		p.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	err = p.service.StatusCheck(form.Status)
+	err = p.service.ValidatePetUpdate(r.Context(), pet, models.PetJSON{Name: form.Name, Status: form.Status})
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
 	err = p.service.UpdatePet(r.Context(), pet, form)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
+	etag.Set(w, pet.Version+1)
+
 	p.OutputJSON(w, PetResponse{
 		Success: true,
 		Data: Data{
@@ -170,13 +187,19 @@ func (p *Pet) DeleteByPetId(w http.ResponseWriter, r *http.Request) {
 
 	pet, err := p.service.GetPetByID(r.Context(), id)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
+		return
+	}
+
+	err = etag.Check(r, pet.Version)
+	if err != nil {
+		p.Responder.ErrorPrecondition(w, err)
 		return
 	}
 
 	err = p.service.DeletePet(r.Context(), pet)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
@@ -199,33 +222,35 @@ func (p *Pet) UpdatePet(w http.ResponseWriter, r *http.Request) {
 
 	dbPet, err := p.service.GetPetByID(r.Context(), p.service.Itoa(pet.ID))
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
-	updatedPet := p.service.PetToDB(pet)
-
-	err = p.service.ExistingPet(r.Context(), updatedPet.Name)
+	err = etag.Check(r, dbPet.Version)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.ErrorPrecondition(w, err)
 		return
 	}
 
-	err = p.service.StatusCheck(updatedPet.Status)
+	err = p.service.ValidatePetUpdate(r.Context(), dbPet, pet)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
-	// p.service.ExistingCategory(r.Context(), &updatedPet)
+	updatedPet := p.service.PetToDB(pet)
+
+	p.service.ExistingCategory(r.Context(), &updatedPet)
 	p.service.ExistingTag(r.Context(), &updatedPet)
 
 	err = p.service.UpdatePetByModel(r.Context(), dbPet, updatedPet)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
+	etag.Set(w, dbPet.Version+1)
+
 	p.OutputJSON(w, PetResponse{
 		Success: true,
 		Data: Data{
@@ -234,10 +259,62 @@ func (p *Pet) UpdatePet(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (p *Pet) PatchPet(w http.ResponseWriter, r *http.Request) {
+	id := p.service.URLParam(r, "petId")
+
+	dbPet, err := p.service.GetPetByID(r.Context(), id)
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
+
+	err = etag.Check(r, dbPet.Version)
+	if err != nil {
+		p.Responder.ErrorPrecondition(w, err)
+		return
+	}
+
+	patched, err := p.service.ApplyPatch(p.service.PetFromDB(dbPet), r.Header.Get("Content-Type"), r.Body)
+	if errors.Is(err, service.ErrUnsupportedPatch) {
+		p.Responder.ErrorUnsupportedMediaType(w, err)
+		return
+	}
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
+
+	err = p.service.PatchCheck(r.Context(), dbPet, patched)
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
+
+	updatedPet := p.service.PetToDB(patched)
+
+	p.service.ExistingCategory(r.Context(), &updatedPet)
+	p.service.ExistingTag(r.Context(), &updatedPet)
+
+	err = p.service.ReplacePet(r.Context(), dbPet, updatedPet)
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
+
+	dbPet, err = p.service.GetPetByID(r.Context(), id)
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
+
+	etag.Set(w, dbPet.Version)
+	p.OutputJSON(w, p.service.PetFromDB(dbPet))
+}
+
 func (p *Pet) UploadImage(w http.ResponseWriter, r *http.Request) {
 	id := p.service.URLParam(r, "petId")
 
-	fileName, err := p.service.FileFromForm(r)
+	upload, err := p.service.FileFromForm(w, r)
 	if err != nil {
 		p.Responder.ErrorBadRequest(w, err)
 		return
@@ -245,20 +322,39 @@ func (p *Pet) UploadImage(w http.ResponseWriter, r *http.Request) {
 
 	dbPet, err := p.service.GetPetByID(r.Context(), id)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		upload.File.Close()
+		p.Responder.Error(w, err)
 		return
 	}
 
-	err = p.service.AddPetPhotoUrls(r.Context(), dbPet, fileName)
+	photo, err := p.service.AddPetPhoto(r.Context(), dbPet, upload)
 	if err != nil {
-		p.Responder.ErrorBadRequest(w, err)
+		p.Responder.Error(w, err)
 		return
 	}
 
-	p.OutputJSON(w, PetResponse{
+	p.OutputJSON(w, ImageResponse{
 		Success: true,
-		Data: Data{
+		Data: ImageData{
 			Message: "image uploaded successfully",
+			URL:     photo.PhotoUrl,
 		},
 	})
 }
+
+func (p *Pet) GetImage(w http.ResponseWriter, r *http.Request) {
+	id := p.service.URLParam(r, "petId")
+	name := p.service.URLParam(r, "imageName")
+
+	image, err := p.service.GetPetImage(r.Context(), id, name)
+	if err != nil {
+		p.Responder.Error(w, err)
+		return
+	}
+	defer image.Body.Close()
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(image.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, image.Body)
+}
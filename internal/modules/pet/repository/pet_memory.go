@@ -0,0 +1,485 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+// PetMemory - PetRepository поверх memdb, без внешней базы
+type PetMemory struct {
+	db *memdb.DB
+}
+
+func NewPetMemory(db *memdb.DB) *PetMemory {
+	return &PetMemory{
+		db: db,
+	}
+}
+
+func (s *PetMemory) CreatePet(ctx context.Context, pet models.Pet) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	err := s.saveCategory(&pet)
+	if err != nil {
+		return err
+	}
+
+	for i := range pet.Tags {
+		err = s.db.SaveTag(&pet.Tags[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	pet.ID = s.db.NextID("pets")
+	if pet.Version == 0 {
+		pet.Version = 1
+	}
+
+	s.db.PetTags[pet.ID] = tagIDs(pet.Tags)
+	for _, photo := range pet.PhotoUrls {
+		photo.PetReferID = pet.ID
+		s.addPhoto(photo)
+	}
+
+	s.db.Pets[pet.ID] = stripPet(pet)
+
+	return nil
+}
+
+func (s *PetMemory) GetByName(ctx context.Context, name string) (models.Pet, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, id := range memdb.IDs(s.db.Pets) {
+		if pet := s.db.Pets[id]; pet.Name == name {
+			return s.loadPet(pet, true), nil
+		}
+	}
+
+	return models.Pet{}, gorm.ErrRecordNotFound
+}
+
+func (s *PetMemory) GetByID(ctx context.Context, id int) (models.Pet, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	pet, ok := s.db.Pets[id]
+	if !ok {
+		return models.Pet{}, gorm.ErrRecordNotFound
+	}
+
+	return s.loadPet(pet, true), nil
+}
+
+func (s *PetMemory) GetCategoryByName(ctx context.Context, category models.Category) (models.Category, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	existing, ok := s.db.CategoryByName(category.Name)
+	if !ok {
+		return models.Category{}, gorm.ErrRecordNotFound
+	}
+
+	return existing, nil
+}
+
+func (s *PetMemory) GetTagByName(ctx context.Context, tag models.Tag) (models.Tag, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	existing, ok := s.db.TagByName(tag.Name)
+	if !ok {
+		return models.Tag{}, gorm.ErrRecordNotFound
+	}
+
+	return existing, nil
+}
+
+// FindPets возвращает страницу питомцев по фильтру и общее число совпадений без учёта курсора
+func (s *PetMemory) FindPets(ctx context.Context, filter models.PetFilter) ([]models.Pet, int64, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var matched []models.Pet
+	for _, id := range memdb.IDs(s.db.Pets) {
+		pet := s.db.Pets[id]
+		if len(filter.Statuses) > 0 && !contains(filter.Statuses, pet.Status) {
+			continue
+		}
+		if len(filter.Tags) > 0 && !s.hasAllTags(id, filter.Tags) {
+			continue
+		}
+		matched = append(matched, pet)
+	}
+
+	column, desc := petSortColumn(filter.Sort)
+	byName := column != "pets.id"
+
+	// less сравнивает питомцев в порядке выдачи: по имени, если нужно, затем по ID
+	// Сравнение строгое и при обратном порядке: иначе питомец из курсора попадал бы на следующую страницу ещё раз
+	less := func(a, b models.Pet) bool {
+		if byName && a.Name != b.Name {
+			if desc {
+				return a.Name > b.Name
+			}
+			return a.Name < b.Name
+		}
+		if desc {
+			return a.ID > b.ID
+		}
+		return a.ID < b.ID
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+
+	var pets []models.Pet
+	for _, pet := range matched {
+		if filter.After != nil && !less(models.Pet{ID: filter.After.ID, Name: filter.After.Name}, pet) {
+			continue
+		}
+		if filter.Limit > 0 && len(pets) == filter.Limit {
+			break
+		}
+		pets = append(pets, s.loadPet(pet, true))
+	}
+
+	return pets, int64(len(matched)), nil
+}
+
+func (s *PetMemory) UpdatePet(ctx context.Context, pet models.Pet, name string, status string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(pet)
+	if err != nil {
+		return err
+	}
+
+	existing.Name = name
+	existing.Status = status
+	existing.Version = pet.Version + 1
+	s.db.Pets[pet.ID] = existing
+
+	return nil
+}
+
+func (s *PetMemory) DeletePet(ctx context.Context, pet models.Pet) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	_, err := s.lockVersion(pet)
+	if err != nil {
+		return err
+	}
+
+	s.deletePhotos(pet.ID, nil)
+	delete(s.db.PetTags, pet.ID)
+	delete(s.db.Pets, pet.ID)
+
+	return nil
+}
+
+func (s *PetMemory) AddPhotoUrl(ctx context.Context, photo models.PhotoUrl) (models.PhotoUrl, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	if _, ok := s.db.Pets[photo.PetReferID]; !ok {
+		return models.PhotoUrl{}, memdb.ErrForeignKey
+	}
+
+	return s.addPhoto(photo), nil
+}
+
+func (s *PetMemory) GetPhotoByObjectKey(ctx context.Context, petID int, key string) (models.PhotoUrl, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, id := range memdb.IDs(s.db.Photos) {
+		photo := s.db.Photos[id]
+		if photo.PetReferID == petID && photo.ObjectKey == key {
+			return photo, nil
+		}
+	}
+
+	return models.PhotoUrl{}, gorm.ErrRecordNotFound
+}
+
+func (s *PetMemory) AddPhotoVariant(ctx context.Context, variant models.PhotoVariant) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	if _, ok := s.db.Photos[variant.PhotoID]; !ok {
+		return memdb.ErrForeignKey
+	}
+
+	variant.ID = s.db.NextID("photo_variants")
+	s.db.Variants[variant.ID] = variant
+
+	return nil
+}
+
+func (s *PetMemory) GetVariantByObjectKey(ctx context.Context, key string) (models.PhotoVariant, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, id := range memdb.IDs(s.db.Variants) {
+		if s.db.Variants[id].ObjectKey == key {
+			return s.db.Variants[id], nil
+		}
+	}
+
+	return models.PhotoVariant{}, gorm.ErrRecordNotFound
+}
+
+// UpdatePetByModel применяет только заполненные поля updatedPet; категория, теги и фото
+// заменяются, если переданы, а фото с совпадающими URL остаются нетронутыми
+func (s *PetMemory) UpdatePetByModel(ctx context.Context, pet models.Pet, updatedPet models.Pet) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(pet)
+	if err != nil {
+		return err
+	}
+
+	if updatedPet.Category != (models.Category{}) {
+		err = s.saveCategory(&updatedPet)
+		if err != nil {
+			return err
+		}
+		existing.CategoryID = updatedPet.CategoryID
+	}
+
+	if len(updatedPet.Tags) > 0 {
+		for i := range updatedPet.Tags {
+			err = s.db.SaveTag(&updatedPet.Tags[i])
+			if err != nil {
+				return err
+			}
+		}
+		s.db.PetTags[pet.ID] = tagIDs(updatedPet.Tags)
+	}
+
+	if len(updatedPet.PhotoUrls) > 0 {
+		s.replacePhotos(pet.ID, updatedPet.PhotoUrls)
+	}
+
+	if updatedPet.Name != "" {
+		existing.Name = updatedPet.Name
+	}
+	if updatedPet.Status != "" {
+		existing.Status = updatedPet.Status
+	}
+	existing.Version = pet.Version + 1
+	s.db.Pets[pet.ID] = existing
+
+	return nil
+}
+
+// ReplacePet приводит питомца к состоянию updatedPet целиком: пустые теги и фото
+// тоже применяются, а сохранённые фото с совпадающими URL остаются нетронутыми
+func (s *PetMemory) ReplacePet(ctx context.Context, pet models.Pet, updatedPet models.Pet) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(pet)
+	if err != nil {
+		return err
+	}
+
+	err = s.saveCategory(&updatedPet)
+	if err != nil {
+		return err
+	}
+
+	for i := range updatedPet.Tags {
+		err = s.db.SaveTag(&updatedPet.Tags[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	existing.Name = updatedPet.Name
+	existing.Status = updatedPet.Status
+	existing.CategoryID = updatedPet.CategoryID
+	existing.Version = pet.Version + 1
+	s.db.Pets[pet.ID] = existing
+	s.db.PetTags[pet.ID] = tagIDs(updatedPet.Tags)
+
+	s.replacePhotos(pet.ID, updatedPet.PhotoUrls)
+
+	return nil
+}
+
+// replacePhotos приводит фото питомца к списку photos; фото с совпадающими URL остаются нетронутыми
+func (s *PetMemory) replacePhotos(petID int, photos []models.PhotoUrl) {
+	keep := map[string]bool{}
+	for _, photo := range photos {
+		keep[photo.PhotoUrl] = true
+	}
+	existingUrls := s.deletePhotos(petID, keep)
+
+	for _, photo := range photos {
+		if existingUrls[photo.PhotoUrl] {
+			continue
+		}
+
+		photo.PetReferID = petID
+		s.addPhoto(photo)
+		existingUrls[photo.PhotoUrl] = true
+	}
+}
+
+// lockVersion возвращает сохранённого питомца, если его версия совпадает с pet.Version.
+// Вызывается под блокировкой на запись
+func (s *PetMemory) lockVersion(pet models.Pet) (models.Pet, error) {
+	existing, ok := s.db.Pets[pet.ID]
+	if !ok || existing.Version != pet.Version {
+		return models.Pet{}, etag.ErrMismatch
+	}
+
+	return existing, nil
+}
+
+// saveCategory сохраняет категорию питомца при необходимости и проставляет CategoryID
+func (s *PetMemory) saveCategory(pet *models.Pet) error {
+	if pet.Category != (models.Category{}) {
+		err := s.db.SaveCategory(&pet.Category)
+		if err != nil {
+			return err
+		}
+		pet.CategoryID = pet.Category.ID
+	}
+
+	if _, ok := s.db.Categories[pet.CategoryID]; !ok {
+		return memdb.ErrForeignKey
+	}
+
+	return nil
+}
+
+func (s *PetMemory) addPhoto(photo models.PhotoUrl) models.PhotoUrl {
+	variants := photo.Variants
+	photo.Variants = nil
+	photo.ID = s.db.NextID("photo_urls")
+	s.db.Photos[photo.ID] = photo
+
+	for _, variant := range variants {
+		variant.PhotoID = photo.ID
+		variant.ID = s.db.NextID("photo_variants")
+		s.db.Variants[variant.ID] = variant
+	}
+
+	return photo
+}
+
+// deletePhotos удаляет фото питомца вместе с вариантами, кроме тех, чьи URL есть в keep.
+// Возвращает URL оставшихся фото
+func (s *PetMemory) deletePhotos(petID int, keep map[string]bool) map[string]bool {
+	kept := map[string]bool{}
+
+	for id, photo := range s.db.Photos {
+		if photo.PetReferID != petID {
+			continue
+		}
+		if keep[photo.PhotoUrl] {
+			kept[photo.PhotoUrl] = true
+			continue
+		}
+
+		for variantID, variant := range s.db.Variants {
+			if variant.PhotoID == id {
+				delete(s.db.Variants, variantID)
+			}
+		}
+		delete(s.db.Photos, id)
+	}
+
+	return kept
+}
+
+// loadPet собирает питомца с категорией, тегами и, если нужно, фото с вариантами
+func (s *PetMemory) loadPet(pet models.Pet, photos bool) models.Pet {
+	pet.Category = s.db.Categories[pet.CategoryID]
+
+	pet.Tags = nil
+	for _, id := range s.db.PetTags[pet.ID] {
+		pet.Tags = append(pet.Tags, s.db.Tags[id])
+	}
+
+	if !photos {
+		return pet
+	}
+
+	pet.PhotoUrls = nil
+	for _, id := range memdb.IDs(s.db.Photos) {
+		photo := s.db.Photos[id]
+		if photo.PetReferID != pet.ID {
+			continue
+		}
+
+		for _, variantID := range memdb.IDs(s.db.Variants) {
+			if s.db.Variants[variantID].PhotoID == id {
+				photo.Variants = append(photo.Variants, s.db.Variants[variantID])
+			}
+		}
+		pet.PhotoUrls = append(pet.PhotoUrls, photo)
+	}
+
+	return pet
+}
+
+func (s *PetMemory) hasAllTags(petID int, names []string) bool {
+	have := map[string]bool{}
+	for _, id := range s.db.PetTags[petID] {
+		have[s.db.Tags[id].Name] = true
+	}
+
+	for _, name := range names {
+		if !have[name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stripPet оставляет в питомце только собственные поля: ассоциации хранятся в своих таблицах
+func stripPet(pet models.Pet) models.Pet {
+	pet.Category = models.Category{}
+	pet.Tags = nil
+	pet.PhotoUrls = nil
+	return pet
+}
+
+// tagIDs возвращает ID тегов без повторов, по возрастанию
+func tagIDs(tags []models.Tag) []int {
+	seen := map[int]bool{}
+	var ids []int
+	for _, tag := range tags {
+		if !seen[tag.ID] {
+			seen[tag.ID] = true
+			ids = append(ids, tag.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
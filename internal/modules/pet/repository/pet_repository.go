@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 )
 
@@ -12,17 +15,25 @@ type PetRepository interface {
 
 	UpdatePet(ctx context.Context, pet models.Pet, name string, status string) error
 	UpdatePetByModel(ctx context.Context, pet models.Pet, updatedPet models.Pet) error
+	ReplacePet(ctx context.Context, pet models.Pet, updatedPet models.Pet) error
 
-	GetByName(ctx context.Context, name string) error
+	GetByName(ctx context.Context, name string) (models.Pet, error)
 	GetByID(ctx context.Context, id int) (models.Pet, error)
 	GetCategoryByName(ctx context.Context, category models.Category) (models.Category, error)
 	GetTagByName(ctx context.Context, tag models.Tag) (models.Tag, error)
-	GetByStatus(ctx context.Context, status string) ([]models.Pet, error)
-	GetByTags(ctx context.Context, tags []string) ([]models.Pet, error)
+	FindPets(ctx context.Context, filter models.PetFilter) ([]models.Pet, int64, error)
 
 	DeletePet(ctx context.Context, pet models.Pet) error
+
+	AddPhotoUrl(ctx context.Context, photo models.PhotoUrl) (models.PhotoUrl, error)
+	GetPhotoByObjectKey(ctx context.Context, petID int, key string) (models.PhotoUrl, error)
+	AddPhotoVariant(ctx context.Context, variant models.PhotoVariant) error
+	GetVariantByObjectKey(ctx context.Context, key string) (models.PhotoVariant, error)
 }
 
+// ErrPetNotFound возвращают GetByID и GetByName; in-memory реализация отдаёт ту же ошибку, что и GORM
+var ErrPetNotFound = gorm.ErrRecordNotFound
+
 type PetStorage struct {
 	adapter *gorm.DB
 }
@@ -38,20 +49,20 @@ func (s *PetStorage) CreatePet(ctx context.Context, pet models.Pet) error {
 	return result.Error
 }
 
-func (s *PetStorage) GetByName(ctx context.Context, name string) error {
+func (s *PetStorage) GetByName(ctx context.Context, name string) (models.Pet, error) {
 	var existingPet models.Pet
 
-	err := s.adapter.WithContext(ctx).Where(&models.Pet{
+	err := s.adapter.WithContext(ctx).Preload("Category").Preload("Tags").Preload("PhotoUrls.Variants").Where(&models.Pet{
 		Name: name,
 	}).First(&existingPet).Error
 
-	return err
+	return existingPet, err
 }
 
 func (s *PetStorage) GetByID(ctx context.Context, id int) (models.Pet, error) {
 	var existingPet models.Pet
 
-	err := s.adapter.WithContext(ctx).Preload("Category").Preload("Tags").Preload("PhotoUrls").Where(&models.Pet{
+	err := s.adapter.WithContext(ctx).Preload("Category").Preload("Tags").Preload("PhotoUrls.Variants").Where(&models.Pet{
 		ID: id,
 	}).First(&existingPet).Error
 
@@ -78,81 +89,185 @@ func (s *PetStorage) GetTagByName(ctx context.Context, tag models.Tag) (models.T
 	return existingTag, err
 }
 
-func (s *PetStorage) GetByStatus(ctx context.Context, status string) ([]models.Pet, error) {
+// withAllTags оставляет питомцев, у которых есть все теги из tags. Подзапрос вместо
+// GROUP BY по pets.* одинаково работает в Postgres и SQLite
+func (s *PetStorage) withAllTags(query *gorm.DB, tags []string) *gorm.DB {
+	return query.Where("pets.id IN (?)", s.adapter.
+		Table("pet_tags").
+		Select("pet_tags.pet_id").
+		Joins("JOIN tags ON tags.id = pet_tags.tag_id").
+		Where("tags.name IN ?", tags).
+		Group("pet_tags.pet_id").
+		Having("COUNT(DISTINCT tags.name) = ?", len(tags)))
+}
+
+// FindPets возвращает страницу питомцев по фильтру и общее число совпадений без учёта курсора
+func (s *PetStorage) FindPets(ctx context.Context, filter models.PetFilter) ([]models.Pet, int64, error) {
 	var existingPets []models.Pet
+	var total int64
 
-	err := s.adapter.WithContext(ctx).Preload("Category").Preload("Tags").Where(&models.Pet{
-		Status: status,
-	}).Find(&existingPets).Error
+	query := s.adapter.WithContext(ctx).Model(&models.Pet{})
 
-	return existingPets, err
-}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("pets.status IN ?", filter.Statuses)
+	}
 
-func (s *PetStorage) GetByTags(ctx context.Context, tags []string) ([]models.Pet, error) {
-	var existingPets []models.Pet
+	if len(filter.Tags) > 0 {
+		query = s.withAllTags(query, filter.Tags)
+	}
+
+	query = query.Session(&gorm.Session{})
+
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	column, desc := petSortColumn(filter.Sort)
+	direction, compare := "ASC", ">"
+	if desc {
+		direction, compare = "DESC", "<"
+	}
+
+	page := query
+	if filter.After != nil {
+		if column == "pets.id" {
+			page = page.Where("pets.id "+compare+" ?", filter.After.ID)
+		} else {
+			page = page.Where(
+				"("+column+" "+compare+" ? OR ("+column+" = ? AND pets.id "+compare+" ?))",
+				filter.After.Name, filter.After.Name, filter.After.ID,
+			)
+		}
+	}
+
+	if column != "pets.id" {
+		page = page.Order(column + " " + direction)
+	}
 
-	err := s.adapter.WithContext(ctx).
+	err = page.
 		Preload("Category").
 		Preload("Tags").
-		Joins("JOIN pet_tags ON pet_tags.pet_id = pets.id").
-		Joins("JOIN tags ON tags.id = pet_tags.tag_id").
-		Where("tags.name IN ?", tags).
-		Group("pets.id").
-		Having("COUNT(DISTINCT tags.name) = ?", len(tags)).
+		Preload("PhotoUrls.Variants").
+		Order("pets.id " + direction).
+		Limit(filter.Limit).
 		Find(&existingPets).Error
 
-	return existingPets, err
+	return existingPets, total, err
+}
+
+func petSortColumn(sort string) (string, bool) {
+	desc := strings.HasPrefix(sort, "-")
+	if strings.TrimPrefix(sort, "-") == "name" {
+		return "pets.name", desc
+	}
+	return "pets.id", desc
 }
 
 func (s *PetStorage) UpdatePet(ctx context.Context, pet models.Pet, name string, status string) error {
-	err := s.adapter.WithContext(ctx).
+	result := s.adapter.WithContext(ctx).
 		Model(&pet).
-		Update("name", name).
-		Update("status", status).Error
+		Where("version = ?", pet.Version).
+		Updates(map[string]interface{}{
+			"name":    name,
+			"status":  status,
+			"version": pet.Version + 1,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
 
-	return err
+	if result.RowsAffected == 0 {
+		return etag.ErrMismatch
+	}
+
+	return nil
 }
 
 func (s *PetStorage) DeletePet(ctx context.Context, pet models.Pet) error {
-	err := s.adapter.WithContext(ctx).
-		Model(&pet).
-		Association("Tags").
-		Clear()
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&pet).
+			Association("Tags").
+			Clear()
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		err = tx.Where("pet_refer_id = ?", pet.ID).
+			Delete(&models.PhotoUrl{}).
+			Error
+		if err != nil {
+			return err
+		}
 
-	err = s.adapter.WithContext(ctx).
-		Where("pet_refer_id = ?", pet.ID).
-		Delete(&models.PhotoUrl{}).
-		Error
-	if err != nil {
-		return err
-	}
+		result := tx.Where("version = ?", pet.Version).Delete(&pet)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return etag.ErrMismatch
+		}
 
-	err = s.adapter.WithContext(ctx).Delete(&pet).Error
-	return err
+		return nil
+	})
 }
 
+func (s *PetStorage) AddPhotoUrl(ctx context.Context, photo models.PhotoUrl) (models.PhotoUrl, error) {
+	err := s.adapter.WithContext(ctx).Create(&photo).Error
+	return photo, err
+}
+
+func (s *PetStorage) GetPhotoByObjectKey(ctx context.Context, petID int, key string) (models.PhotoUrl, error) {
+	var photo models.PhotoUrl
+
+	err := s.adapter.WithContext(ctx).Where(&models.PhotoUrl{
+		PetReferID: petID,
+		ObjectKey:  key,
+	}).First(&photo).Error
+
+	return photo, err
+}
+
+func (s *PetStorage) AddPhotoVariant(ctx context.Context, variant models.PhotoVariant) error {
+	return s.adapter.WithContext(ctx).Create(&variant).Error
+}
+
+func (s *PetStorage) GetVariantByObjectKey(ctx context.Context, key string) (models.PhotoVariant, error) {
+	var variant models.PhotoVariant
+
+	err := s.adapter.WithContext(ctx).Where(&models.PhotoVariant{
+		ObjectKey: key,
+	}).First(&variant).Error
+
+	return variant, err
+}
+
+// UpdatePetByModel применяет только заполненные поля updatedPet; категория, теги и фото
+// заменяются, если переданы. Фото с совпадающими URL остаются нетронутыми, как в ReplacePet
 func (s *PetStorage) UpdatePetByModel(ctx context.Context, pet models.Pet, updatedPet models.Pet) error {
 	tx := s.adapter.WithContext(ctx).Begin()
 
+	// Версия поднимается первой: при конфликте фото и теги не трогаем
+	result := tx.Model(&pet).
+		Where("version = ?", pet.Version).
+		Update("version", pet.Version+1)
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return etag.ErrMismatch
+	}
+
 	if len(updatedPet.PhotoUrls) > 0 {
-		err := tx.Where("pet_refer_id = ?", pet.ID).Delete(&models.PhotoUrl{}).Error
+		err := replacePhotos(tx, pet, updatedPet.PhotoUrls)
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
-
-		for _, photo := range updatedPet.PhotoUrls {
-			photo.PetReferID = pet.ID
-			err := tx.Create(&photo).Error
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-		}
 	}
 
 	if len(updatedPet.Tags) > 0 {
@@ -169,10 +284,104 @@ func (s *PetStorage) UpdatePetByModel(ctx context.Context, pet models.Pet, updat
 		}
 	}
 
-	err := tx.Model(&pet).Updates(updatedPet).Error
+	// Категория из запроса уже сопоставлена с существующей по имени; новая создаётся здесь
+	if updatedPet.Category != (models.Category{}) {
+		if updatedPet.Category.ID == 0 {
+			err := tx.Create(&updatedPet.Category).Error
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		updatedPet.CategoryID = updatedPet.Category.ID
+	}
+
+	// Ассоциации уже сохранены выше; без Omit GORM вставил бы фото повторно
+	err := tx.Model(&pet).Omit(clause.Associations).Updates(updatedPet).Error
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
 	return tx.Commit().Error
 }
+
+// ReplacePet приводит питомца к состоянию updatedPet целиком: в отличие от
+// UpdatePetByModel пустые теги и фото тоже применяются, а уже сохранённые фото
+// с совпадающими URL остаются нетронутыми вместе с файлами и вариантами
+func (s *PetStorage) ReplacePet(ctx context.Context, pet models.Pet, updatedPet models.Pet) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if updatedPet.Category.ID == 0 {
+			err := tx.Create(&updatedPet.Category).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// Модель без ассоциаций: иначе GORM перезапишет category_id из загруженной pet.Category
+		result := tx.Model(&models.Pet{}).
+			Where("id = ? AND version = ?", pet.ID, pet.Version).
+			Updates(map[string]interface{}{
+				"name":        updatedPet.Name,
+				"status":      updatedPet.Status,
+				"category_id": updatedPet.Category.ID,
+				"version":     pet.Version + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return etag.ErrMismatch
+		}
+
+		var err error
+		if len(updatedPet.Tags) == 0 {
+			err = tx.Model(&pet).Association("Tags").Clear()
+		} else {
+			err = tx.Model(&pet).Association("Tags").Replace(updatedPet.Tags)
+		}
+		if err != nil {
+			return err
+		}
+
+		return replacePhotos(tx, pet, updatedPet.PhotoUrls)
+	})
+}
+
+// replacePhotos приводит фото питомца к списку photos. Уже сохранённые фото с совпадающими URL
+// остаются нетронутыми вместе с ключом файла, метаданными и вариантами
+func replacePhotos(tx *gorm.DB, pet models.Pet, photos []models.PhotoUrl) error {
+	keep := map[string]bool{}
+	for _, photo := range photos {
+		keep[photo.PhotoUrl] = true
+	}
+
+	existing := map[string]bool{}
+	for _, photo := range pet.PhotoUrls {
+		existing[photo.PhotoUrl] = true
+		if keep[photo.PhotoUrl] {
+			continue
+		}
+
+		err := tx.Delete(&photo).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, photo := range photos {
+		if existing[photo.PhotoUrl] {
+			continue
+		}
+
+		photo.PetReferID = pet.ID
+		err := tx.Create(&photo).Error
+		if err != nil {
+			return err
+		}
+		existing[photo.PhotoUrl] = true
+	}
+
+	return nil
+}
@@ -1,51 +1,111 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-playground/form"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/jsonpatch"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/repository"
 )
 
 type Peter interface {
+	ValidatePet(ctx context.Context, pet models.PetJSON) error
+	ValidatePetUpdate(ctx context.Context, pet models.Pet, updated models.PetJSON) error
 	ExistingPet(ctx context.Context, name string) error
 	ExistingTag(ctx context.Context, pet *models.Pet)
 	ExistingCategory(ctx context.Context, pet *models.Pet)
 	CreatePet(ctx context.Context, pet models.Pet) error
 	GetPetByID(ctx context.Context, id string) (models.Pet, error)
-	FindByStatus(ctx context.Context, status []string) ([]models.Pet, error)
-	FindByTags(ctx context.Context, tags []string) ([]models.Pet, error)
+	GetPetByName(ctx context.Context, name string) (models.Pet, error)
+	FindByStatus(ctx context.Context, query models.StatusForm) (models.PetPage, error)
+	FindByTags(ctx context.Context, query models.TagsForm) (models.PetPage, error)
 	UpdatePet(ctx context.Context, pet models.Pet, form models.PetIdForm) error
 	DeletePet(ctx context.Context, pet models.Pet) error
 	UpdatePetByModel(ctx context.Context, pet models.Pet, updatedPet models.Pet) error
-	AddPetPhotoUrls(ctx context.Context, pet models.Pet, url string) error
+	ReplacePet(ctx context.Context, pet models.Pet, updatedPet models.Pet) error
+	ApplyPatch(pet models.PetJSON, contentType string, patch io.Reader) (models.PetJSON, error)
+	PatchCheck(ctx context.Context, pet models.Pet, patched models.PetJSON) error
+	AddPetPhoto(ctx context.Context, pet models.Pet, upload ImageUpload) (models.PhotoUrl, error)
+	GetPetImage(ctx context.Context, petID string, name string) (ImageObject, error)
 
 	StatusCheck(status string) error
 	PetToDB(pet models.PetJSON) models.Pet
+	PetFromDB(pet models.Pet) models.PetJSON
 	Itoa(id int) string
 
 	Decode(r io.ReadCloser, data interface{}) error
 	DecodeURl(params interface{}, values url.Values) error
 	URLParam(r *http.Request, param string) string
 	ValuesFromForm(r *http.Request) (models.PetIdForm, error)
-	FileFromForm(r *http.Request) (string, error)
+	FileFromForm(w http.ResponseWriter, r *http.Request) (ImageUpload, error)
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	maxPatchSize = 1 << 20
+
+	maxImageSize = 5 << 20
+	// Запас на заголовки multipart и прочие поля формы сверх размера самого файла
+	multipartOverhead = 1 << 20
+)
+
+var errInvalidCursor = apperr.InvalidField("cursor", "invalid_cursor", "invalid cursor")
+
+var ErrUnsupportedPatch = errors.New("unsupported patch content type, use application/merge-patch+json or application/json-patch+json")
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImageUpload - файл изображения, полученный из multipart-формы
+type ImageUpload struct {
+	File               multipart.File
+	Filename           string
+	Size               int64
+	AdditionalMetadata string
+}
+
+// ImageObject - сохранённое изображение или его вариант, готовое к отдаче клиенту
+type ImageObject struct {
+	ContentType string
+	Size        int64
+	Body        io.ReadCloser
 }
 
 type PetService struct {
-	storage repository.PetRepository
+	storage    repository.PetRepository
+	blobs      blob.BlobStore
+	thumbnails Thumbnailer
 }
 
-func NewPetService(storage repository.PetRepository) *PetService {
+func NewPetService(storage repository.PetRepository, blobs blob.BlobStore, thumbnails Thumbnailer) *PetService {
 	return &PetService{
-		storage: storage,
+		storage:    storage,
+		blobs:      blobs,
+		thumbnails: thumbnails,
 	}
 }
 
@@ -60,7 +120,7 @@ func (s *PetService) StatusCheck(status string) error {
 			return nil
 		}
 	}
-	return fmt.Errorf("invalid status: %s", status)
+	return apperr.InvalidField("status", "invalid_status", "invalid status: %s", status)
 }
 
 func (s *PetService) PetToDB(pet models.PetJSON) models.Pet {
@@ -80,21 +140,71 @@ func (s *PetService) PetToDB(pet models.PetJSON) models.Pet {
 	return petDB
 }
 
+func (s *PetService) PetFromDB(pet models.Pet) models.PetJSON {
+	petJSON := models.PetJSON{
+		ID:        pet.ID,
+		Category:  pet.Category,
+		Name:      pet.Name,
+		PhotoUrls: []string{},
+		Tags:      pet.Tags,
+		Status:    pet.Status,
+	}
+	for _, photo := range pet.PhotoUrls {
+		petJSON.PhotoUrls = append(petJSON.PhotoUrls, photo.PhotoUrl)
+		petJSON.Photos = append(petJSON.Photos, models.PhotoJSON{
+			URL:                photo.PhotoUrl,
+			AdditionalMetadata: photo.AdditionalMetadata,
+			Variants:           photo.Variants,
+		})
+	}
+	if petJSON.Tags == nil {
+		petJSON.Tags = []models.Tag{}
+	}
+	return petJSON
+}
+
 func (s *PetService) CreatePet(ctx context.Context, pet models.Pet) error {
 	return s.storage.CreatePet(ctx, pet)
 }
 
+// ValidatePet проверяет имя и статус питомца из запроса и возвращает ошибки по всем полям сразу
+func (s *PetService) ValidatePet(ctx context.Context, pet models.PetJSON) error {
+	return s.validatePet(ctx, pet, "")
+}
+
+// ValidatePetUpdate проверяет новые данные питомца так же, как ValidatePet,
+// но не считает конфликтом имя, которое у питомца уже есть
+func (s *PetService) ValidatePetUpdate(ctx context.Context, pet models.Pet, updated models.PetJSON) error {
+	return s.validatePet(ctx, updated, pet.Name)
+}
+
+func (s *PetService) validatePet(ctx context.Context, pet models.PetJSON, currentName string) error {
+	var v apperr.Validator
+
+	if v.Required("name", pet.Name, "pet name is required") && pet.Name != currentName {
+		v.Check("name", s.ExistingPet(ctx, pet.Name))
+	}
+	v.Check("status", s.StatusCheck(pet.Status))
+
+	return v.Err()
+}
+
 func (s *PetService) ExistingPet(ctx context.Context, name string) error {
-	err := s.storage.GetByName(ctx, name)
+	_, err := s.storage.GetByName(ctx, name)
 	if err == nil {
-		return fmt.Errorf("a pet with that name already exists")
+		return apperr.Conflict("pet_exists", "a pet with that name already exists")
 	}
-	return nil
+	if errors.Is(err, repository.ErrPetNotFound) {
+		return nil
+	}
+	return err
 }
 
 func (s *PetService) ExistingCategory(ctx context.Context, pet *models.Pet) {
 	category, err := s.storage.GetCategoryByName(ctx, pet.Category)
 	if err != nil {
+		// Категория будет создана по имени, ID от клиента не используем
+		pet.Category.ID = 0
 		return
 	}
 	pet.Category = category
@@ -107,7 +217,7 @@ func (s *PetService) ExistingTag(ctx context.Context, pet *models.Pet) {
 		if err == nil {
 			tags = append(tags, existTag)
 		} else {
-			tags = append(tags, tag)
+			tags = append(tags, models.Tag{Name: tag.Name})
 		}
 	}
 	pet.Tags = tags
@@ -119,14 +229,29 @@ func (s *PetService) URLParam(r *http.Request, param string) string {
 }
 
 func (s *PetService) GetPetByID(ctx context.Context, id string) (models.Pet, error) {
-	intId, err := strconv.Atoi(id)
+	intId, err := apperr.ParseID("petId", id)
 	if err != nil {
 		return models.Pet{}, err
 	}
 
 	pet, err := s.storage.GetByID(ctx, intId)
+	if errors.Is(err, repository.ErrPetNotFound) {
+		return models.Pet{}, apperr.NotFound("pet_not_found", "pet with that id does not exist: %v", id)
+	}
+	if err != nil {
+		return models.Pet{}, err
+	}
+
+	return pet, nil
+}
+
+func (s *PetService) GetPetByName(ctx context.Context, name string) (models.Pet, error) {
+	pet, err := s.storage.GetByName(ctx, name)
+	if errors.Is(err, repository.ErrPetNotFound) {
+		return models.Pet{}, apperr.NotFound("pet_not_found", "pet with that name does not exist: %v", name)
+	}
 	if err != nil {
-		return models.Pet{}, fmt.Errorf("pet with that id does not exist: %v", id)
+		return models.Pet{}, err
 	}
 
 	return pet, nil
@@ -136,25 +261,113 @@ func (s *PetService) DecodeURl(params interface{}, values url.Values) error {
 	return form.NewDecoder().Decode(&params, values)
 }
 
-func (s *PetService) FindByStatus(ctx context.Context, statuses []string) ([]models.Pet, error) {
-	var pets []models.Pet
+func (s *PetService) FindByStatus(ctx context.Context, query models.StatusForm) (models.PetPage, error) {
+	if len(query.Statuses) == 0 {
+		return models.PetPage{}, apperr.InvalidField("status", "required", "at least one status is required")
+	}
 
-	for _, status := range statuses {
-		dbPets, err := s.storage.GetByStatus(ctx, status)
+	for _, status := range query.Statuses {
+		err := s.StatusCheck(status)
 		if err != nil {
-			return pets, err
+			return models.PetPage{}, err
 		}
-		pets = append(pets, dbPets...)
 	}
-	return pets, nil
+
+	return s.findPets(ctx, models.PetFilter{Statuses: query.Statuses}, query.PageForm)
 }
 
-func (s *PetService) FindByTags(ctx context.Context, tags []string) ([]models.Pet, error) {
-	pets, err := s.storage.GetByTags(ctx, tags)
+func (s *PetService) FindByTags(ctx context.Context, query models.TagsForm) (models.PetPage, error) {
+	if len(query.Tags) == 0 {
+		return models.PetPage{}, apperr.InvalidField("tags", "required", "at least one tag is required")
+	}
+
+	return s.findPets(ctx, models.PetFilter{Tags: query.Tags}, query.PageForm)
+}
+
+func (s *PetService) findPets(ctx context.Context, filter models.PetFilter, page models.PageForm) (models.PetPage, error) {
+	switch page.Sort {
+	case "", "id", "-id", "name", "-name":
+	default:
+		return models.PetPage{}, apperr.InvalidField("sort", "invalid_sort", "invalid sort: %s", page.Sort)
+	}
+
+	limit := page.Limit
+	switch {
+	case limit < 0:
+		return models.PetPage{}, apperr.InvalidField("limit", "invalid_limit", "invalid limit: %d", limit)
+	case limit == 0:
+		limit = defaultPageLimit
+	case limit > maxPageLimit:
+		limit = maxPageLimit
+	}
+
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor, page.Sort)
+		if err != nil {
+			return models.PetPage{}, err
+		}
+		filter.After = &cursor
+	}
+
+	filter.Sort = page.Sort
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit = limit + 1
+
+	pets, total, err := s.storage.FindPets(ctx, filter)
+	if err != nil {
+		return models.PetPage{}, err
+	}
+
+	result := models.PetPage{
+		Pets:  []models.PetJSON{},
+		Total: total,
+	}
+
+	if len(pets) > limit {
+		pets = pets[:limit]
+		result.NextCursor = encodeCursor(petCursor(pets[limit-1], page.Sort))
+	}
+
+	for _, pet := range pets {
+		result.Pets = append(result.Pets, s.PetFromDB(pet))
+	}
+
+	return result, nil
+}
+
+// petCursor кладёт в курсор только ключи текущей сортировки: имя нужно лишь при сортировке по имени
+func petCursor(pet models.Pet, sort string) models.PetCursor {
+	cursor := models.PetCursor{ID: pet.ID}
+	if sortsByName(sort) {
+		cursor.Name = pet.Name
+	}
+	return cursor
+}
+
+func sortsByName(sort string) bool {
+	return strings.TrimPrefix(sort, "-") == "name"
+}
+
+func encodeCursor(cursor models.PetCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor отклоняет курсор, выданный для другой сортировки
+func decodeCursor(value string, sort string) (models.PetCursor, error) {
+	var cursor models.PetCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
 	if err != nil {
-		return []models.Pet{}, err
+		return cursor, errInvalidCursor
+	}
+
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.ID <= 0 || (cursor.Name != "") != sortsByName(sort) {
+		return cursor, errInvalidCursor
 	}
-	return pets, nil
+
+	return cursor, nil
 }
 
 func (s *PetService) ValuesFromForm(r *http.Request) (models.PetIdForm, error) {
@@ -171,15 +384,35 @@ func (s *PetService) ValuesFromForm(r *http.Request) (models.PetIdForm, error) {
 	return petIdForm, nil
 }
 
-func (s *PetService) FileFromForm(r *http.Request) (string, error) {
+func (s *PetService) FileFromForm(w http.ResponseWriter, r *http.Request) (ImageUpload, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize+multipartOverhead)
+
 	err := r.ParseMultipartForm(10 << 20)
 	if err != nil {
-		return "", err
+		return ImageUpload{}, err
+	}
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		return ImageUpload{}, apperr.InvalidField("file", "required", "file is required")
 	}
-	formData := r.MultipartForm.File
-	fileName := formData["file"][0].Filename
 
-	return fileName, nil
+	header := files[0]
+	if header.Size > maxImageSize {
+		return ImageUpload{}, apperr.InvalidField("file", "file_too_large", "image is too large: maximum size is %d bytes", maxImageSize)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return ImageUpload{}, err
+	}
+
+	return ImageUpload{
+		File:               file,
+		Filename:           header.Filename,
+		Size:               header.Size,
+		AdditionalMetadata: r.FormValue("additionalMetadata"),
+	}, nil
 }
 
 func (s *PetService) UpdatePet(ctx context.Context, pet models.Pet, form models.PetIdForm) error {
@@ -190,29 +423,225 @@ func (s *PetService) UpdatePet(ctx context.Context, pet models.Pet, form models.
 
 func (s *PetService) DeletePet(ctx context.Context, pet models.Pet) error {
 	err := s.storage.DeletePet(ctx, pet)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Файлы удаляются после записи в БД: осиротевший файл безопаснее, чем ссылка на удалённый файл
+	for _, photo := range pet.PhotoUrls {
+		if photo.ObjectKey != "" {
+			s.blobs.Delete(ctx, photo.ObjectKey)
+		}
+		for _, variant := range photo.Variants {
+			s.blobs.Delete(ctx, variant.ObjectKey)
+		}
+	}
+
+	return nil
 }
 
 func (s *PetService) Itoa(id int) string {
 	return strconv.Itoa(id)
 }
 
+// UpdatePetByModel обновляет заполненные поля питомца; если переданы фото, файлы
+// убранных фото удаляются из хранилища, как в ReplacePet
 func (s *PetService) UpdatePetByModel(ctx context.Context, pet models.Pet, updatedPet models.Pet) error {
-	return s.storage.UpdatePetByModel(ctx, pet, updatedPet)
+	err := s.storage.UpdatePetByModel(ctx, pet, updatedPet)
+	if err != nil {
+		return err
+	}
+
+	if len(updatedPet.PhotoUrls) > 0 {
+		s.deleteDroppedPhotos(ctx, pet, updatedPet.PhotoUrls)
+	}
+
+	return nil
 }
 
-func (s *PetService) AddPetPhotoUrls(ctx context.Context, pet models.Pet, url string) error {
-	urls := pet.PhotoUrls
-	fmt.Println(urls)
-	photoUrl := models.PhotoUrl{
-		PhotoUrl:   fmt.Sprintf("/pets/%v/%s", pet.ID, url),
-		PetReferID: pet.ID,
+// ApplyPatch применяет JSON Merge Patch или JSON Patch к JSON-представлению питомца
+func (s *PetService) ApplyPatch(pet models.PetJSON, contentType string, patch io.Reader) (models.PetJSON, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return models.PetJSON{}, ErrUnsupportedPatch
 	}
 
-	urls = append(urls, photoUrl)
-	updatedPet := pet
-	updatedPet.PhotoUrls = urls
+	var apply func(doc []byte, patch []byte) ([]byte, error)
+	switch mediaType {
+	case "application/merge-patch+json":
+		apply = jsonpatch.MergePatch
+	case "application/json-patch+json":
+		apply = jsonpatch.Apply
+	default:
+		return models.PetJSON{}, ErrUnsupportedPatch
+	}
+
+	body, err := io.ReadAll(io.LimitReader(patch, maxPatchSize))
+	if err != nil {
+		return models.PetJSON{}, err
+	}
+
+	doc, err := json.Marshal(pet)
+	if err != nil {
+		return models.PetJSON{}, err
+	}
+
+	doc, err = apply(doc, body)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return models.PetJSON{}, apperr.Conflict("patch_test_failed", "%w", err)
+	}
+	if err != nil {
+		return models.PetJSON{}, apperr.Invalid("invalid_patch", "%w", err)
+	}
 
-	return s.storage.UpdatePetByModel(ctx, pet, updatedPet)
+	var patched models.PetJSON
+	err = json.Unmarshal(doc, &patched)
+	if err != nil {
+		return models.PetJSON{}, apperr.Invalid("invalid_patch", "patched pet is invalid: %v", err)
+	}
+
+	return patched, nil
+}
+
+// PatchCheck проверяет результат патча теми же правилами, что и создание питомца
+func (s *PetService) PatchCheck(ctx context.Context, pet models.Pet, patched models.PetJSON) error {
+	var v apperr.Validator
+
+	if patched.ID != pet.ID {
+		v.Check("id", apperr.InvalidField("id", "immutable", "pet id cannot be changed"))
+	}
+
+	if v.Required("name", patched.Name, "pet name is required") && patched.Name != pet.Name {
+		v.Check("name", s.ExistingPet(ctx, patched.Name))
+	}
+	v.Required("category", patched.Category.Name, "category name is required")
+	v.Check("status", s.StatusCheck(patched.Status))
+
+	return v.Err()
+}
+
+func (s *PetService) ReplacePet(ctx context.Context, pet models.Pet, updatedPet models.Pet) error {
+	err := s.storage.ReplacePet(ctx, pet, updatedPet)
+	if err != nil {
+		return err
+	}
+
+	s.deleteDroppedPhotos(ctx, pet, updatedPet.PhotoUrls)
+
+	return nil
+}
+
+// deleteDroppedPhotos удаляет из хранилища файлы фото питомца, которых нет в photos
+func (s *PetService) deleteDroppedPhotos(ctx context.Context, pet models.Pet, photos []models.PhotoUrl) {
+	keep := map[string]bool{}
+	for _, photo := range photos {
+		keep[photo.PhotoUrl] = true
+	}
+
+	for _, photo := range pet.PhotoUrls {
+		if keep[photo.PhotoUrl] {
+			continue
+		}
+		if photo.ObjectKey != "" {
+			s.blobs.Delete(ctx, photo.ObjectKey)
+		}
+		for _, variant := range photo.Variants {
+			s.blobs.Delete(ctx, variant.ObjectKey)
+		}
+	}
+}
+
+func (s *PetService) AddPetPhoto(ctx context.Context, pet models.Pet, upload ImageUpload) (models.PhotoUrl, error) {
+	defer upload.File.Close()
+
+	// Тип определяется по содержимому файла, а не по имени или заголовкам клиента
+	head := make([]byte, 512)
+	n, err := io.ReadFull(upload.File, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return models.PhotoUrl{}, apperr.InvalidField("file", "empty", "file is empty")
+		}
+		return models.PhotoUrl{}, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return models.PhotoUrl{}, apperr.InvalidField("file", "unsupported_image_type", "unsupported image type: %s", contentType)
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return models.PhotoUrl{}, err
+	}
+	name += ext
+
+	key := imageKey(pet.ID, name)
+
+	err = s.blobs.Put(ctx, key, io.MultiReader(bytes.NewReader(head), upload.File), upload.Size, contentType)
+	if err != nil {
+		return models.PhotoUrl{}, err
+	}
+
+	photo, err := s.storage.AddPhotoUrl(ctx, models.PhotoUrl{
+		PhotoUrl:           fmt.Sprintf("/pet/%d/images/%s", pet.ID, name),
+		PetReferID:         pet.ID,
+		ObjectKey:          key,
+		ContentType:        contentType,
+		Size:               upload.Size,
+		AdditionalMetadata: upload.AdditionalMetadata,
+	})
+	if err != nil {
+		s.blobs.Delete(ctx, key)
+		return models.PhotoUrl{}, err
+	}
+
+	// WebP нет среди стандартных декодеров, для него отдаётся только оригинал
+	if contentType != "image/webp" {
+		s.thumbnails.Enqueue(photo)
+	}
+
+	return photo, nil
+}
+
+func (s *PetService) GetPetImage(ctx context.Context, petID string, name string) (ImageObject, error) {
+	intId, err := apperr.ParseID("petId", petID)
+	if err != nil {
+		return ImageObject{}, err
+	}
+
+	key := imageKey(intId, name)
+	object := ImageObject{}
+
+	photo, err := s.storage.GetPhotoByObjectKey(ctx, intId, key)
+	if err == nil {
+		object.ContentType, object.Size = photo.ContentType, photo.Size
+	} else {
+		variant, err := s.storage.GetVariantByObjectKey(ctx, key)
+		if err != nil {
+			return ImageObject{}, apperr.NotFound("image_not_found", "image does not exist: %s", name)
+		}
+		object.ContentType, object.Size = variant.ContentType, variant.Size
+	}
+
+	object.Body, err = s.blobs.Get(ctx, key)
+	if err != nil {
+		return ImageObject{}, err
+	}
+
+	return object, nil
+}
+
+func imageKey(petID int, name string) string {
+	return fmt.Sprintf("pets/%d/%s", petID, name)
+}
+
+func randomName() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
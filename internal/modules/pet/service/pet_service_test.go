@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/repository"
+)
+
+func newMemoryService(t *testing.T, names ...string) *PetService {
+	s := NewPetService(repository.NewPetMemory(memdb.New()), nil, nil)
+	category := models.Category{Name: "dogs"}
+	for _, name := range names {
+		err := s.CreatePet(context.Background(), models.Pet{Name: name, Status: "available", Category: category})
+		require.NoError(t, err)
+		category = models.Category{ID: 1}
+	}
+	return s
+}
+
+// collectPages проходит все страницы по курсорам и возвращает имена в порядке выдачи
+func collectPages(t *testing.T, s *PetService, sort string, limit int) []string {
+	var names []string
+	query := models.StatusForm{Statuses: []string{"available"}, PageForm: models.PageForm{Sort: sort, Limit: limit}}
+
+	for i := 0; ; i++ {
+		require.Less(t, i, 10, "Курсоры не должны зацикливаться")
+
+		page, err := s.FindByStatus(context.Background(), query)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), page.Total)
+
+		for _, pet := range page.Pets {
+			names = append(names, pet.Name)
+		}
+		if page.NextCursor == "" {
+			return names
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func TestFindPets_CursorRoundTrip(t *testing.T) {
+	s := newMemoryService(t, "Rex", "Bob", "Max", "Bob", "Ace")
+
+	tests := []struct {
+		sort     string
+		expected []string
+	}{
+		{sort: "", expected: []string{"Rex", "Bob", "Max", "Bob", "Ace"}},
+		{sort: "-id", expected: []string{"Ace", "Bob", "Max", "Bob", "Rex"}},
+		{sort: "name", expected: []string{"Ace", "Bob", "Bob", "Max", "Rex"}},
+		{sort: "-name", expected: []string{"Rex", "Max", "Bob", "Bob", "Ace"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			assert.Equal(t, tt.expected, collectPages(t, s, tt.sort, 2))
+		})
+	}
+}
+
+func TestFindPets_Limit(t *testing.T) {
+	s := newMemoryService(t, "Rex", "Bob", "Max", "Bob", "Ace")
+
+	tests := []struct {
+		limit    int
+		expected int
+	}{
+		{limit: 0, expected: 5},
+		{limit: 1, expected: 1},
+		{limit: 5, expected: 5},
+		{limit: maxPageLimit + 1, expected: 5},
+	}
+
+	for _, tt := range tests {
+		page, err := s.FindByStatus(context.Background(), models.StatusForm{
+			Statuses: []string{"available"},
+			PageForm: models.PageForm{Limit: tt.limit},
+		})
+		require.NoError(t, err)
+		assert.Len(t, page.Pets, tt.expected, "limit %d", tt.limit)
+		assert.Equal(t, tt.limit > 0 && tt.limit < 5, page.NextCursor != "", "limit %d", tt.limit)
+	}
+
+	_, err := s.FindByStatus(context.Background(), models.StatusForm{
+		Statuses: []string{"available"},
+		PageForm: models.PageForm{Limit: -1},
+	})
+	assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+}
+
+func TestFindPets_InvalidPage(t *testing.T) {
+	s := newMemoryService(t, "Rex")
+
+	tests := []struct {
+		name string
+		page models.PageForm
+	}{
+		{name: "unknown sort", page: models.PageForm{Sort: "status"}},
+		{name: "garbage cursor", page: models.PageForm{Cursor: "not-base64!"}},
+		{name: "cursor without id", page: models.PageForm{Cursor: encodeCursor(models.PetCursor{})}},
+		{name: "name cursor for id sort", page: models.PageForm{Cursor: encodeCursor(models.PetCursor{ID: 1, Name: "Rex"})}},
+		{name: "id cursor for name sort", page: models.PageForm{Sort: "name", Cursor: encodeCursor(models.PetCursor{ID: 1})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.FindByStatus(context.Background(), models.StatusForm{Statuses: []string{"available"}, PageForm: tt.page})
+			assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+		})
+	}
+}
+
+func TestPetCursor(t *testing.T) {
+	pet := models.Pet{ID: 7, Name: "Rex"}
+
+	assert.Equal(t, models.PetCursor{ID: 7}, petCursor(pet, "-id"))
+	assert.Equal(t, models.PetCursor{ID: 7, Name: "Rex"}, petCursor(pet, "-name"))
+
+	cursor, err := decodeCursor(encodeCursor(petCursor(pet, "name")), "name")
+	require.NoError(t, err)
+	assert.Equal(t, models.PetCursor{ID: 7, Name: "Rex"}, cursor)
+}
+
+func TestValidatePetUpdate(t *testing.T) {
+	s := newMemoryService(t, "Rex", "Bob")
+
+	rex, err := s.GetPetByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	err = s.ValidatePetUpdate(context.Background(), rex, models.PetJSON{Name: "Rex", Status: "sold"})
+	assert.NoError(t, err, "Неизменённое имя не должно считаться занятым")
+
+	err = s.ValidatePetUpdate(context.Background(), rex, models.PetJSON{Name: "Max", Status: "sold"})
+	assert.NoError(t, err)
+
+	err = s.ValidatePetUpdate(context.Background(), rex, models.PetJSON{Name: "Bob", Status: "sold"})
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+
+	err = s.ValidatePet(context.Background(), models.PetJSON{Name: "Rex", Status: "available"})
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+}
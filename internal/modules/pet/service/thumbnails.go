@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/imaging"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/repository"
+)
+
+const thumbnailQueueSize = 100
+
+// maxThumbnailPixels - предел размера изображения для декодирования. Небольшой файл может
+// объявить огромные размеры, а декодер выделит под них буфер целиком: 40 Мп - это около 160 МБ RGBA
+const maxThumbnailPixels = 40_000_000
+
+var errImageTooLarge = errors.New("image dimensions are too large")
+
+type thumbnailSize struct {
+	Name    string
+	MaxSide int
+}
+
+var thumbnailSizes = []thumbnailSize{
+	{Name: "small", MaxSide: 160},
+	{Name: "medium", MaxSide: 480},
+	{Name: "large", MaxSide: 1024},
+}
+
+// Thumbnailer - интерфейс фоновой генерации уменьшенных копий фото
+type Thumbnailer interface {
+	Enqueue(photo models.PhotoUrl)
+}
+
+// ThumbnailPipeline генерирует варианты фото в фоновых воркерах.
+// Задачи, оставшиеся в очереди к остановке процесса, теряются.
+type ThumbnailPipeline struct {
+	storage repository.PetRepository
+	blobs   blob.BlobStore
+	jobs    chan models.PhotoUrl
+
+	// ctx отменяется, если текущие задачи не успели завершиться за время остановки
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	stopped sync.Once
+	workers sync.WaitGroup
+}
+
+func NewThumbnailPipeline(storage repository.PetRepository, blobs blob.BlobStore, workers int) *ThumbnailPipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &ThumbnailPipeline{
+		storage: storage,
+		blobs:   blobs,
+		jobs:    make(chan models.PhotoUrl, thumbnailQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *ThumbnailPipeline) Enqueue(photo models.PhotoUrl) {
+	select {
+	case <-p.stop:
+		log.Printf("Thumbnail pipeline is stopped, skipping photo %d", photo.ID)
+	case p.jobs <- photo:
+	default:
+		log.Printf("Thumbnail queue is full, skipping photo %d", photo.ID)
+	}
+}
+
+// Close останавливает воркеры: новые задачи не берутся, текущие дорабатывают до отмены ctx,
+// после чего прерываются
+func (p *ThumbnailPipeline) Close(ctx context.Context) error {
+	p.stopped.Do(func() {
+		close(p.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *ThumbnailPipeline) work() {
+	defer p.workers.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case photo := <-p.jobs:
+			err := p.process(p.ctx, photo)
+			if err != nil {
+				log.Printf("Thumbnail generation failed for photo %d: %v", photo.ID, err)
+			}
+		}
+	}
+}
+
+func (p *ThumbnailPipeline) process(ctx context.Context, photo models.PhotoUrl) error {
+	r, err := p.blobs.Get(ctx, photo.ObjectKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImageSize+1))
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	// Размеры читаются из заголовка до декодирования, чтобы не выделять память под всю картинку
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return fmt.Errorf("%w: %dx%d", errImageTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for _, size := range thumbnailSizes {
+		resized := imaging.Fit(img, size.MaxSide)
+
+		var buf bytes.Buffer
+		contentType, err := imaging.Encode(&buf, resized, photo.ContentType)
+		if err != nil {
+			return err
+		}
+
+		ext := imageExtensions[contentType]
+		key := variantName(photo.ObjectKey, size.Name, ext)
+		fileSize := int64(buf.Len())
+
+		err = p.blobs.Put(ctx, key, &buf, fileSize, contentType)
+		if err != nil {
+			return err
+		}
+
+		err = p.storage.AddPhotoVariant(ctx, models.PhotoVariant{
+			PhotoID:     photo.ID,
+			Name:        size.Name,
+			PhotoUrl:    variantName(photo.PhotoUrl, size.Name, ext),
+			ObjectKey:   key,
+			ContentType: contentType,
+			Size:        fileSize,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+		})
+		if err != nil {
+			// Фото могли удалить, пока шла обработка
+			p.blobs.Delete(ctx, key)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// variantName превращает "pets/1/abc.png" в "pets/1/abc_small.jpg"
+func variantName(original string, size string, ext string) string {
+	return strings.TrimSuffix(original, path.Ext(original)) + "_" + size + ext
+}
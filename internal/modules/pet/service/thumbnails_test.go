@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/repository"
+)
+
+// pngHeader возвращает начало PNG-файла, в котором объявлены заданные размеры
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // глубина цвета
+	ihdr[13] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)-4))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.Bytes()
+}
+
+func TestThumbnailPipeline_RejectsLargeImage(t *testing.T) {
+	blobs := blob.NewLocalStore(t.TempDir())
+	p := NewThumbnailPipeline(repository.NewPetMemory(memdb.New()), blobs, 0)
+
+	data := pngHeader(100000, 100000)
+	require.NoError(t, blobs.Put(context.Background(), "pets/1/huge.png", bytes.NewReader(data), int64(len(data)), "image/png"))
+
+	err := p.process(context.Background(), models.PhotoUrl{ID: 1, ObjectKey: "pets/1/huge.png"})
+	assert.ErrorIs(t, err, errImageTooLarge)
+}
+
+func TestThumbnailPipeline_Close(t *testing.T) {
+	p := NewThumbnailPipeline(repository.NewPetMemory(memdb.New()), blob.NewLocalStore(t.TempDir()), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, p.Close(ctx))
+	assert.Error(t, p.ctx.Err(), "После остановки текущие задачи должны отменяться")
+
+	// Повторная остановка и постановка задач после неё не должны паниковать
+	p.Enqueue(models.PhotoUrl{ID: 1})
+	assert.NoError(t, p.Close(ctx))
+}
@@ -1,22 +1,64 @@
 package modules
 
 import (
+	"context"
+
 	"github.com/go-chi/jwtauth"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/lockout"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
+	category "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/category/service"
 	pet "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/service"
 	store "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/service"
+	tag "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/tag/service"
 	user "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/service"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
 )
 
+const thumbnailWorkers = 2
+
 type Services struct {
-	User  user.Userer
-	Store store.Storer
-	Pet   pet.Peter
+	User     user.Userer
+	Store    store.Storer
+	Pet      pet.Peter
+	Category category.Categorer
+	Tag      tag.Tagger
+
+	thumbnails *pet.ThumbnailPipeline
 }
 
-func NewServices(storages Storages, tokenAuth *jwtauth.JWTAuth) *Services {
+func NewServices(storages Storages, tokenAuth *jwtauth.JWTAuth, blobs blob.BlobStore, passwords *password.Checker, mailer mail.Mailer, recorder audit.Recorder, cfg config.Config) *Services {
+	guard := lockout.NewGuard(
+		lockout.NewMemoryTracker(cfg.Auth.Lockout.User.Policy()),
+		lockout.NewMemoryTracker(cfg.Auth.Lockout.IP.Policy()),
+	)
+
+	thumbnails := pet.NewThumbnailPipeline(storages.Pet, blobs, thumbnailWorkers)
+
 	return &Services{
-		User:  user.NewUserService(storages.User, tokenAuth),
-		Store: store.NewStoreService(storages.Store),
-		Pet:   pet.NewPetService(storages.Pet),
+		User: user.NewUserService(storages.User, tokenAuth, passwords, mailer, guard, recorder, user.Options{
+			AccessTTL:            cfg.Auth.AccessTokenTTL.Std(),
+			RefreshTTL:           cfg.Auth.RefreshTokenTTL.Std(),
+			VerifyTTL:            cfg.Auth.VerifyTokenTTL.Std(),
+			ResetTTL:             cfg.Auth.ResetTokenTTL.Std(),
+			RequireVerifiedEmail: cfg.Auth.RequireVerifiedEmail,
+			SigningKey:           []byte(cfg.Auth.JWTSecret),
+			BaseURL:              cfg.Mail.BaseURL,
+			ChallengeTTL:         cfg.Auth.ChallengeTTL.Std(),
+			TOTPIssuer:           cfg.Auth.TOTPIssuer,
+		}),
+		Store:    store.NewStoreService(storages.Store),
+		Pet:      pet.NewPetService(storages.Pet, blobs, thumbnails),
+		Category: category.NewCategoryService(storages.Category),
+		Tag:      tag.NewTagService(storages.Tag),
+
+		thumbnails: thumbnails,
 	}
 }
+
+// Close останавливает фоновые воркеры сервисов
+func (s *Services) Close(ctx context.Context) error {
+	return s.thumbnails.Close(ctx)
+}
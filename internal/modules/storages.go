@@ -1,22 +1,48 @@
 package modules
 
 import (
+	"fmt"
+
 	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	category "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/category/repository"
 	pet "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/pet/repository"
 	store "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/repository"
+	tag "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/tag/repository"
 	user "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
 )
 
 type Storages struct {
-	User  user.UserRepository
-	Store store.StoreRepository
-	Pet   pet.PetRepository
+	User     user.UserRepository
+	Store    store.StoreRepository
+	Pet      pet.PetRepository
+	Category category.CategoryRepository
+	Tag      tag.TagRepository
 }
 
-func NewStorages(adapter *gorm.DB) *Storages {
-	return &Storages{
-		User:  user.NewUserStorage(adapter),
-		Store: store.NewStoreStorage(adapter),
-		Pet:   pet.NewPetStorage(adapter),
+// NewStorages создаёт репозитории для драйвера driver. Для config.DriverMemory
+// adapter не нужен: данные живут в памяти процесса и теряются при перезапуске
+func NewStorages(driver string, adapter *gorm.DB) (*Storages, error) {
+	switch driver {
+	case config.DriverPostgres, config.DriverSQLite:
+		return &Storages{
+			User:     user.NewUserStorage(adapter),
+			Store:    store.NewStoreStorage(adapter),
+			Pet:      pet.NewPetStorage(adapter),
+			Category: category.NewCategoryStorage(adapter),
+			Tag:      tag.NewTagStorage(adapter),
+		}, nil
+	case config.DriverMemory:
+		db := memdb.New()
+		return &Storages{
+			User:     user.NewUserMemory(db),
+			Store:    store.NewStoreMemory(db),
+			Pet:      pet.NewPetMemory(db),
+			Category: category.NewCategoryMemory(db),
+			Tag:      tag.NewTagMemory(db),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage driver: %q", driver)
 	}
 }
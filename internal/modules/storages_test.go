@@ -0,0 +1,551 @@
+package modules
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/db"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	store "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/repository"
+	storeService "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/service"
+	users "studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
+)
+
+func newMemoryStorages(t *testing.T) *Storages {
+	storages, err := NewStorages(config.DriverMemory, nil)
+	require.NoError(t, err)
+	return storages
+}
+
+// newSQLiteStorages - репозитории поверх временной базы SQLite со всеми миграциями
+func newSQLiteStorages(t *testing.T) *Storages {
+	conf := config.Default().DB
+	conf.Driver = config.DriverSQLite
+	conf.Name = filepath.Join(t.TempDir(), "petstore.db")
+
+	adapter, err := db.NewDB(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.MigrateDB(adapter))
+
+	storages, err := NewStorages(config.DriverSQLite, adapter)
+	require.NoError(t, err)
+	return storages
+}
+
+// forEachDriver прогоняет тест на in-memory репозиториях и на SQLite, чтобы реализации не расходились
+func forEachDriver(t *testing.T, test func(t *testing.T, storages *Storages)) {
+	t.Run(config.DriverMemory, func(t *testing.T) {
+		test(t, newMemoryStorages(t))
+	})
+	t.Run(config.DriverSQLite, func(t *testing.T) {
+		test(t, newSQLiteStorages(t))
+	})
+}
+
+func TestNewStorages_UnknownDriver(t *testing.T) {
+	_, err := NewStorages("oracle", nil)
+	assert.Error(t, err)
+}
+
+func TestMemoryPets_FindPetsByTags(t *testing.T) {
+	storages := newMemoryStorages(t)
+	ctx := context.Background()
+
+	pets := []models.Pet{
+		{Name: "Rex", Status: "available", Category: models.Category{Name: "dogs"}, Tags: []models.Tag{{Name: "big"}, {Name: "friendly"}}},
+		{Name: "Tom", Status: "available", Category: models.Category{ID: 1}, Tags: []models.Tag{{ID: 1}}},
+	}
+	for _, pet := range pets {
+		require.NoError(t, storages.Pet.CreatePet(ctx, pet))
+	}
+
+	found, _, err := storages.Pet.FindPets(ctx, models.PetFilter{Tags: []string{"big", "friendly"}})
+	require.NoError(t, err)
+	require.Len(t, found, 1, "Теги должны совпадать все сразу")
+	assert.Equal(t, "Rex", found[0].Name)
+	assert.Equal(t, "dogs", found[0].Category.Name)
+
+	found, _, err = storages.Pet.FindPets(ctx, models.PetFilter{Tags: []string{"big"}})
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	page, total, err := storages.Pet.FindPets(ctx, models.PetFilter{Sort: "-name", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, page, 1)
+	assert.Equal(t, "Tom", page[0].Name)
+
+	count, err := storages.Category.CountPets(ctx, models.Category{ID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestPets_UpdatePetByModelKeepsPhotos(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storages *Storages) {
+		ctx := context.Background()
+
+		uploaded := models.PhotoUrl{
+			PhotoUrl:           "/pet/1/images/front.png",
+			ObjectKey:          "pets/1/front.png",
+			ContentType:        "image/png",
+			Size:               2048,
+			AdditionalMetadata: "front view",
+			Variants:           []models.PhotoVariant{{Name: "thumb", PhotoUrl: "/pet/1/images/front_thumb.png", ObjectKey: "pets/1/front_thumb.png"}},
+		}
+		require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{
+			Name:      "Rex",
+			Status:    "available",
+			Category:  models.Category{Name: "dogs"},
+			PhotoUrls: []models.PhotoUrl{uploaded, {PhotoUrl: "https://example.com/old.png"}},
+		}))
+
+		pet, err := storages.Pet.GetByID(ctx, 1)
+		require.NoError(t, err)
+
+		// PUT присылает фото голыми URL, как их отдаёт GET
+		err = storages.Pet.UpdatePetByModel(ctx, pet, models.Pet{
+			Name:      "Rex",
+			Status:    "sold",
+			PhotoUrls: []models.PhotoUrl{{PhotoUrl: uploaded.PhotoUrl}, {PhotoUrl: "https://example.com/new.png"}},
+		})
+		require.NoError(t, err)
+
+		pet, err = storages.Pet.GetByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "sold", pet.Status)
+		assert.Equal(t, 2, pet.Version)
+
+		photos := map[string]models.PhotoUrl{}
+		for _, photo := range pet.PhotoUrls {
+			photos[photo.PhotoUrl] = photo
+		}
+		require.Len(t, photos, 2)
+		assert.Contains(t, photos, "https://example.com/new.png")
+
+		kept := photos[uploaded.PhotoUrl]
+		assert.Equal(t, uploaded.ObjectKey, kept.ObjectKey)
+		assert.Equal(t, uploaded.ContentType, kept.ContentType)
+		assert.Equal(t, uploaded.Size, kept.Size)
+		assert.Equal(t, uploaded.AdditionalMetadata, kept.AdditionalMetadata)
+		require.Len(t, kept.Variants, 1, "Варианты сохранённого фото не должны пропадать")
+
+		_, err = storages.Pet.GetVariantByObjectKey(ctx, "pets/1/front_thumb.png")
+		assert.NoError(t, err)
+	})
+}
+
+func TestPets_UpdatePetByModelCategory(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storages *Storages) {
+		ctx := context.Background()
+
+		require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{Name: "Rex", Status: "available", Category: models.Category{Name: "dogs"}}))
+
+		pet, err := storages.Pet.GetByID(ctx, 1)
+		require.NoError(t, err)
+
+		// без категории в запросе категория питомца не меняется
+		require.NoError(t, storages.Pet.UpdatePetByModel(ctx, pet, models.Pet{Name: "Rex"}))
+		pet, err = storages.Pet.GetByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "dogs", pet.Category.Name)
+
+		require.NoError(t, storages.Pet.UpdatePetByModel(ctx, pet, models.Pet{Name: "Rex", Category: models.Category{Name: "cats"}}))
+		pet, err = storages.Pet.GetByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "cats", pet.Category.Name)
+		assert.Equal(t, pet.Category.ID, pet.CategoryID)
+		assert.Equal(t, 3, pet.Version)
+	})
+}
+
+// Слияние и удаление категорий и тегов меняют питомцев, поэтому старый ETag питомца перестаёт подходить
+func TestPets_VersionBumpedByCategoryAndTagChanges(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storages *Storages) {
+		ctx := context.Background()
+
+		require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{
+			Name:     "Rex",
+			Status:   "available",
+			Category: models.Category{Name: "dogs"},
+			Tags:     []models.Tag{{Name: "big"}, {Name: "friendly"}},
+		}))
+		require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{Name: "Tom", Status: "available", Category: models.Category{Name: "cats"}}))
+
+		dogs, err := storages.Category.GetByName(ctx, "dogs")
+		require.NoError(t, err)
+		hounds, err := storages.Category.Create(ctx, models.Category{Name: "hounds"})
+		require.NoError(t, err)
+		big, err := storages.Tag.GetByName(ctx, "big")
+		require.NoError(t, err)
+		friendly, err := storages.Tag.GetByName(ctx, "friendly")
+		require.NoError(t, err)
+
+		changes := map[string]func() error{
+			"merge category": func() error { return storages.Category.Merge(ctx, dogs, hounds) },
+			"merge tag":      func() error { return storages.Tag.Merge(ctx, big, friendly) },
+			"delete tag":     func() error { return storages.Tag.Delete(ctx, friendly) },
+		}
+		for _, name := range []string{"merge category", "merge tag", "delete tag"} {
+			pet, err := storages.Pet.GetByID(ctx, 1)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPut, "/pet", nil)
+			r.Header.Set("If-Match", etag.Format(pet.Version))
+			require.NoError(t, etag.Check(r, pet.Version))
+
+			require.NoError(t, changes[name](), name)
+
+			pet, err = storages.Pet.GetByID(ctx, 1)
+			require.NoError(t, err)
+			assert.ErrorIs(t, etag.Check(r, pet.Version), etag.ErrMismatch, name)
+		}
+
+		other, err := storages.Pet.GetByID(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, other.Version, "Питомцы без этих категорий и тегов не меняются")
+	})
+}
+
+func TestMemoryUsers_DeleteUser(t *testing.T) {
+	storages := newMemoryStorages(t)
+	ctx := context.Background()
+
+	require.NoError(t, storages.User.Create(ctx, models.User{Username: "alice"}))
+
+	user, err := storages.User.GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleCustomer, user.Role)
+	assert.Equal(t, 1, user.Version)
+
+	assert.ErrorIs(t, storages.User.DeleteUser(ctx, models.User{ID: user.ID, Version: 5}), etag.ErrMismatch)
+	require.NoError(t, storages.User.DeleteUser(ctx, user))
+
+	// пользователь помечен удалённым и больше не находится по имени
+	user, err = storages.User.GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Zero(t, user.ID)
+
+	_, err = storages.Store.UserIDByName(ctx, "alice")
+	assert.ErrorIs(t, err, store.ErrUserNotFound)
+
+	deleted, err := storages.User.GetDeletedByUsername(ctx, "alice")
+	require.NoError(t, err)
+	require.NoError(t, storages.User.RestoreUser(ctx, deleted))
+
+	user, err = storages.User.GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 3, user.Version)
+
+	_, err = storages.User.GetDeletedByUsername(ctx, "alice")
+	assert.ErrorIs(t, err, users.ErrUserNotFound)
+}
+
+func TestMemoryUsers_UserTokens(t *testing.T) {
+	storages := newMemoryStorages(t)
+	ctx := context.Background()
+
+	require.NoError(t, storages.User.Create(ctx, models.User{Username: "alice", Email: "alice@example.com"}))
+	user, err := storages.User.GetByEmail(ctx, "alice@example.com")
+	require.NoError(t, err)
+
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, storages.User.CreateUserToken(ctx, models.UserToken{UserID: user.ID, Purpose: models.TokenVerifyEmail, TokenHash: "old", Email: user.Email, ExpiresAt: expires}))
+	require.NoError(t, storages.User.CreateUserToken(ctx, models.UserToken{UserID: user.ID, Purpose: models.TokenVerifyEmail, TokenHash: "new", Email: user.Email, ExpiresAt: expires}))
+
+	// действует только последний токен, и только для своего назначения и один раз
+	_, err = storages.User.ConsumeUserToken(ctx, models.TokenVerifyEmail, "old")
+	assert.ErrorIs(t, err, users.ErrUserTokenInvalid)
+	_, err = storages.User.ConsumeUserToken(ctx, models.TokenResetPassword, "new")
+	assert.ErrorIs(t, err, users.ErrUserTokenInvalid)
+
+	token, err := storages.User.ConsumeUserToken(ctx, models.TokenVerifyEmail, "new")
+	require.NoError(t, err)
+	_, err = storages.User.ConsumeUserToken(ctx, models.TokenVerifyEmail, "new")
+	assert.ErrorIs(t, err, users.ErrUserTokenInvalid)
+
+	require.NoError(t, storages.User.MarkEmailVerified(ctx, token.UserID, token.Email))
+	user, err = storages.User.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+
+	// новый адрес снова требует подтверждения, а письмо на старый уже не подходит
+	require.NoError(t, storages.User.UpdateUser(ctx, user, models.User{Email: "alice@example.org"}))
+	user, err = storages.User.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+	assert.ErrorIs(t, storages.User.MarkEmailVerified(ctx, token.UserID, token.Email), users.ErrUserTokenInvalid)
+
+	require.NoError(t, storages.User.CreateRefreshToken(ctx, models.RefreshToken{UserID: user.ID, TokenHash: "refresh", ExpiresAt: expires}))
+	require.NoError(t, storages.User.ResetPassword(ctx, user.ID, "hash"))
+	_, err = storages.User.RotateRefreshToken(ctx, "refresh", models.RefreshToken{TokenHash: "next", ExpiresAt: expires})
+	assert.ErrorIs(t, err, users.ErrRefreshTokenReused)
+}
+
+func TestMemoryUsers_TOTP(t *testing.T) {
+	storages := newMemoryStorages(t)
+	ctx := context.Background()
+
+	_, err := storages.User.GetTOTP(ctx, 1)
+	assert.ErrorIs(t, err, users.ErrTOTPNotFound)
+
+	require.NoError(t, storages.User.SaveTOTP(ctx, models.UserTOTP{UserID: 1, Secret: "first"}))
+	require.NoError(t, storages.User.SaveTOTP(ctx, models.UserTOTP{UserID: 1, Secret: "second"}))
+	require.NoError(t, storages.User.ConfirmTOTP(ctx, 1, 100, []string{"a", "b"}))
+	assert.ErrorIs(t, storages.User.ConfirmTOTP(ctx, 1, 101, nil), users.ErrTOTPNotFound, "Подтверждённый секрет повторно не подтверждается")
+
+	totp, err := storages.User.GetTOTP(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "second", totp.Secret)
+	assert.NotNil(t, totp.ConfirmedAt)
+
+	// код шага подтверждения и более ранних шагов повторно не принимается
+	assert.ErrorIs(t, storages.User.UseTOTPStep(ctx, 1, 100), users.ErrTOTPCodeReused)
+	require.NoError(t, storages.User.UseTOTPStep(ctx, 1, 101))
+
+	require.NoError(t, storages.User.UseRecoveryCode(ctx, 1, "a"))
+	assert.ErrorIs(t, storages.User.UseRecoveryCode(ctx, 1, "a"), users.ErrRecoveryCodeInvalid)
+	assert.ErrorIs(t, storages.User.UseRecoveryCode(ctx, 2, "b"), users.ErrRecoveryCodeInvalid)
+
+	require.NoError(t, storages.User.ReplaceRecoveryCodes(ctx, 1, []string{"c"}))
+	assert.ErrorIs(t, storages.User.UseRecoveryCode(ctx, 1, "b"), users.ErrRecoveryCodeInvalid)
+
+	require.NoError(t, storages.User.DeleteTOTP(ctx, 1))
+	_, err = storages.User.GetTOTP(ctx, 1)
+	assert.ErrorIs(t, err, users.ErrTOTPNotFound)
+	assert.ErrorIs(t, storages.User.UseRecoveryCode(ctx, 1, "c"), users.ErrRecoveryCodeInvalid)
+}
+
+func TestMemoryUsers_APIKeys(t *testing.T) {
+	storages := newMemoryStorages(t)
+	ctx := context.Background()
+
+	first, err := storages.User.CreateAPIKey(ctx, models.APIKey{UserID: 1, Name: "scanner", KeyHash: "a"})
+	require.NoError(t, err)
+	_, err = storages.User.CreateAPIKey(ctx, models.APIKey{UserID: 1, Name: "copy", KeyHash: "a"})
+	assert.ErrorIs(t, err, memdb.ErrDuplicate)
+	second, err := storages.User.CreateAPIKey(ctx, models.APIKey{UserID: 1, Name: "export", KeyHash: "b"})
+	require.NoError(t, err)
+
+	key, err := storages.User.GetAPIKeyByHash(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, key.ID)
+
+	usedAt := time.Now()
+	require.NoError(t, storages.User.TouchAPIKey(ctx, first.ID, usedAt))
+
+	assert.ErrorIs(t, storages.User.RevokeAPIKey(ctx, 2, first.ID), users.ErrAPIKeyNotFound, "Чужой ключ не отзывается")
+	require.NoError(t, storages.User.RevokeAPIKey(ctx, 1, second.ID))
+	assert.ErrorIs(t, storages.User.RevokeAPIKey(ctx, 1, second.ID), users.ErrAPIKeyNotFound)
+
+	_, err = storages.User.GetAPIKeyByHash(ctx, "b")
+	assert.ErrorIs(t, err, users.ErrAPIKeyNotFound)
+
+	keys, err := storages.User.ListAPIKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "scanner", keys[0].Name)
+	assert.Equal(t, usedAt, *keys[0].LastUsedAt)
+}
+
+func TestMemoryStore_CreateOrder(t *testing.T) {
+	storages := newMemoryStorages(t)
+	ctx := context.Background()
+
+	err := storages.Store.CreateOrder(ctx, models.Order{PetID: 1, Status: "placed"})
+	assert.ErrorIs(t, err, store.ErrPetNotFound)
+
+	require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{Name: "Rex", Status: "available", Category: models.Category{Name: "dogs"}}))
+	require.NoError(t, storages.Store.CreateOrder(ctx, models.Order{PetID: 1, Status: "placed"}))
+
+	err = storages.Store.CreateOrder(ctx, models.Order{PetID: 1, Status: "placed"})
+	assert.ErrorIs(t, err, store.ErrPetUnavailable)
+
+	pet, err := storages.Pet.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "pending", pet.Status)
+	assert.Equal(t, 2, pet.Version)
+
+	history, err := storages.Store.GetHistory(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	require.NoError(t, storages.Store.DeleteOrder(ctx, 1, 1, true))
+
+	pet, err = storages.Pet.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "available", pet.Status, "Удаление заказа должно снять резерв")
+}
+
+// newOrder создаёт питомца и оформляет на него заказ покупателя; возвращает ID заказа
+func newOrder(t *testing.T, storages *Storages, orders *storeService.StoreService, pet string) string {
+	ctx := context.Background()
+
+	require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{Name: pet, Status: "available", Category: models.Category{Name: pet}}))
+	created, err := storages.Pet.GetByName(ctx, pet)
+	require.NoError(t, err)
+
+	require.NoError(t, orders.CreateOrder(ctx, models.Order{PetID: created.ID, Status: "placed"}, ""))
+
+	page, err := orders.ListOrders(ctx, models.OrderListForm{PetID: created.ID})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+
+	return strconv.Itoa(page.Orders[0].ID)
+}
+
+func petStatus(t *testing.T, storages *Storages, orders *storeService.StoreService, orderID string) string {
+	order, err := orders.GetByID(context.Background(), orderID)
+	require.NoError(t, err)
+
+	pet, err := storages.Pet.GetByID(context.Background(), order.PetID)
+	require.NoError(t, err)
+
+	return pet.Status
+}
+
+func transition(t *testing.T, orders *storeService.StoreService, orderID string, status string) {
+	order, err := orders.GetByID(context.Background(), orderID)
+	require.NoError(t, err)
+
+	_, err = orders.TransitionOrder(context.Background(), orderID, order.Version, models.OrderStatusForm{Status: status})
+	require.NoError(t, err)
+}
+
+func TestStore_Reservation(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storages *Storages) {
+		ctx := context.Background()
+		orders := storeService.NewStoreService(storages.Store)
+
+		t.Run("pet already reserved", func(t *testing.T) {
+			orderID := newOrder(t, storages, orders, "Rex")
+			order, err := orders.GetByID(ctx, orderID)
+			require.NoError(t, err)
+
+			err = orders.CreateOrder(ctx, models.Order{PetID: order.PetID, Status: "placed"}, "")
+			assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+			assert.ErrorIs(t, err, store.ErrPetUnavailable)
+		})
+
+		t.Run("delivered order sells pet", func(t *testing.T) {
+			orderID := newOrder(t, storages, orders, "Max")
+			for _, status := range []string{"approved", "shipped"} {
+				transition(t, orders, orderID, status)
+				assert.Equal(t, "pending", petStatus(t, storages, orders, orderID), "Питомец остаётся в резерве в статусе %s", status)
+			}
+
+			transition(t, orders, orderID, "delivered")
+			assert.Equal(t, "sold", petStatus(t, storages, orders, orderID))
+		})
+
+		t.Run("cancelled order releases pet", func(t *testing.T) {
+			orderID := newOrder(t, storages, orders, "Bob")
+			transition(t, orders, orderID, "approved")
+			transition(t, orders, orderID, "cancelled")
+			assert.Equal(t, "available", petStatus(t, storages, orders, orderID))
+		})
+
+		t.Run("deleted order releases pet", func(t *testing.T) {
+			orderID := newOrder(t, storages, orders, "Ace")
+			order, err := orders.GetByID(ctx, orderID)
+			require.NoError(t, err)
+
+			require.NoError(t, orders.DeleteOrder(ctx, orderID, order.Version))
+
+			pet, err := storages.Pet.GetByID(ctx, order.PetID)
+			require.NoError(t, err)
+			assert.Equal(t, "available", pet.Status)
+		})
+
+		t.Run("processed order is not deleted", func(t *testing.T) {
+			orderID := newOrder(t, storages, orders, "Leo")
+			transition(t, orders, orderID, "approved")
+			order, err := orders.GetByID(ctx, orderID)
+			require.NoError(t, err)
+
+			err = orders.DeleteOrder(ctx, orderID, order.Version)
+			assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+
+			history, err := orders.OrderHistory(ctx, orderID)
+			require.NoError(t, err)
+			assert.Len(t, history, 2, "История обработанного заказа должна сохраниться")
+			assert.Equal(t, "pending", petStatus(t, storages, orders, orderID))
+		})
+	})
+}
+
+func TestStore_OrdersOfReregisteredUser(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storages *Storages) {
+		ctx := context.Background()
+		orders := storeService.NewStoreService(storages.Store)
+
+		order := func(pet string) {
+			require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{Name: pet, Status: "available", Category: models.Category{Name: pet}}))
+			created, err := storages.Pet.GetByName(ctx, pet)
+			require.NoError(t, err)
+			require.NoError(t, orders.CreateOrder(ctx, models.Order{PetID: created.ID, Status: "placed"}, "alice"))
+		}
+
+		require.NoError(t, storages.User.Create(ctx, models.User{Username: "alice"}))
+		oldUser, err := storages.User.GetByUsername(ctx, "alice")
+		require.NoError(t, err)
+		order("Rex")
+
+		require.NoError(t, storages.User.DeleteUser(ctx, oldUser))
+		require.NoError(t, storages.User.Create(ctx, models.User{Username: "alice"}))
+		newUser, err := storages.User.GetByUsername(ctx, "alice")
+		require.NoError(t, err)
+		require.NotEqual(t, oldUser.ID, newUser.ID)
+		order("Max")
+
+		page, err := orders.UserOrders(ctx, "alice", models.OrderListForm{})
+		require.NoError(t, err)
+		require.Len(t, page.Orders, 1, "Заказы удалённой учётной записи не должны достаться новой")
+		assert.Equal(t, newUser.ID, page.Orders[0].UserID)
+	})
+}
+
+func TestStore_CreateOrderIgnoresServerFields(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storages *Storages) {
+		ctx := context.Background()
+		orders := storeService.NewStoreService(storages.Store)
+
+		require.NoError(t, storages.Pet.CreatePet(ctx, models.Pet{Name: "Rex", Status: "available", Category: models.Category{Name: "dogs"}}))
+
+		forged := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, orders.CreateOrder(ctx, models.Order{
+			ID:        99,
+			PetID:     1,
+			Quantity:  2,
+			Status:    "placed",
+			ShipDate:  "2000-01-01T00:00:00Z",
+			Complete:  true,
+			Version:   7,
+			UserID:    5,
+			CreatedAt: forged,
+		}, ""))
+
+		page, err := orders.ListOrders(ctx, models.OrderListForm{})
+		require.NoError(t, err)
+		require.Len(t, page.Orders, 1)
+
+		order := page.Orders[0]
+		assert.Equal(t, 1, order.ID)
+		assert.Equal(t, 2, order.Quantity)
+		assert.Empty(t, order.ShipDate)
+		assert.False(t, order.Complete)
+		assert.Equal(t, 1, order.Version)
+		assert.Zero(t, order.UserID)
+		assert.WithinDuration(t, time.Now(), order.CreatedAt, time.Minute)
+	})
+}
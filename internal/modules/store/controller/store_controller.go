@@ -3,6 +3,8 @@ package controller
 import (
 	"net/http"
 
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/middleware"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/service"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
@@ -23,6 +25,10 @@ type Storer interface {
 	Inventory(w http.ResponseWriter, r *http.Request)
 	GetOrder(w http.ResponseWriter, r *http.Request)
 	DeleteOrder(w http.ResponseWriter, r *http.Request)
+	TransitionOrder(w http.ResponseWriter, r *http.Request)
+	OrderHistory(w http.ResponseWriter, r *http.Request)
+	ListOrders(w http.ResponseWriter, r *http.Request)
+	UserOrders(w http.ResponseWriter, r *http.Request)
 }
 
 type Store struct {
@@ -46,15 +52,15 @@ func (s *Store) Order(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.service.StatusCheck(req.Status)
+	err = s.service.NewOrderCheck(&req)
 	if err != nil {
-		s.Responder.ErrorBadRequest(w, err)
+		s.Responder.Error(w, err)
 		return
 	}
 
-	err = s.service.CreateOrder(r.Context(), req)
+	err = s.service.CreateOrder(r.Context(), req, middleware.Username(r.Context()))
 	if err != nil {
-		s.Responder.ErrorBadRequest(w, err)
+		s.Responder.Error(w, err)
 		return
 	}
 
@@ -69,7 +75,7 @@ func (s *Store) Order(w http.ResponseWriter, r *http.Request) {
 func (s *Store) Inventory(w http.ResponseWriter, r *http.Request) {
 	inventory, err := s.service.Inventory(r.Context())
 	if err != nil {
-		s.Responder.ErrorBadRequest(w, err)
+		s.Responder.Error(w, err)
 		return
 	}
 
@@ -81,19 +87,44 @@ func (s *Store) GetOrder(w http.ResponseWriter, r *http.Request) {
 
 	order, err := s.service.GetByID(r.Context(), orderID)
 	if err != nil {
-		s.Responder.ErrorBadRequest(w, err)
+		s.Responder.Error(w, err)
+		return
+	}
+
+	err = s.checkAccess(r, order)
+	if err != nil {
+		s.Responder.Error(w, err)
 		return
 	}
 
+	etag.Set(w, order.Version)
 	s.OutputJSON(w, order)
 }
 
 func (s *Store) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	orderID := s.service.URLParam(r, "orderId")
 
-	err := s.service.DeleteOrder(r.Context(), orderID)
+	order, err := s.service.GetByID(r.Context(), orderID)
 	if err != nil {
-		s.Responder.ErrorBadRequest(w, err)
+		s.Responder.Error(w, err)
+		return
+	}
+
+	err = s.checkAccess(r, order)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	err = etag.Check(r, order.Version)
+	if err != nil {
+		s.Responder.ErrorPrecondition(w, err)
+		return
+	}
+
+	err = s.service.DeleteOrder(r.Context(), orderID, order.Version)
+	if err != nil {
+		s.Responder.Error(w, err)
 		return
 	}
 
@@ -104,3 +135,100 @@ func (s *Store) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 		},
 	})
 }
+
+func (s *Store) TransitionOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := s.service.URLParam(r, "orderId")
+
+	var req models.OrderStatusForm
+	err := s.service.Decode(r.Body, &req)
+	if err != nil {
+		s.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	order, err := s.service.GetByID(r.Context(), orderID)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	err = etag.Check(r, order.Version)
+	if err != nil {
+		s.Responder.ErrorPrecondition(w, err)
+		return
+	}
+
+	order, err = s.service.TransitionOrder(r.Context(), orderID, order.Version, req)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	etag.Set(w, order.Version)
+	s.OutputJSON(w, order)
+}
+
+func (s *Store) OrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderID := s.service.URLParam(r, "orderId")
+
+	order, err := s.service.GetByID(r.Context(), orderID)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	err = s.checkAccess(r, order)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	history, err := s.service.OrderHistory(r.Context(), orderID)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	s.OutputJSON(w, history)
+}
+
+// checkAccess проверяет, что пользователь из токена может работать с заказом
+func (s *Store) checkAccess(r *http.Request, order models.OrderResponse) error {
+	return s.service.CheckAccess(r.Context(), order, middleware.Username(r.Context()), middleware.Role(r.Context()))
+}
+
+func (s *Store) ListOrders(w http.ResponseWriter, r *http.Request) {
+	var query models.OrderListForm
+
+	err := s.service.DecodeURl(&query, r.URL.Query())
+	if err != nil {
+		s.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	orders, err := s.service.ListOrders(r.Context(), query)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	s.OutputJSON(w, orders)
+}
+
+func (s *Store) UserOrders(w http.ResponseWriter, r *http.Request) {
+	var query models.OrderListForm
+
+	err := s.service.DecodeURl(&query, r.URL.Query())
+	if err != nil {
+		s.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	orders, err := s.service.UserOrders(r.Context(), s.service.URLParam(r, "username"), query)
+	if err != nil {
+		s.Responder.Error(w, err)
+		return
+	}
+
+	s.OutputJSON(w, orders)
+}
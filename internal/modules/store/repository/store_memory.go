@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+// StoreMemory - StoreRepository поверх memdb. Питомцы берутся из общих таблиц,
+// поэтому резервирование работает так же, как в базе
+type StoreMemory struct {
+	db *memdb.DB
+}
+
+func NewStoreMemory(db *memdb.DB) *StoreMemory {
+	return &StoreMemory{
+		db: db,
+	}
+}
+
+// CreateOrder резервирует питомца под заказ, переводя его из available в pending
+func (s *StoreMemory) CreateOrder(ctx context.Context, order models.Order) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	pet, ok := s.db.Pets[order.PetID]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrPetNotFound, order.PetID)
+	}
+
+	if pet.Status != petAvailable {
+		return fmt.Errorf("%w: pet with ID %d is %s", ErrPetUnavailable, pet.ID, pet.Status)
+	}
+
+	s.setPetStatus(pet, petPending)
+
+	order.ID = s.db.NextID("orders")
+	order.Pet = models.Pet{}
+	if order.Version == 0 {
+		order.Version = 1
+	}
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+	s.db.Orders[order.ID] = order
+
+	s.addTransition(models.OrderTransition{
+		OrderID:  order.ID,
+		ToStatus: order.Status,
+	})
+
+	return nil
+}
+
+func (s *StoreMemory) GetByID(ctx context.Context, id int) (models.Order, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	order, ok := s.db.Orders[id]
+	if !ok {
+		return models.Order{}, gorm.ErrRecordNotFound
+	}
+
+	return order, nil
+}
+
+func (s *StoreMemory) FindOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, int64, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	ids := memdb.IDs(s.db.Orders)
+	if filter.Desc {
+		for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+	}
+
+	var orders []models.Order
+	var total int64
+	for _, id := range ids {
+		order := s.db.Orders[id]
+		if !orderMatches(order, filter) {
+			continue
+		}
+		total++
+
+		if filter.AfterID != 0 && !afterCursor(order.ID, filter) {
+			continue
+		}
+		if filter.Limit > 0 && len(orders) == filter.Limit {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, total, nil
+}
+
+func afterCursor(id int, filter models.OrderFilter) bool {
+	if filter.Desc {
+		return id < filter.AfterID
+	}
+	return id > filter.AfterID
+}
+
+func orderMatches(order models.Order, filter models.OrderFilter) bool {
+	if len(filter.Statuses) > 0 {
+		found := false
+		for _, status := range filter.Statuses {
+			if order.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.PetID != 0 && order.PetID != filter.PetID {
+		return false
+	}
+
+	if filter.UserID != 0 && order.UserID != filter.UserID {
+		return false
+	}
+
+	if filter.From != nil && order.CreatedAt.Before(*filter.From) {
+		return false
+	}
+
+	if filter.To != nil && !order.CreatedAt.Before(*filter.To) {
+		return false
+	}
+
+	return true
+}
+
+func (s *StoreMemory) UserIDByName(ctx context.Context, username string) (int, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, id := range memdb.IDs(s.db.Users) {
+		user := s.db.Users[id]
+		if user.Username == username && user.UserStatus == 0 {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+}
+
+func (s *StoreMemory) DeleteOrder(ctx context.Context, id int, version int, releasePet bool) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	order, ok := s.db.Orders[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if order.Version != version {
+		return etag.ErrMismatch
+	}
+
+	for transitionID, transition := range s.db.Transitions {
+		if transition.OrderID == id {
+			delete(s.db.Transitions, transitionID)
+		}
+	}
+	delete(s.db.Orders, id)
+
+	if !releasePet {
+		return nil
+	}
+
+	pet, ok := s.db.Pets[order.PetID]
+	if ok && pet.Status == petPending {
+		s.setPetStatus(pet, petAvailable)
+	}
+
+	return nil
+}
+
+// TransitionOrder меняет статус заказа и записывает переход в историю.
+// Если petStatus не пустой, питомец заказа переводится в этот статус
+func (s *StoreMemory) TransitionOrder(ctx context.Context, order models.Order, transition models.OrderTransition, petStatus string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	var pet models.Pet
+	if petStatus != "" {
+		var ok bool
+		pet, ok = s.db.Pets[order.PetID]
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrPetNotFound, order.PetID)
+		}
+	}
+
+	existing, ok := s.db.Orders[order.ID]
+	if !ok || existing.Version != order.Version {
+		return etag.ErrMismatch
+	}
+
+	if petStatus != "" && pet.Status != petStatus {
+		s.setPetStatus(pet, petStatus)
+	}
+
+	existing.Status = order.Status
+	existing.ShipDate = order.ShipDate
+	existing.Complete = order.Complete
+	existing.Version = order.Version + 1
+	s.db.Orders[order.ID] = existing
+
+	transition.OrderID = order.ID
+	s.addTransition(transition)
+
+	return nil
+}
+
+func (s *StoreMemory) GetHistory(ctx context.Context, orderID int) ([]models.OrderTransition, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var history []models.OrderTransition
+	for _, id := range memdb.IDs(s.db.Transitions) {
+		if s.db.Transitions[id].OrderID == orderID {
+			history = append(history, s.db.Transitions[id])
+		}
+	}
+
+	return history, nil
+}
+
+func (s *StoreMemory) Inventory(ctx context.Context) (models.PetsStatuses, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var statuses models.PetsStatuses
+	for _, pet := range s.db.Pets {
+		switch pet.Status {
+		case "available":
+			statuses.Available++
+		case "pending":
+			statuses.Pending++
+		case "sold":
+			statuses.Sold++
+		}
+	}
+
+	return statuses, nil
+}
+
+// setPetStatus меняет статус питомца и увеличивает его версию, чтобы выданные ETag стали недействительны
+func (s *StoreMemory) setPetStatus(pet models.Pet, status string) {
+	pet.Status = status
+	pet.Version++
+	s.db.Pets[pet.ID] = pet
+}
+
+func (s *StoreMemory) addTransition(transition models.OrderTransition) {
+	transition.ID = s.db.NextID("order_transitions")
+	if transition.CreatedAt.IsZero() {
+		transition.CreatedAt = time.Now()
+	}
+	s.db.Transitions[transition.ID] = transition
+}
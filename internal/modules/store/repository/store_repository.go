@@ -6,13 +6,33 @@ import (
 	"fmt"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 )
 
+const (
+	petAvailable = "available"
+	petPending   = "pending"
+)
+
+var (
+	ErrPetNotFound    = errors.New("pet does not exist")
+	ErrPetUnavailable = errors.New("pet is not available")
+	ErrUserNotFound   = errors.New("user does not exist")
+	// ErrOrderNotFound возвращает GetByID; in-memory реализация отдаёт ту же ошибку, что и GORM
+	ErrOrderNotFound = gorm.ErrRecordNotFound
+)
+
 type StoreRepository interface {
 	CreateOrder(ctx context.Context, order models.Order) error
 	GetByID(ctx context.Context, id int) (models.Order, error)
-	DeleteOrder(ctx context.Context, id int) error
+	FindOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, int64, error)
+	UserIDByName(ctx context.Context, username string) (int, error)
+	DeleteOrder(ctx context.Context, id int, version int, releasePet bool) error
+
+	TransitionOrder(ctx context.Context, order models.Order, transition models.OrderTransition, petStatus string) error
+	GetHistory(ctx context.Context, orderID int) ([]models.OrderTransition, error)
 
 	Inventory(ctx context.Context) (models.PetsStatuses, error)
 }
@@ -27,22 +47,34 @@ func NewStoreStorage(adapter *gorm.DB) *StoreStorage {
 	}
 }
 
+// CreateOrder резервирует питомца под заказ: питомец блокируется на время транзакции
+// и переводится из available в pending
 func (s *StoreStorage) CreateOrder(ctx context.Context, order models.Order) error {
-	var pet models.Pet
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		pet, err := lockPet(tx, order.PetID)
+		if err != nil {
+			return err
+		}
 
-	err := s.adapter.WithContext(ctx).First(&pet, order.PetID).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("pet with ID %d does not exist", order.PetID)
+		if pet.Status != petAvailable {
+			return fmt.Errorf("%w: pet with ID %d is %s", ErrPetUnavailable, pet.ID, pet.Status)
 		}
-		return err
-	}
 
-	order.Pet = pet
+		err = setPetStatus(tx, pet.ID, petPending)
+		if err != nil {
+			return err
+		}
 
-	err = s.adapter.WithContext(ctx).Create(&order).Error
+		err = tx.Omit(clause.Associations).Create(&order).Error
+		if err != nil {
+			return err
+		}
 
-	return err
+		return tx.Create(&models.OrderTransition{
+			OrderID:  order.ID,
+			ToStatus: order.Status,
+		}).Error
+	})
 }
 
 func (s *StoreStorage) GetByID(ctx context.Context, id int) (models.Order, error) {
@@ -56,50 +88,213 @@ func (s *StoreStorage) GetByID(ctx context.Context, id int) (models.Order, error
 	return existingOrder, err
 }
 
-func (s *StoreStorage) DeleteOrder(ctx context.Context, id int) error {
-	order, err := s.GetByID(ctx, id)
+func (s *StoreStorage) FindOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, int64, error) {
+	var orders []models.Order
+	var total int64
+
+	query := s.adapter.WithContext(ctx).Model(&models.Order{})
+
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+
+	if filter.PetID != 0 {
+		query = query.Where("pet_id = ?", filter.PetID)
+	}
+
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	query = query.Session(&gorm.Session{})
+
+	err := query.Count(&total).Error
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	err = s.adapter.Delete(&order).Error
+	direction, compare := "ASC", ">"
+	if filter.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	page := query
+	if filter.AfterID != 0 {
+		page = page.Where("id "+compare+" ?", filter.AfterID)
+	}
 
-	return err
+	err = page.
+		Order("id " + direction).
+		Limit(filter.Limit).
+		Find(&orders).Error
+
+	return orders, total, err
 }
 
-func (s *StoreStorage) Inventory(ctx context.Context) (models.PetsStatuses, error) {
-	var statuses models.PetsStatuses
-	var count int64
+// UserIDByName ищет только действующих пользователей: имя удалённого может занять новый
+func (s *StoreStorage) UserIDByName(ctx context.Context, username string) (int, error) {
+	var user models.User
 
 	err := s.adapter.WithContext(ctx).
-		Model(&models.Pet{}).
-		Where("status = ?", "available").
-		Count(&count).Error
-	if err != nil {
-		return models.PetsStatuses{}, err
+		Select("id").
+		Where("username = ? AND user_status = ?", username, 0).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("%w: %s", ErrUserNotFound, username)
 	}
 
-	statuses.Available = int(count)
+	return user.ID, err
+}
 
-	err = s.adapter.WithContext(ctx).
-		Model(&models.Pet{}).
-		Where("status = ?", "pending").
-		Count(&count).Error
+// DeleteOrder удаляет заказ вместе с историей. Если releasePet, резерв питомца снимается
+func (s *StoreStorage) DeleteOrder(ctx context.Context, id int, version int, releasePet bool) error {
+	order, err := s.GetByID(ctx, id)
 	if err != nil {
-		return models.PetsStatuses{}, err
+		return err
+	}
+
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderTransition{}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("version = ?", version).Delete(&order)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return etag.ErrMismatch
+		}
+
+		if !releasePet {
+			return nil
+		}
+
+		pet, err := lockPet(tx, order.PetID)
+		if errors.Is(err, ErrPetNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if pet.Status != petPending {
+			return nil
+		}
+
+		return setPetStatus(tx, pet.ID, petAvailable)
+	})
+}
+
+// TransitionOrder меняет статус заказа и записывает переход в историю.
+// Если petStatus не пустой, питомец заказа в той же транзакции переводится в этот статус
+func (s *StoreStorage) TransitionOrder(ctx context.Context, order models.Order, transition models.OrderTransition, petStatus string) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if petStatus != "" {
+			pet, err := lockPet(tx, order.PetID)
+			if err != nil {
+				return err
+			}
+
+			if pet.Status != petStatus {
+				err = setPetStatus(tx, pet.ID, petStatus)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND version = ?", order.ID, order.Version).
+			Updates(map[string]interface{}{
+				"status":    order.Status,
+				"ship_date": order.ShipDate,
+				"complete":  order.Complete,
+				"version":   order.Version + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return etag.ErrMismatch
+		}
+
+		transition.OrderID = order.ID
+		return tx.Create(&transition).Error
+	})
+}
+
+func (s *StoreStorage) GetHistory(ctx context.Context, orderID int) ([]models.OrderTransition, error) {
+	var history []models.OrderTransition
+
+	err := s.adapter.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("id").
+		Find(&history).Error
+
+	return history, err
+}
+
+// lockPet читает питомца с блокировкой строки до конца транзакции
+func lockPet(tx *gorm.DB, id int) (models.Pet, error) {
+	var pet models.Pet
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pet, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Pet{}, fmt.Errorf("%w: %d", ErrPetNotFound, id)
 	}
 
-	statuses.Pending = int(count)
+	return pet, err
+}
+
+// setPetStatus меняет статус питомца и увеличивает его версию, чтобы выданные ETag стали недействительны
+func setPetStatus(tx *gorm.DB, id int, status string) error {
+	return tx.Model(&models.Pet{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":  status,
+			"version": gorm.Expr("version + 1"),
+		}).Error
+}
+
+// Inventory считает питомцев по статусам одним запросом
+func (s *StoreStorage) Inventory(ctx context.Context) (models.PetsStatuses, error) {
+	var statuses models.PetsStatuses
+	var counts []struct {
+		Status string
+		Count  int
+	}
 
-	err = s.adapter.WithContext(ctx).
+	err := s.adapter.WithContext(ctx).
 		Model(&models.Pet{}).
-		Where("status = ?", "sold").
-		Count(&count).Error
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&counts).Error
 	if err != nil {
 		return models.PetsStatuses{}, err
 	}
 
-	statuses.Sold = int(count)
+	for _, row := range counts {
+		switch row.Status {
+		case "available":
+			statuses.Available = row.Count
+		case "pending":
+			statuses.Pending = row.Count
+		case "sold":
+			statuses.Sold = row.Count
+		}
+	}
 
 	return statuses, nil
 }
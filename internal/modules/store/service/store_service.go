@@ -2,29 +2,91 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
-	"strconv"
+	"net/url"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-playground/form"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/repository"
 )
 
 type Storer interface {
-	CreateOrder(ctx context.Context, order models.Order) error
+	CreateOrder(ctx context.Context, order models.Order, username string) error
 	GetByID(ctx context.Context, id string) (models.OrderResponse, error)
-	DeleteOrder(ctx context.Context, id string) error
+	ListOrders(ctx context.Context, query models.OrderListForm) (models.OrderPage, error)
+	UserOrders(ctx context.Context, username string, query models.OrderListForm) (models.OrderPage, error)
+	DeleteOrder(ctx context.Context, id string, version int) error
 	Inventory(ctx context.Context) (models.PetsStatuses, error)
 
+	TransitionOrder(ctx context.Context, id string, version int, form models.OrderStatusForm) (models.OrderResponse, error)
+	OrderHistory(ctx context.Context, id string) ([]models.OrderTransition, error)
+	CheckAccess(ctx context.Context, order models.OrderResponse, username string, role string) error
+
 	StatusCheck(status string) error
+	NewOrderCheck(order *models.Order) error
 
 	Decode(r io.ReadCloser, data interface{}) error
+	DecodeURl(params interface{}, values url.Values) error
 	URLParam(r *http.Request, param string) string
 }
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	dateLayout = "2006-01-02"
+)
+
+const (
+	statusPlaced    = "placed"
+	statusApproved  = "approved"
+	statusShipped   = "shipped"
+	statusDelivered = "delivered"
+	statusCancelled = "cancelled"
+	statusReturned  = "returned"
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal order status transition")
+	ErrPetUnavailable    = repository.ErrPetUnavailable
+	ErrUserNotFound      = repository.ErrUserNotFound
+
+	errInvalidCursor = apperr.InvalidField("cursor", "invalid_cursor", "invalid cursor")
+	errNotOwner      = apperr.Forbidden("not_owner", "order belongs to another user")
+)
+
+// orderTransitions - допустимые переходы между статусами заказа
+var orderTransitions = map[string][]string{
+	statusPlaced:    {statusApproved, statusCancelled},
+	statusApproved:  {statusShipped, statusCancelled},
+	statusShipped:   {statusDelivered},
+	statusDelivered: {statusReturned},
+	statusCancelled: {},
+	statusReturned:  {},
+}
+
+// reservingStatuses - статусы, в которых заказ держит питомца в резерве (pending)
+var reservingStatuses = map[string]bool{
+	statusPlaced:   true,
+	statusApproved: true,
+	statusShipped:  true,
+}
+
+// petStatuses - статус, в который переходит питомец при переходе заказа в данный статус
+var petStatuses = map[string]string{
+	statusDelivered: "sold",
+	statusCancelled: "available",
+	statusReturned:  "available",
+}
+
 type StoreService struct {
 	storage repository.StoreRepository
 }
@@ -40,17 +102,178 @@ func (s *StoreService) Decode(r io.ReadCloser, data interface{}) error {
 }
 
 func (s StoreService) StatusCheck(status string) error {
-	statuses := []string{"placed", "approved", "delivered"}
-	for _, stat := range statuses {
-		if stat == status {
-			return nil
+	if _, ok := orderTransitions[status]; ok {
+		return nil
+	}
+	return apperr.InvalidField("status", "invalid_status", "invalid status: %s", status)
+}
+
+// NewOrderCheck проверяет поля нового заказа: питомец обязателен, количество не отрицательно,
+// а любой заказ начинается со статуса placed
+func (s *StoreService) NewOrderCheck(order *models.Order) error {
+	var v apperr.Validator
+
+	if order.PetID <= 0 {
+		v.Check("petId", apperr.InvalidField("petId", "required", "petId is required"))
+	}
+
+	if order.Quantity < 0 {
+		v.Check("quantity", apperr.InvalidField("quantity", "invalid_quantity", "invalid quantity: %d", order.Quantity))
+	}
+
+	if order.Status == "" {
+		order.Status = statusPlaced
+	}
+
+	if order.Status != statusPlaced {
+		v.Check("status", apperr.InvalidField("status", "invalid_status", "new orders must have status %s", statusPlaced))
+	}
+
+	return v.Err()
+}
+
+func (s *StoreService) TransitionOrder(ctx context.Context, id string, version int, form models.OrderStatusForm) (models.OrderResponse, error) {
+	intId, err := apperr.ParseID("orderId", id)
+	if err != nil {
+		return models.OrderResponse{}, err
+	}
+
+	err = s.StatusCheck(form.Status)
+	if err != nil {
+		return models.OrderResponse{}, err
+	}
+
+	order, err := s.storage.GetByID(ctx, intId)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		return models.OrderResponse{}, apperr.NotFound("order_not_found", "order with that id does not exist: %v", id)
+	}
+	if err != nil {
+		return models.OrderResponse{}, err
+	}
+
+	if !canTransition(order.Status, form.Status) {
+		return models.OrderResponse{}, apperr.Conflict("illegal_transition", "%w: %s -> %s", ErrIllegalTransition, order.Status, form.Status)
+	}
+
+	transition := models.OrderTransition{
+		FromStatus: order.Status,
+		ToStatus:   form.Status,
+		Comment:    form.Comment,
+	}
+
+	order.Version = version
+	order.Status = form.Status
+	switch form.Status {
+	case statusShipped:
+		if order.ShipDate == "" {
+			order.ShipDate = time.Now().UTC().Format(time.RFC3339)
 		}
+	case statusDelivered:
+		order.Complete = true
+	case statusCancelled:
+		order.Complete = false
+	}
+
+	err = s.storage.TransitionOrder(ctx, order, transition, petStatuses[form.Status])
+	if err != nil {
+		return models.OrderResponse{}, orderError(err)
+	}
+
+	order.Version++
+
+	return OrderFromDB(order), nil
+}
+
+func (s *StoreService) OrderHistory(ctx context.Context, id string) ([]models.OrderTransition, error) {
+	order, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.storage.GetHistory(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if history == nil {
+		history = []models.OrderTransition{}
+	}
+
+	return history, nil
+}
+
+// CheckAccess пропускает к заказу сотрудников и администраторов, остальным - только их собственные заказы
+func (s *StoreService) CheckAccess(ctx context.Context, order models.OrderResponse, username string, role string) error {
+	if role == models.RoleStaff || role == models.RoleAdmin {
+		return nil
+	}
+
+	if username == "" || order.UserID == 0 {
+		return errNotOwner
+	}
+
+	userID, err := s.storage.UserIDByName(ctx, username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return errNotOwner
+	}
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("invalid status: %s", status)
+
+	if userID != order.UserID {
+		return errNotOwner
+	}
+
+	return nil
 }
 
-func (s *StoreService) CreateOrder(ctx context.Context, order models.Order) error {
-	return s.storage.CreateOrder(ctx, order)
+func canTransition(from string, to string) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateOrder создаёт заказ; если известен пользователь из токена, он становится владельцем заказа.
+// От клиента берутся только питомец, количество и статус: ID, дата создания, доставка
+// и завершённость заполняются сервером
+func (s *StoreService) CreateOrder(ctx context.Context, order models.Order, username string) error {
+	order = models.Order{
+		PetID:    order.PetID,
+		Quantity: order.Quantity,
+		Status:   order.Status,
+	}
+
+	if username != "" {
+		userID, err := s.storage.UserIDByName(ctx, username)
+		if err != nil {
+			return orderError(err)
+		}
+		order.UserID = userID
+	}
+
+	return orderError(s.storage.CreateOrder(ctx, order))
+}
+
+// orderError переводит ошибки репозитория заказов в типизированные ошибки для клиента
+func orderError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repository.ErrPetNotFound):
+		return apperr.NotFound("pet_not_found", "%w", err)
+	case errors.Is(err, repository.ErrPetUnavailable):
+		return apperr.Conflict("pet_unavailable", "%w", err)
+	case errors.Is(err, repository.ErrUserNotFound):
+		return apperr.NotFound("user_not_found", "%w", err)
+	}
+	return err
+}
+
+func (s *StoreService) DecodeURl(params interface{}, values url.Values) error {
+	return form.NewDecoder().Decode(params, values)
 }
 
 func (s *StoreService) URLParam(r *http.Request, param string) string {
@@ -58,32 +281,198 @@ func (s *StoreService) URLParam(r *http.Request, param string) string {
 }
 
 func (s *StoreService) GetByID(ctx context.Context, id string) (models.OrderResponse, error) {
-	intId, err := strconv.Atoi(id)
+	intId, err := apperr.ParseID("orderId", id)
 	if err != nil {
 		return models.OrderResponse{}, err
 	}
 
 	dbOrder, err := s.storage.GetByID(ctx, intId)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		return models.OrderResponse{}, apperr.NotFound("order_not_found", "order with that id does not exist: %v", id)
+	}
+
+	return OrderFromDB(dbOrder), err
+}
+
+func OrderFromDB(order models.Order) models.OrderResponse {
+	return models.OrderResponse{
+		ID:        order.ID,
+		PetID:     order.PetID,
+		Quantity:  order.Quantity,
+		ShipDate:  order.ShipDate,
+		Status:    order.Status,
+		Complete:  order.Complete,
+		Version:   order.Version,
+		UserID:    order.UserID,
+		CreatedAt: order.CreatedAt,
+	}
+}
+
+func (s *StoreService) ListOrders(ctx context.Context, query models.OrderListForm) (models.OrderPage, error) {
+	return s.findOrders(ctx, models.OrderFilter{}, query)
+}
+
+func (s *StoreService) UserOrders(ctx context.Context, username string, query models.OrderListForm) (models.OrderPage, error) {
+	userID, err := s.storage.UserIDByName(ctx, username)
+	if err != nil {
+		return models.OrderPage{}, orderError(err)
+	}
+
+	return s.findOrders(ctx, models.OrderFilter{UserID: userID}, query)
+}
+
+func (s *StoreService) findOrders(ctx context.Context, filter models.OrderFilter, query models.OrderListForm) (models.OrderPage, error) {
+	for _, status := range query.Statuses {
+		err := s.StatusCheck(status)
+		if err != nil {
+			return models.OrderPage{}, err
+		}
+	}
+
+	if query.PetID < 0 {
+		return models.OrderPage{}, apperr.InvalidField("petId", "invalid_id", "invalid petId: %d", query.PetID)
+	}
+
+	switch query.Sort {
+	case "", "id":
+	case "-id":
+		filter.Desc = true
+	default:
+		return models.OrderPage{}, apperr.InvalidField("sort", "invalid_sort", "invalid sort: %s", query.Sort)
+	}
+
+	limit := query.Limit
+	switch {
+	case limit < 0:
+		return models.OrderPage{}, apperr.InvalidField("limit", "invalid_limit", "invalid limit: %d", limit)
+	case limit == 0:
+		limit = defaultPageLimit
+	case limit > maxPageLimit:
+		limit = maxPageLimit
+	}
+
+	var err error
+	filter.From, err = parseDate(query.From, false)
+	if err != nil {
+		return models.OrderPage{}, apperr.InvalidField("from", "invalid_date", "invalid from: %s", query.From)
+	}
+
+	filter.To, err = parseDate(query.To, true)
+	if err != nil {
+		return models.OrderPage{}, apperr.InvalidField("to", "invalid_date", "invalid to: %s", query.To)
+	}
+
+	if query.Cursor != "" {
+		filter.AfterID, err = decodeCursor(query.Cursor)
+		if err != nil {
+			return models.OrderPage{}, err
+		}
+	}
+
+	filter.Statuses = query.Statuses
+	filter.PetID = query.PetID
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit = limit + 1
 
-	order := models.OrderResponse{
-		ID:       dbOrder.ID,
-		PetID:    dbOrder.PetID,
-		Quantity: dbOrder.Quantity,
-		ShipDate: dbOrder.ShipDate,
-		Status:   dbOrder.Status,
-		Complete: dbOrder.Complete,
+	orders, total, err := s.storage.FindOrders(ctx, filter)
+	if err != nil {
+		return models.OrderPage{}, err
+	}
+
+	result := models.OrderPage{
+		Orders: []models.OrderResponse{},
+		Total:  total,
+	}
+
+	if len(orders) > limit {
+		orders = orders[:limit]
+		result.NextCursor = encodeCursor(orders[limit-1].ID)
+	}
+
+	for _, order := range orders {
+		result.Orders = append(result.Orders, OrderFromDB(order))
+	}
+
+	return result, nil
+}
+
+// parseDate разбирает границу периода в формате RFC3339 или YYYY-MM-DD.
+// Дата без времени в качестве верхней границы включает весь день
+func parseDate(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return &t, nil
+	}
+
+	t, err = time.Parse(dateLayout, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return &t, nil
+}
+
+type orderCursor struct {
+	ID int `json:"id"`
+}
+
+func encodeCursor(id int) string {
+	data, _ := json.Marshal(orderCursor{ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (int, error) {
+	var cursor orderCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.ID <= 0 {
+		return 0, errInvalidCursor
 	}
 
-	return order, err
+	return cursor.ID, nil
 }
 
-func (s *StoreService) DeleteOrder(ctx context.Context, id string) error {
-	intId, err := strconv.Atoi(id)
+// DeleteOrder удаляет ещё не обработанный заказ и снимает резерв с питомца.
+// Заказы после placed не удаляются, чтобы сохранить историю их статусов
+func (s *StoreService) DeleteOrder(ctx context.Context, id string, version int) error {
+	intId, err := apperr.ParseID("orderId", id)
 	if err != nil {
 		return err
 	}
 
-	err = s.storage.DeleteOrder(ctx, intId)
+	order, err := s.storage.GetByID(ctx, intId)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		return apperr.NotFound("order_not_found", "order with that id does not exist: %v", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if order.Version != version {
+		return etag.ErrMismatch
+	}
+
+	if order.Status != statusPlaced {
+		return apperr.Conflict("order_not_deletable", "only %s orders can be deleted, order is %s", statusPlaced, order.Status)
+	}
+
+	err = s.storage.DeleteOrder(ctx, intId, version, reservingStatuses[order.Status])
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		return apperr.NotFound("order_not_found", "order with that id does not exist: %v", id)
+	}
 
 	return err
 }
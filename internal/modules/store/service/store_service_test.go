@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/store/repository"
+)
+
+func TestCheckAccess(t *testing.T) {
+	db := memdb.New()
+	db.Users[1] = models.User{ID: 1, Username: "owner"}
+	db.Users[2] = models.User{ID: 2, Username: "other"}
+	s := NewStoreService(repository.NewStoreMemory(db))
+
+	order := models.OrderResponse{ID: 1, UserID: 1}
+
+	tests := []struct {
+		name     string
+		order    models.OrderResponse
+		username string
+		role     string
+		allowed  bool
+	}{
+		{name: "owner", order: order, username: "owner", role: models.RoleCustomer, allowed: true},
+		{name: "other customer", order: order, username: "other", role: models.RoleCustomer},
+		{name: "unknown user", order: order, username: "ghost", role: models.RoleCustomer},
+		{name: "staff", order: order, username: "other", role: models.RoleStaff, allowed: true},
+		{name: "admin", order: order, username: "other", role: models.RoleAdmin, allowed: true},
+		{name: "order without owner", order: models.OrderResponse{ID: 2}, username: "owner", role: models.RoleCustomer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CheckAccess(context.Background(), tt.order, tt.username, tt.role)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, apperr.KindForbidden, apperr.KindOf(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"net/http"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/tag/service"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
+)
+
+type Data struct {
+	Message string `json:"message"`
+}
+
+type TagResponse struct {
+	Success   bool `json:"success"`
+	ErrorCode int  `json:"error_code,omitempty"`
+	Data      Data `json:"data"`
+}
+
+type Tagger interface {
+	CreateTag(w http.ResponseWriter, r *http.Request)
+	ListTags(w http.ResponseWriter, r *http.Request)
+	GetTag(w http.ResponseWriter, r *http.Request)
+	RenameTag(w http.ResponseWriter, r *http.Request)
+	MergeTag(w http.ResponseWriter, r *http.Request)
+	DeleteTag(w http.ResponseWriter, r *http.Request)
+}
+
+type Tag struct {
+	service service.Tagger
+	responder.Responder
+}
+
+func NewTag(service service.Tagger, responder responder.Responder) *Tag {
+	return &Tag{
+		service:   service,
+		Responder: responder,
+	}
+}
+
+func (t *Tag) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req models.NameForm
+	err := t.service.Decode(r.Body, &req)
+	if err != nil {
+		t.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	tag, err := t.service.CreateTag(r.Context(), req.Name)
+	if err != nil {
+		t.Responder.Error(w, err)
+		return
+	}
+
+	t.OutputJSON(w, tag)
+}
+
+func (t *Tag) ListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := t.service.ListTags(r.Context())
+	if err != nil {
+		t.Responder.Error(w, err)
+		return
+	}
+
+	t.OutputJSON(w, tags)
+}
+
+func (t *Tag) GetTag(w http.ResponseWriter, r *http.Request) {
+	id := t.service.URLParam(r, "tagId")
+
+	tag, err := t.service.GetTag(r.Context(), id)
+	if err != nil {
+		t.Responder.Error(w, err)
+		return
+	}
+
+	t.OutputJSON(w, tag)
+}
+
+func (t *Tag) RenameTag(w http.ResponseWriter, r *http.Request) {
+	id := t.service.URLParam(r, "tagId")
+
+	var req models.NameForm
+	err := t.service.Decode(r.Body, &req)
+	if err != nil {
+		t.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	tag, err := t.service.RenameTag(r.Context(), id, req.Name)
+	if err != nil {
+		t.Responder.Error(w, err)
+		return
+	}
+
+	t.OutputJSON(w, tag)
+}
+
+func (t *Tag) MergeTag(w http.ResponseWriter, r *http.Request) {
+	id := t.service.URLParam(r, "tagId")
+
+	var req models.MergeForm
+	err := t.service.Decode(r.Body, &req)
+	if err != nil {
+		t.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	err = t.service.MergeTag(r.Context(), id, req.TargetID)
+	if err != nil {
+		t.Responder.Error(w, err)
+		return
+	}
+
+	t.OutputJSON(w, TagResponse{
+		Success: true,
+		Data: Data{
+			Message: "tag merged successfully",
+		},
+	})
+}
+
+func (t *Tag) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	id := t.service.URLParam(r, "tagId")
+
+	err := t.service.DeleteTag(r.Context(), id, r.URL.Query().Get("detach") == "true")
+	if err != nil {
+		t.Responder.Error(w, err)
+		return
+	}
+
+	t.OutputJSON(w, TagResponse{
+		Success: true,
+		Data: Data{
+			Message: "tag deleted successfully",
+		},
+	})
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+// TagMemory - TagRepository поверх memdb
+type TagMemory struct {
+	db *memdb.DB
+}
+
+func NewTagMemory(db *memdb.DB) *TagMemory {
+	return &TagMemory{
+		db: db,
+	}
+}
+
+func (s *TagMemory) Create(ctx context.Context, tag models.Tag) (models.Tag, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	tag.ID = 0
+	err := s.db.SaveTag(&tag)
+
+	return tag, err
+}
+
+func (s *TagMemory) GetByID(ctx context.Context, id int) (models.Tag, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	tag, ok := s.db.Tags[id]
+	if !ok {
+		return models.Tag{}, gorm.ErrRecordNotFound
+	}
+
+	return tag, nil
+}
+
+func (s *TagMemory) GetByName(ctx context.Context, name string) (models.Tag, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	tag, ok := s.db.TagByName(name)
+	if !ok {
+		return models.Tag{}, gorm.ErrRecordNotFound
+	}
+
+	return tag, nil
+}
+
+func (s *TagMemory) List(ctx context.Context) ([]models.Tag, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var tags []models.Tag
+	for _, id := range memdb.IDs(s.db.Tags) {
+		tags = append(tags, s.db.Tags[id])
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+func (s *TagMemory) CountPets(ctx context.Context, tag models.Tag) (int64, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var count int64
+	for _, tagIDs := range s.db.PetTags {
+		if indexOf(tagIDs, tag.ID) >= 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *TagMemory) Rename(ctx context.Context, tag models.Tag, name string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, ok := s.db.Tags[tag.ID]
+	if !ok {
+		return nil
+	}
+
+	if other, ok := s.db.TagByName(name); ok && other.ID != tag.ID {
+		return memdb.ErrDuplicate
+	}
+
+	existing.Name = name
+	s.db.Tags[tag.ID] = existing
+
+	return nil
+}
+
+// Merge перевешивает source на питомцев target и удаляет source.
+// Питомцы, у которых уже были оба тега, остаются с одним target.
+// Версии затронутых питомцев растут, чтобы их старые ETag перестали подходить
+func (s *TagMemory) Merge(ctx context.Context, source models.Tag, target models.Tag) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	if _, ok := s.db.Tags[target.ID]; !ok {
+		return memdb.ErrForeignKey
+	}
+
+	for petID, tagIDs := range s.db.PetTags {
+		i := indexOf(tagIDs, source.ID)
+		if i < 0 {
+			continue
+		}
+		s.bumpPetVersion(petID)
+
+		if indexOf(tagIDs, target.ID) >= 0 {
+			s.db.PetTags[petID] = append(tagIDs[:i:i], tagIDs[i+1:]...)
+			continue
+		}
+
+		merged := append([]int(nil), tagIDs...)
+		merged[i] = target.ID
+		sort.Ints(merged)
+		s.db.PetTags[petID] = merged
+	}
+
+	delete(s.db.Tags, source.ID)
+
+	return nil
+}
+
+// Delete удаляет тег вместе с его привязками к питомцам и поднимает версии этих питомцев
+func (s *TagMemory) Delete(ctx context.Context, tag models.Tag) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	for petID, tagIDs := range s.db.PetTags {
+		i := indexOf(tagIDs, tag.ID)
+		if i >= 0 {
+			s.db.PetTags[petID] = append(tagIDs[:i:i], tagIDs[i+1:]...)
+			s.bumpPetVersion(petID)
+		}
+	}
+
+	delete(s.db.Tags, tag.ID)
+
+	return nil
+}
+
+func (s *TagMemory) bumpPetVersion(petID int) {
+	pet, ok := s.db.Pets[petID]
+	if ok {
+		pet.Version++
+		s.db.Pets[petID] = pet
+	}
+}
+
+func indexOf(ids []int, id int) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+type TagRepository interface {
+	Create(ctx context.Context, tag models.Tag) (models.Tag, error)
+
+	GetByID(ctx context.Context, id int) (models.Tag, error)
+	GetByName(ctx context.Context, name string) (models.Tag, error)
+	List(ctx context.Context) ([]models.Tag, error)
+	CountPets(ctx context.Context, tag models.Tag) (int64, error)
+
+	Rename(ctx context.Context, tag models.Tag, name string) error
+	Merge(ctx context.Context, source models.Tag, target models.Tag) error
+
+	Delete(ctx context.Context, tag models.Tag) error
+}
+
+// ErrTagNotFound возвращают GetByID и GetByName; in-memory реализация отдаёт ту же ошибку, что и GORM
+var ErrTagNotFound = gorm.ErrRecordNotFound
+
+type TagStorage struct {
+	adapter *gorm.DB
+}
+
+func NewTagStorage(adapter *gorm.DB) *TagStorage {
+	return &TagStorage{
+		adapter: adapter,
+	}
+}
+
+func (s *TagStorage) Create(ctx context.Context, tag models.Tag) (models.Tag, error) {
+	err := s.adapter.WithContext(ctx).Create(&tag).Error
+	return tag, err
+}
+
+func (s *TagStorage) GetByID(ctx context.Context, id int) (models.Tag, error) {
+	var tag models.Tag
+
+	err := s.adapter.WithContext(ctx).First(&tag, id).Error
+
+	return tag, err
+}
+
+func (s *TagStorage) GetByName(ctx context.Context, name string) (models.Tag, error) {
+	var tag models.Tag
+
+	err := s.adapter.WithContext(ctx).Where("name = ?", name).First(&tag).Error
+
+	return tag, err
+}
+
+func (s *TagStorage) List(ctx context.Context) ([]models.Tag, error) {
+	var tags []models.Tag
+
+	err := s.adapter.WithContext(ctx).Order("name").Find(&tags).Error
+
+	return tags, err
+}
+
+func (s *TagStorage) CountPets(ctx context.Context, tag models.Tag) (int64, error) {
+	var count int64
+
+	err := s.adapter.WithContext(ctx).
+		Table("pet_tags").
+		Where("tag_id = ?", tag.ID).
+		Count(&count).Error
+
+	return count, err
+}
+
+func (s *TagStorage) Rename(ctx context.Context, tag models.Tag, name string) error {
+	return s.adapter.WithContext(ctx).Model(&tag).Update("name", name).Error
+}
+
+// Merge перевешивает source на питомцев target и удаляет source.
+// Питомцы, у которых уже были оба тега, остаются с одним target.
+// Версии затронутых питомцев растут, чтобы их старые ETag перестали подходить
+func (s *TagStorage) Merge(ctx context.Context, source models.Tag, target models.Tag) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := bumpPetVersions(tx, source)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(
+			"UPDATE pet_tags SET tag_id = ? WHERE tag_id = ? AND pet_id NOT IN (SELECT pet_id FROM pet_tags WHERE tag_id = ?)",
+			target.ID, source.ID, target.ID,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		return deleteTag(tx, source)
+	})
+}
+
+// Delete удаляет тег вместе с его привязками к питомцам и поднимает версии этих питомцев
+func (s *TagStorage) Delete(ctx context.Context, tag models.Tag) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := bumpPetVersions(tx, tag)
+		if err != nil {
+			return err
+		}
+
+		return deleteTag(tx, tag)
+	})
+}
+
+// bumpPetVersions поднимает версии питомцев, у которых есть тег
+func bumpPetVersions(tx *gorm.DB, tag models.Tag) error {
+	return tx.Exec(
+		"UPDATE pets SET version = version + 1 WHERE id IN (SELECT pet_id FROM pet_tags WHERE tag_id = ?)",
+		tag.ID,
+	).Error
+}
+
+func deleteTag(tx *gorm.DB, tag models.Tag) error {
+	err := tx.Exec("DELETE FROM pet_tags WHERE tag_id = ?", tag.ID).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Delete(&tag).Error
+}
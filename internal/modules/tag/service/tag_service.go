@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/tag/repository"
+)
+
+type Tagger interface {
+	CreateTag(ctx context.Context, name string) (models.Tag, error)
+	GetTag(ctx context.Context, id string) (models.Tag, error)
+	ListTags(ctx context.Context) ([]models.Tag, error)
+	RenameTag(ctx context.Context, id string, name string) (models.Tag, error)
+	MergeTag(ctx context.Context, id string, targetID int) error
+	DeleteTag(ctx context.Context, id string, detach bool) error
+
+	Decode(r io.ReadCloser, data interface{}) error
+	URLParam(r *http.Request, param string) string
+}
+
+type TagService struct {
+	storage repository.TagRepository
+}
+
+func NewTagService(storage repository.TagRepository) *TagService {
+	return &TagService{
+		storage: storage,
+	}
+}
+
+func (s *TagService) Decode(r io.ReadCloser, data interface{}) error {
+	return json.NewDecoder(r).Decode(data)
+}
+
+func (s *TagService) URLParam(r *http.Request, param string) string {
+	return chi.URLParam(r, param)
+}
+
+func (s *TagService) nameCheck(ctx context.Context, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", apperr.InvalidField("name", "required", "tag name is required")
+	}
+
+	_, err := s.storage.GetByName(ctx, name)
+	if err == nil {
+		return "", apperr.Conflict("tag_exists", "a tag with that name already exists")
+	}
+	if !errors.Is(err, repository.ErrTagNotFound) {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func (s *TagService) CreateTag(ctx context.Context, name string) (models.Tag, error) {
+	name, err := s.nameCheck(ctx, name)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	return s.storage.Create(ctx, models.Tag{Name: name})
+}
+
+func (s *TagService) GetTag(ctx context.Context, id string) (models.Tag, error) {
+	intId, err := apperr.ParseID("tagId", id)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	tag, err := s.storage.GetByID(ctx, intId)
+	if errors.Is(err, repository.ErrTagNotFound) {
+		return models.Tag{}, apperr.NotFound("tag_not_found", "tag with that id does not exist: %v", id)
+	}
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+func (s *TagService) ListTags(ctx context.Context) ([]models.Tag, error) {
+	tags, err := s.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+
+	return tags, nil
+}
+
+func (s *TagService) RenameTag(ctx context.Context, id string, name string) (models.Tag, error) {
+	tag, err := s.GetTag(ctx, id)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	name, err = s.nameCheck(ctx, name)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	err = s.storage.Rename(ctx, tag, name)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	tag.Name = name
+	return tag, nil
+}
+
+func (s *TagService) MergeTag(ctx context.Context, id string, targetID int) error {
+	source, err := s.GetTag(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.GetTag(ctx, strconv.Itoa(targetID))
+	if err != nil {
+		return err
+	}
+
+	if source.ID == target.ID {
+		return apperr.Invalid("merge_into_itself", "cannot merge a tag into itself")
+	}
+
+	return s.storage.Merge(ctx, source, target)
+}
+
+// DeleteTag удаляет тег. Если он привязан к питомцам, удаление возможно
+// только с явным согласием отвязать его от них (detach).
+func (s *TagService) DeleteTag(ctx context.Context, id string, detach bool) error {
+	tag, err := s.GetTag(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !detach {
+		count, err := s.storage.CountPets(ctx, tag)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return apperr.Conflict("tag_in_use", "tag is used by %d pets, pass detach=true to remove it from them", count)
+		}
+	}
+
+	return s.storage.Delete(ctx, tag)
+}
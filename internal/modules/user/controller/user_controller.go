@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
-	"time"
 
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/middleware"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/service"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
@@ -23,10 +26,27 @@ type Userer interface {
 	CreateUser(w http.ResponseWriter, r *http.Request)
 	CreateWithListAndArray(w http.ResponseWriter, r *http.Request)
 	Login(w http.ResponseWriter, r *http.Request)
+	LoginLegacy(w http.ResponseWriter, r *http.Request)
+	LoginTwoFactor(w http.ResponseWriter, r *http.Request)
 	Logout(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
+	PasswordStrength(w http.ResponseWriter, r *http.Request)
+	VerifyEmail(w http.ResponseWriter, r *http.Request)
+	ForgotPassword(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
 	GetUser(w http.ResponseWriter, r *http.Request)
 	UpdateUser(w http.ResponseWriter, r *http.Request)
 	DeleteUser(w http.ResponseWriter, r *http.Request)
+	UpdateRole(w http.ResponseWriter, r *http.Request)
+	ListRoles(w http.ResponseWriter, r *http.Request)
+	UnlockUser(w http.ResponseWriter, r *http.Request)
+	EnrollTOTP(w http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	ListAPIKeys(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKey(w http.ResponseWriter, r *http.Request)
 }
 
 type User struct {
@@ -49,147 +69,287 @@ func (u *User) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Проверка существования пользователя с таким же юзернеймом
-	err = u.service.UserValidation(r.Context(), req.Username)
+	err = u.service.RegisterUser(r.Context(), req)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
 
-	// Валидация почты
-	err = u.service.EmailValidation(req.Email)
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "user created successfully",
+		},
+	})
+}
+
+func (u *User) CreateWithListAndArray(w http.ResponseWriter, r *http.Request) {
+	var req []models.User
+	err := u.service.Decode(r.Body, &req)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
+		u.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	var responses []UserResponse
+
+	// Каждый пользователь регистрируется отдельно, ошибка одного не останавливает остальных
+	for _, user := range req {
+		err = u.service.RegisterUser(r.Context(), user)
+		if err != nil {
+			problem := responder.ProblemFor(err)
+			responses = append(responses, UserResponse{
+				ErrorCode: problem.Status,
+				Data:      Data{Message: problem.Detail},
+			})
+			continue
+		}
+
+		responses = append(responses, UserResponse{
+			Success: true,
 			Data: Data{
-				Message: err.Error(),
+				Message: "user created successfully",
 			},
 		})
+	}
+
+	u.Responder.OutputJSON(w, responses)
+}
+
+// Login - вход по имени и паролю из тела запроса: JSON или HTML-форма. Токены отдаются JSON
+func (u *User) Login(w http.ResponseWriter, r *http.Request) {
+	query, err := u.service.DecodeLogin(r)
+	if errors.Is(err, service.ErrUnsupportedLoginBody) {
+		u.Responder.ErrorUnsupportedMediaType(w, err)
 		return
 	}
+	if err != nil {
+		u.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	u.login(w, r, query, u.writeTokenPair)
+}
 
-	// Валидация пароля
-	err = u.service.PasswordValidation(req.Password)
+// LoginLegacy - устаревший вход с паролем в query string для клиентов, сгенерированных по старой
+// спецификации. Отдаёт access-токен телом ответа; включается настройкой auth.legacyLogin
+func (u *User) LoginLegacy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</user/login>; rel="successor-version"`)
+
+	var query models.LoginForm
+	err := u.service.DecodeURl(&query, r.URL.Query())
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	// Валидаци номера телефона
-	err = u.service.PhoneValidation(req.Phone)
+	u.login(w, r, query, u.writeRawToken)
+}
+
+// login проверяет пароль и либо выпускает токены через issue, либо, если включён второй фактор,
+// отдаёт challenge-токен для POST /user/login/2fa
+func (u *User) login(w http.ResponseWriter, r *http.Request, query models.LoginForm, issue func(w http.ResponseWriter, r *http.Request, user models.User)) {
+	user, err := u.service.Authenticate(r.Context(), query, u.service.ClientIP(r))
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
 
-	// Хэширование пароля
-	hpass, err := u.service.PasswordEncryption(req.Password)
+	err = u.service.EmailVerifiedCheck(user)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
-	req.Password = hpass
 
-	// Создание пользователя в дб
-	err = u.service.UserCreate(r.Context(), req)
+	enabled, err := u.service.TwoFactorEnabled(r.Context(), user)
 	if err != nil {
-		u.Responder.ErrorBadRequest(w, err)
+		u.Responder.Error(w, err)
 		return
 	}
+	if enabled {
+		challenge, err := u.service.LoginChallenge(r.Context(), user)
+		if err != nil {
+			u.Responder.Error(w, err)
+			return
+		}
 
-	u.Responder.OutputJSON(w, UserResponse{
-		Success: true,
-		Data: Data{
-			Message: "user created successfully",
-		},
-	})
+		u.Responder.OutputJSON(w, challenge)
+		return
+	}
+
+	issue(w, r, user)
 }
 
-func (u *User) CreateWithListAndArray(w http.ResponseWriter, r *http.Request) {
-	var req []models.User
+// LoginTwoFactor завершает вход: challenge-токен и код из приложения или код восстановления
+func (u *User) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginForm
 	err := u.service.Decode(r.Body, &req)
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	var responses []UserResponse
+	user, err := u.service.CompleteLogin(r.Context(), req, u.service.ClientIP(r))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
 
-	// Перенаправление запроса для каждого юзера
-	for _, user := range req {
-		resp, err := u.service.UserRequestRedirection(user)
-		if err != nil {
-			u.Responder.ErrorBadRequest(w, err)
-			return
-		}
+	u.writeTokenPair(w, r, user)
+}
+
+// writeTokenPair выпускает токены после успешного входа и отдаёт их JSON, как POST /user/refresh
+func (u *User) writeTokenPair(w http.ResponseWriter, r *http.Request, user models.User) {
+	tokens, ok := u.issueTokens(w, r, user)
+	if !ok {
+		return
+	}
 
-		var userResp UserResponse
+	u.Responder.OutputJSON(w, tokens)
+}
 
-		err = u.service.Decode(resp.Body, &userResp)
-		if err != nil {
-			u.Responder.ErrorBadRequest(w, err)
-			return
-		}
+// writeRawToken - ответ устаревшего GET /user/login: access-токен телом, остальное в заголовках
+func (u *User) writeRawToken(w http.ResponseWriter, r *http.Request, user models.User) {
+	tokens, ok := u.issueTokens(w, r, user)
+	if !ok {
+		return
+	}
+
+	w.Header().Add("X-Expires-After", tokens.ExpiresAt.String())
+	w.Header().Add("X-Refresh-Token", tokens.RefreshToken)
+	w.Header().Add("X-Rate-Limit", "50")
+	w.Write([]byte(tokens.AccessToken))
+}
 
-		responses = append(responses, userResp)
+// issueTokens сбрасывает счётчик неудачных входов, выпускает токены и кладёт их в cookie
+func (u *User) issueTokens(w http.ResponseWriter, r *http.Request, user models.User) (models.TokenPair, bool) {
+	err := u.service.LoginSucceeded(r.Context(), user)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return models.TokenPair{}, false
 	}
 
-	u.Responder.OutputJSON(w, responses)
+	tokens, err := u.service.IssueTokens(r.Context(), user)
+	if err != nil {
+		u.Responder.ErrorInternal(w, err)
+		return models.TokenPair{}, false
+	}
+
+	u.service.SetCookie(w, true, tokens.AccessToken)
+	u.service.SetRefreshCookie(w, tokens.RefreshToken)
+
+	return tokens, true
 }
 
-func (u *User) Login(w http.ResponseWriter, r *http.Request) {
-	var query models.LoginForm
-	err := u.service.DecodeURl(&query, r.URL.Query())
+func (u *User) Refresh(w http.ResponseWriter, r *http.Request) {
+	tokens, err := u.service.RefreshTokens(r.Context(), u.service.RefreshTokenFromRequest(r))
+	if apperr.KindOf(err) == apperr.KindUnauthorized {
+		u.service.SetRefreshCookie(w, "")
+	}
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.service.SetCookie(w, true, tokens.AccessToken)
+	u.service.SetRefreshCookie(w, tokens.RefreshToken)
+	u.Responder.OutputJSON(w, tokens)
+}
+
+// PasswordStrength оценивает пароль до регистрации или смены пароля
+func (u *User) PasswordStrength(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordForm
+	err := u.service.Decode(r.Body, &req)
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	user, err := u.service.UserExistenceCheck(r.Context(), query.Username)
+	u.Responder.OutputJSON(w, u.service.PasswordStrength(req.Password))
+}
+
+// VerifyEmail подтверждает адрес почты по токену из письма
+func (u *User) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.TokenForm
+	err := u.service.Decode(r.Body, &req)
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	err = u.service.PasswordCheck(r.Context(), query, user)
+	err = u.service.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "email successfully verified",
+		},
+	})
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля. Ответ одинаков для известных
+// и неизвестных пользователей
+func (u *User) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordForm
+	err := u.service.Decode(r.Body, &req)
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	token, err := u.service.MakeToken(query.Username)
+	err = u.service.ForgotPassword(r.Context(), req)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "if the account exists, a password reset link has been sent",
+		},
+	})
+}
+
+// ResetPassword задаёт новый пароль по токену из письма
+func (u *User) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordForm
+	err := u.service.Decode(r.Body, &req)
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
-	u.service.SetCookie(w, true, token)
-	w.Header().Add("X-Expires-After", time.Now().Add(7*24*time.Hour).String())
-	w.Header().Add("X-Rate-Limit", "50")
-	w.Write([]byte(token))
+
+	err = u.service.ResetPassword(r.Context(), req)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "password successfully reset",
+		},
+	})
 }
 
 func (u *User) Logout(w http.ResponseWriter, r *http.Request) {
+	jti, expiresAt := middleware.TokenID(r.Context())
+
+	err := u.service.RevokeTokens(r.Context(), jti, expiresAt, u.service.RefreshTokenFromRequest(r))
+	if err != nil {
+		u.Responder.ErrorInternal(w, err)
+		return
+	}
+
 	u.service.SetCookie(w, false, "")
+	u.service.SetRefreshCookie(w, "")
 
 	u.Responder.OutputJSON(w, UserResponse{
 		Success: true,
@@ -204,10 +364,11 @@ func (u *User) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := u.service.UserExistenceCheck(r.Context(), username)
 	if err != nil {
-		u.Responder.ErrorBadRequest(w, err)
+		u.Responder.Error(w, err)
 		return
 	}
 
+	etag.Set(w, user.Version)
 	u.Responder.OutputJSON(w, user)
 }
 
@@ -223,103 +384,305 @@ func (u *User) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := u.service.UserExistenceCheck(r.Context(), username)
 	if err != nil {
-		u.Responder.ErrorBadRequest(w, err)
+		u.Responder.Error(w, err)
 		return
 	}
 
-	err = u.service.UserValidation(r.Context(), req.Username)
+	err = etag.Check(r, user.Version)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.ErrorPrecondition(w, err)
 		return
 	}
 
-	// Валидация почты
-	err = u.service.EmailValidation(req.Email)
+	// Роль меняется только через UpdateRole
+	req.Role = ""
+
+	// Проверка всех полей: занятый юзернейм, почта, пароль и телефон
+	err = u.service.ValidateUserUpdate(r.Context(), user, req)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
 
-	// Валидация пароля
-	err = u.service.PasswordValidation(req.Password)
+	// Хэширование пароля
+	hpass, err := u.service.PasswordEncryption(req.Password)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
+	req.Password = hpass
 
-	// Валидаци номера телефона
-	err = u.service.PhoneValidation(req.Phone)
+	err = u.service.UpdateUser(r.Context(), user, req)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
 
-	// Хэширование пароля
-	hpass, err := u.service.PasswordEncryption(req.Password)
+	etag.Set(w, user.Version+1)
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "user successfully updated",
+		},
+	})
+}
+
+func (u *User) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := u.service.URLParam(r, "username")
+
+	user, err := u.service.UserExistenceCheck(r.Context(), username)
 	if err != nil {
-		u.Responder.OutputJSON(w, UserResponse{
-			Success: false,
-			Data: Data{
-				Message: err.Error(),
-			},
-		})
+		u.Responder.Error(w, err)
 		return
 	}
-	req.Password = hpass
 
-	err = u.service.UpdateUser(r.Context(), user, req)
+	err = etag.Check(r, user.Version)
 	if err != nil {
-		u.Responder.ErrorBadRequest(w, err)
+		u.Responder.ErrorPrecondition(w, err)
+		return
+	}
+
+	err = u.service.DeleteUser(r.Context(), user)
+	if err != nil {
+		u.Responder.Error(w, err)
 		return
 	}
 
 	u.Responder.OutputJSON(w, UserResponse{
 		Success: true,
 		Data: Data{
-			Message: "user successfully updated",
+			Message: "user successfully deleted",
 		},
 	})
 }
 
-func (u *User) DeleteUser(w http.ResponseWriter, r *http.Request) {
+func (u *User) UpdateRole(w http.ResponseWriter, r *http.Request) {
 	username := u.service.URLParam(r, "username")
 
+	var req models.RoleForm
+	err := u.service.Decode(r.Body, &req)
+	if err != nil {
+		u.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
 	user, err := u.service.UserExistenceCheck(r.Context(), username)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	err = etag.Check(r, user.Version)
+	if err != nil {
+		u.Responder.ErrorPrecondition(w, err)
+		return
+	}
+
+	err = u.service.UpdateRole(r.Context(), user, req.Role)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	etag.Set(w, user.Version+1)
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "user role successfully updated",
+		},
+	})
+}
+
+func (u *User) ListRoles(w http.ResponseWriter, r *http.Request) {
+	var query models.RoleListForm
+	err := u.service.DecodeURl(&query, r.URL.Query())
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
-	err = u.service.DeleteUser(r.Context(), user)
+	users, err := u.service.ListRoles(r.Context(), query.Role)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, users)
+}
+
+// UnlockUser снимает блокировку входа, не дожидаясь её истечения
+func (u *User) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	err = u.service.UnlockUser(r.Context(), user)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "user login unlocked",
+		},
+	})
+}
+
+// EnrollTOTP начинает привязку аутентификатора: отдаёт секрет и ссылку для QR-кода
+func (u *User) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	enrollment, err := u.service.EnrollTOTP(r.Context(), user)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, enrollment)
+}
+
+// ConfirmTOTP включает второй фактор по коду из приложения; коды восстановления показываются один раз
+func (u *User) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req models.CodeForm
+	err := u.service.Decode(r.Body, &req)
+	if err != nil {
+		u.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	codes, err := u.service.ConfirmTOTP(r.Context(), user, req.Code)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, codes)
+}
+
+func (u *User) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req models.CodeForm
+	err := u.service.Decode(r.Body, &req)
 	if err != nil {
 		u.Responder.ErrorBadRequest(w, err)
 		return
 	}
 
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	err = u.service.DisableTOTP(r.Context(), user, req.Code)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
 	u.Responder.OutputJSON(w, UserResponse{
 		Success: true,
 		Data: Data{
-			Message: "user successfully deleted",
+			Message: "two-factor authentication disabled",
+		},
+	})
+}
+
+func (u *User) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req models.CodeForm
+	err := u.service.Decode(r.Body, &req)
+	if err != nil {
+		u.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	codes, err := u.service.RegenerateRecoveryCodes(r.Context(), user, req.Code)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, codes)
+}
+
+// CreateAPIKey выпускает ключ для машинного клиента; сам ключ показывается только в этом ответе
+func (u *User) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req models.APIKeyForm
+	err := u.service.Decode(r.Body, &req)
+	if err != nil {
+		u.Responder.ErrorBadRequest(w, err)
+		return
+	}
+
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	key, err := u.service.CreateAPIKey(r.Context(), user, req)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, key)
+}
+
+func (u *User) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	keys, err := u.service.ListAPIKeys(r.Context(), user)
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, keys)
+}
+
+func (u *User) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, err := u.service.UserExistenceCheck(r.Context(), u.service.URLParam(r, "username"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	err = u.service.RevokeAPIKey(r.Context(), user, u.service.URLParam(r, "keyId"))
+	if err != nil {
+		u.Responder.Error(w, err)
+		return
+	}
+
+	u.Responder.OutputJSON(w, UserResponse{
+		Success: true,
+		Data: Data{
+			Message: "api key revoked",
 		},
 	})
 }
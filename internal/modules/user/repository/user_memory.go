@@ -0,0 +1,627 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+// UserMemory - UserRepository поверх memdb. Удалённые пользователи, как и в базе,
+// остаются в таблице с user_status = 1
+type UserMemory struct {
+	db *memdb.DB
+}
+
+func NewUserMemory(db *memdb.DB) *UserMemory {
+	return &UserMemory{
+		db: db,
+	}
+}
+
+func (s *UserMemory) Create(ctx context.Context, user models.User) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	user.ID = s.db.NextID("users")
+	if user.Role == "" {
+		user.Role = models.RoleCustomer
+	}
+	if user.Version == 0 {
+		user.Version = 1
+	}
+	s.db.Users[user.ID] = user
+
+	return nil
+}
+
+func (s *UserMemory) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, id := range memdb.IDs(s.db.Users) {
+		user := s.db.Users[id]
+		if user.Username == username && user.UserStatus == 0 {
+			return user, nil
+		}
+	}
+
+	return models.User{}, nil
+}
+
+// UpdateUser применяет только заполненные поля updatedUser
+func (s *UserMemory) UpdateUser(ctx context.Context, user models.User, updatedUser models.User) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(user)
+	if err != nil {
+		return err
+	}
+
+	fields := []struct {
+		value  string
+		target *string
+	}{
+		{updatedUser.Username, &existing.Username},
+		{updatedUser.FirstName, &existing.FirstName},
+		{updatedUser.LastName, &existing.LastName},
+		{updatedUser.Email, &existing.Email},
+		{updatedUser.Password, &existing.Password},
+		{updatedUser.Phone, &existing.Phone},
+		{updatedUser.Role, &existing.Role},
+	}
+	if updatedUser.Email != "" && updatedUser.Email != existing.Email {
+		existing.EmailVerified = false
+	}
+
+	for _, field := range fields {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+
+	if updatedUser.UserStatus != 0 {
+		existing.UserStatus = updatedUser.UserStatus
+	}
+
+	existing.Version = user.Version + 1
+	s.db.Users[user.ID] = existing
+
+	return nil
+}
+
+func (s *UserMemory) DeleteUser(ctx context.Context, user models.User) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(user)
+	if err != nil {
+		return err
+	}
+
+	existing.UserStatus = 1
+	existing.Version = user.Version + 1
+	s.db.Users[user.ID] = existing
+
+	return nil
+}
+
+func (s *UserMemory) UpdateRole(ctx context.Context, user models.User, role string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(user)
+	if err != nil {
+		return err
+	}
+
+	existing.Role = role
+	existing.Version = user.Version + 1
+	s.db.Users[user.ID] = existing
+
+	return nil
+}
+
+func (s *UserMemory) ListRoles(ctx context.Context, role string) ([]models.UserRole, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var users []models.UserRole
+	for _, id := range memdb.IDs(s.db.Users) {
+		user := s.db.Users[id]
+		if user.UserStatus != 0 || (role != "" && user.Role != role) {
+			continue
+		}
+
+		users = append(users, models.UserRole{
+			ID:       user.ID,
+			Username: user.Username,
+			Role:     user.Role,
+		})
+	}
+
+	return users, nil
+}
+
+func (s *UserMemory) GetByID(ctx context.Context, id int) (models.User, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	user, ok := s.db.Users[id]
+	if !ok || user.UserStatus != 0 {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (s *UserMemory) ListDeleted(ctx context.Context) ([]models.UserRole, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var users []models.UserRole
+	for _, id := range memdb.IDs(s.db.Users) {
+		user := s.db.Users[id]
+		if user.UserStatus != 1 {
+			continue
+		}
+
+		users = append(users, models.UserRole{
+			ID:       user.ID,
+			Username: user.Username,
+			Role:     user.Role,
+		})
+	}
+
+	return users, nil
+}
+
+// GetDeletedByUsername возвращает последнего удалённого пользователя с таким именем
+func (s *UserMemory) GetDeletedByUsername(ctx context.Context, username string) (models.User, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	ids := memdb.IDs(s.db.Users)
+	for i := len(ids) - 1; i >= 0; i-- {
+		user := s.db.Users[ids[i]]
+		if user.Username == username && user.UserStatus == 1 {
+			return user, nil
+		}
+	}
+
+	return models.User{}, ErrUserNotFound
+}
+
+func (s *UserMemory) RestoreUser(ctx context.Context, user models.User) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	existing, err := s.lockVersion(user)
+	if err != nil {
+		return err
+	}
+
+	existing.UserStatus = 0
+	existing.Version = user.Version + 1
+	s.db.Users[user.ID] = existing
+
+	return nil
+}
+
+func (s *UserMemory) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	return s.createRefreshToken(token)
+}
+
+// RotateRefreshToken гасит предъявленный refresh-токен и сохраняет следующий.
+// Повторное предъявление погашенного токена отзывает все refresh-токены пользователя
+func (s *UserMemory) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	now := time.Now()
+
+	current, ok := s.refreshTokenByHash(hash)
+	if !ok {
+		return models.RefreshToken{}, ErrRefreshTokenInvalid
+	}
+
+	if current.RevokedAt != nil {
+		for id, token := range s.db.RefreshTokens {
+			if token.UserID == current.UserID && token.RevokedAt == nil {
+				token.RevokedAt = &now
+				s.db.RefreshTokens[id] = token
+			}
+		}
+		return current, ErrRefreshTokenReused
+	}
+
+	if !current.ExpiresAt.After(now) {
+		return current, ErrRefreshTokenInvalid
+	}
+
+	next.UserID = current.UserID
+	err := s.createRefreshToken(next)
+	if err != nil {
+		return current, err
+	}
+
+	current.RevokedAt = &now
+	s.db.RefreshTokens[current.ID] = current
+
+	return current, nil
+}
+
+func (s *UserMemory) RevokeRefreshToken(ctx context.Context, hash string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	token, ok := s.refreshTokenByHash(hash)
+	if !ok || token.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	token.RevokedAt = &now
+	s.db.RefreshTokens[token.ID] = token
+
+	return nil
+}
+
+// RevokeToken заносит access-токен в список отозванных и заодно чистит записи, срок которых истёк
+func (s *UserMemory) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	now := time.Now()
+	for key, token := range s.db.RevokedTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(s.db.RevokedTokens, key)
+		}
+	}
+
+	if _, ok := s.db.RevokedTokens[jti]; !ok {
+		s.db.RevokedTokens[jti] = models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	}
+
+	return nil
+}
+
+func (s *UserMemory) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	_, ok := s.db.RevokedTokens[jti]
+
+	return ok, nil
+}
+
+// GetByEmail возвращает первого активного пользователя с таким адресом
+func (s *UserMemory) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, id := range memdb.IDs(s.db.Users) {
+		user := s.db.Users[id]
+		if user.Email == email && user.UserStatus == 0 {
+			return user, nil
+		}
+	}
+
+	return models.User{}, ErrUserNotFound
+}
+
+// CreateUserToken сохраняет токен и гасит прежние неиспользованные токены того же назначения
+func (s *UserMemory) CreateUserToken(ctx context.Context, token models.UserToken) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	now := time.Now()
+	for id, existing := range s.db.UserTokens {
+		if existing.TokenHash == token.TokenHash {
+			return memdb.ErrDuplicate
+		}
+		if existing.UserID == token.UserID && existing.Purpose == token.Purpose && existing.UsedAt == nil {
+			existing.UsedAt = &now
+			s.db.UserTokens[id] = existing
+		}
+	}
+
+	token.ID = s.db.NextID("user_tokens")
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = now
+	}
+	s.db.UserTokens[token.ID] = token
+
+	return nil
+}
+
+func (s *UserMemory) ConsumeUserToken(ctx context.Context, purpose string, hash string) (models.UserToken, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	now := time.Now()
+	for id, token := range s.db.UserTokens {
+		if token.TokenHash != hash || token.Purpose != purpose {
+			continue
+		}
+
+		if token.UsedAt != nil || !token.ExpiresAt.After(now) {
+			return token, ErrUserTokenInvalid
+		}
+
+		token.UsedAt = &now
+		s.db.UserTokens[id] = token
+
+		return token, nil
+	}
+
+	return models.UserToken{}, ErrUserTokenInvalid
+}
+
+// MarkEmailVerified подтверждает адрес, только если пользователь не сменил его после отправки письма
+func (s *UserMemory) MarkEmailVerified(ctx context.Context, userID int, email string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	user, ok := s.db.Users[userID]
+	if !ok || user.UserStatus != 0 || user.Email != email {
+		return ErrUserTokenInvalid
+	}
+
+	user.EmailVerified = true
+	user.Version++
+	s.db.Users[userID] = user
+
+	return nil
+}
+
+// ResetPassword меняет пароль и отзывает все refresh-токены пользователя
+func (s *UserMemory) ResetPassword(ctx context.Context, userID int, passwordHash string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	user, ok := s.db.Users[userID]
+	if !ok || user.UserStatus != 0 {
+		return ErrUserNotFound
+	}
+
+	user.Password = passwordHash
+	user.Version++
+	s.db.Users[userID] = user
+
+	now := time.Now()
+	for id, token := range s.db.RefreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.db.RefreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+func (s *UserMemory) GetTOTP(ctx context.Context, userID int) (models.UserTOTP, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	totp, ok := s.db.TOTPs[userID]
+	if !ok {
+		return models.UserTOTP{}, ErrTOTPNotFound
+	}
+
+	return totp, nil
+}
+
+// SaveTOTP сохраняет секрет, заменяя прежний
+func (s *UserMemory) SaveTOTP(ctx context.Context, totp models.UserTOTP) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	if totp.CreatedAt.IsZero() {
+		totp.CreatedAt = time.Now()
+	}
+	s.db.TOTPs[totp.UserID] = totp
+
+	return nil
+}
+
+func (s *UserMemory) ConfirmTOTP(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	totp, ok := s.db.TOTPs[userID]
+	if !ok || totp.ConfirmedAt != nil {
+		return ErrTOTPNotFound
+	}
+
+	now := time.Now()
+	totp.ConfirmedAt = &now
+	totp.LastStep = step
+	s.db.TOTPs[userID] = totp
+
+	s.replaceRecoveryCodes(userID, codeHashes)
+
+	return nil
+}
+
+func (s *UserMemory) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	totp, ok := s.db.TOTPs[userID]
+	if !ok || totp.LastStep >= step {
+		return ErrTOTPCodeReused
+	}
+
+	totp.LastStep = step
+	s.db.TOTPs[userID] = totp
+
+	return nil
+}
+
+func (s *UserMemory) DeleteTOTP(ctx context.Context, userID int) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	s.replaceRecoveryCodes(userID, nil)
+	delete(s.db.TOTPs, userID)
+
+	return nil
+}
+
+func (s *UserMemory) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	s.replaceRecoveryCodes(userID, codeHashes)
+
+	return nil
+}
+
+func (s *UserMemory) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	for id, code := range s.db.RecoveryCodes {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			s.db.RecoveryCodes[id] = code
+			return nil
+		}
+	}
+
+	return ErrRecoveryCodeInvalid
+}
+
+func (s *UserMemory) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	for _, existing := range s.db.APIKeys {
+		if existing.KeyHash == key.KeyHash {
+			return models.APIKey{}, memdb.ErrDuplicate
+		}
+	}
+
+	key.ID = s.db.NextID("api_keys")
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	s.db.APIKeys[key.ID] = key
+
+	return key, nil
+}
+
+func (s *UserMemory) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	var keys []models.APIKey
+	for _, id := range memdb.IDs(s.db.APIKeys) {
+		key := s.db.APIKeys[id]
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *UserMemory) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	for _, key := range s.db.APIKeys {
+		if key.KeyHash == hash && key.RevokedAt == nil {
+			return key, nil
+		}
+	}
+
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (s *UserMemory) RevokeAPIKey(ctx context.Context, userID int, id int) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	key, ok := s.db.APIKeys[id]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	s.db.APIKeys[id] = key
+
+	return nil
+}
+
+func (s *UserMemory) TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	key, ok := s.db.APIKeys[id]
+	if !ok {
+		return nil
+	}
+
+	key.LastUsedAt = &usedAt
+	s.db.APIKeys[id] = key
+
+	return nil
+}
+
+// replaceRecoveryCodes вызывается под блокировкой на запись
+func (s *UserMemory) replaceRecoveryCodes(userID int, codeHashes []string) {
+	for id, code := range s.db.RecoveryCodes {
+		if code.UserID == userID {
+			delete(s.db.RecoveryCodes, id)
+		}
+	}
+
+	for _, hash := range codeHashes {
+		id := s.db.NextID("recovery_codes")
+		s.db.RecoveryCodes[id] = models.RecoveryCode{ID: id, UserID: userID, CodeHash: hash}
+	}
+}
+
+// lockVersion возвращает сохранённого пользователя, если его версия совпадает с user.Version.
+// Вызывается под блокировкой на запись
+func (s *UserMemory) lockVersion(user models.User) (models.User, error) {
+	existing, ok := s.db.Users[user.ID]
+	if !ok || existing.Version != user.Version {
+		return models.User{}, etag.ErrMismatch
+	}
+
+	return existing, nil
+}
+
+func (s *UserMemory) createRefreshToken(token models.RefreshToken) error {
+	if _, ok := s.refreshTokenByHash(token.TokenHash); ok {
+		return memdb.ErrDuplicate
+	}
+
+	token.ID = s.db.NextID("refresh_tokens")
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	s.db.RefreshTokens[token.ID] = token
+
+	return nil
+}
+
+func (s *UserMemory) refreshTokenByHash(hash string) (models.RefreshToken, bool) {
+	for _, token := range s.db.RefreshTokens {
+		if token.TokenHash == hash {
+			return token, true
+		}
+	}
+	return models.RefreshToken{}, false
+}
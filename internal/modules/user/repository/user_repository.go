@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 )
 
@@ -12,8 +16,52 @@ type UserRepository interface {
 	GetByUsername(ctx context.Context, username string) (models.User, error)
 	UpdateUser(ctx context.Context, user models.User, updatedUser models.User) error
 	DeleteUser(ctx context.Context, user models.User) error
+	UpdateRole(ctx context.Context, user models.User, role string) error
+	ListRoles(ctx context.Context, role string) ([]models.UserRole, error)
+	GetByID(ctx context.Context, id int) (models.User, error)
+
+	ListDeleted(ctx context.Context) ([]models.UserRole, error)
+	GetDeletedByUsername(ctx context.Context, username string) (models.User, error)
+	RestoreUser(ctx context.Context, user models.User) error
+
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, hash string) error
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	CreateUserToken(ctx context.Context, token models.UserToken) error
+	ConsumeUserToken(ctx context.Context, purpose string, hash string) (models.UserToken, error)
+	MarkEmailVerified(ctx context.Context, userID int, email string) error
+	ResetPassword(ctx context.Context, userID int, passwordHash string) error
+
+	GetTOTP(ctx context.Context, userID int) (models.UserTOTP, error)
+	SaveTOTP(ctx context.Context, totp models.UserTOTP) error
+	ConfirmTOTP(ctx context.Context, userID int, step int64, codeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	DeleteTOTP(ctx context.Context, userID int) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, hash string) error
+
+	CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int, id int) error
+	TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error
 }
 
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrUserNotFound        = errors.New("user does not exist")
+	ErrUserTokenInvalid    = errors.New("token is invalid, expired or already used")
+	ErrTOTPNotFound        = errors.New("two-factor authentication is not set up")
+	ErrTOTPCodeReused      = errors.New("two-factor code has already been used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+	ErrAPIKeyNotFound      = errors.New("api key does not exist or is revoked")
+)
+
 type UserStorage struct {
 	adapter *gorm.DB
 }
@@ -51,14 +99,479 @@ func (s *UserStorage) GetByUsername(ctx context.Context, username string) (model
 	return models.User{}, nil
 }
 
+// UpdateUser применяет заполненные поля updatedUser. Новый адрес почты
+// ещё не подтверждён, поэтому при его смене флаг подтверждения сбрасывается
 func (s *UserStorage) UpdateUser(ctx context.Context, user models.User, updatedUser models.User) error {
-	result := s.adapter.WithContext(ctx).Model(&user).Updates(updatedUser)
+	updatedUser.Version = user.Version + 1
+	// Updates пишет новые значения в user, поэтому сравниваем до обновления
+	emailChanged := updatedUser.Email != "" && updatedUser.Email != user.Email
 
-	return result.Error
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&user).
+			Where("version = ?", user.Version).
+			Updates(updatedUser)
+
+		err := versionedResult(result)
+		if err != nil || !emailChanged {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("email_verified", false).Error
+	})
 }
 
 func (s *UserStorage) DeleteUser(ctx context.Context, user models.User) error {
-	result := s.adapter.WithContext(ctx).Model(&user).Update("user_status", 1)
+	result := s.adapter.WithContext(ctx).
+		Model(&user).
+		Where("version = ?", user.Version).
+		Updates(map[string]interface{}{
+			"user_status": 1,
+			"version":     user.Version + 1,
+		})
 
-	return result.Error
+	return versionedResult(result)
+}
+
+func (s *UserStorage) UpdateRole(ctx context.Context, user models.User, role string) error {
+	result := s.adapter.WithContext(ctx).
+		Model(&user).
+		Where("version = ?", user.Version).
+		Updates(map[string]interface{}{
+			"role":    role,
+			"version": user.Version + 1,
+		})
+
+	return versionedResult(result)
+}
+
+func (s *UserStorage) ListRoles(ctx context.Context, role string) ([]models.UserRole, error) {
+	var users []models.UserRole
+
+	query := s.adapter.WithContext(ctx).
+		Model(&models.User{}).
+		Where("user_status = ?", 0)
+
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	err := query.Order("id").Find(&users).Error
+
+	return users, err
+}
+
+func (s *UserStorage) GetByID(ctx context.Context, id int) (models.User, error) {
+	var user models.User
+
+	err := s.adapter.WithContext(ctx).
+		Where("id = ? AND user_status = ?", id, 0).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return user, err
+}
+
+func (s *UserStorage) ListDeleted(ctx context.Context) ([]models.UserRole, error) {
+	var users []models.UserRole
+
+	err := s.adapter.WithContext(ctx).
+		Model(&models.User{}).
+		Where("user_status = ?", 1).
+		Order("id").
+		Find(&users).Error
+
+	return users, err
+}
+
+// GetDeletedByUsername возвращает последнего удалённого пользователя с таким именем
+func (s *UserStorage) GetDeletedByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+
+	err := s.adapter.WithContext(ctx).
+		Where("username = ? AND user_status = ?", username, 1).
+		Order("id DESC").
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return user, err
+}
+
+func (s *UserStorage) RestoreUser(ctx context.Context, user models.User) error {
+	result := s.adapter.WithContext(ctx).
+		Model(&user).
+		Where("version = ?", user.Version).
+		Updates(map[string]interface{}{
+			"user_status": 0,
+			"version":     user.Version + 1,
+		})
+
+	return versionedResult(result)
+}
+
+func (s *UserStorage) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	return s.adapter.WithContext(ctx).Create(&token).Error
+}
+
+// RotateRefreshToken гасит предъявленный refresh-токен и сохраняет следующий.
+// Повторное предъявление уже погашенного токена означает его утечку,
+// поэтому в этом случае отзываются все refresh-токены пользователя
+func (s *UserStorage) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error) {
+	var current models.RefreshToken
+	now := time.Now()
+
+	err := s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hash).
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		if !current.ExpiresAt.After(now) {
+			return ErrRefreshTokenInvalid
+		}
+
+		err = tx.Model(&current).Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		return tx.Create(&next).Error
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		revokeErr := s.adapter.WithContext(ctx).
+			Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", current.UserID).
+			Update("revoked_at", now).Error
+		if revokeErr != nil {
+			return models.RefreshToken{}, revokeErr
+		}
+	}
+
+	return current, err
+}
+
+func (s *UserStorage) RevokeRefreshToken(ctx context.Context, hash string) error {
+	return s.adapter.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("token_hash = ? AND revoked_at IS NULL", hash).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeToken заносит access-токен в список отозванных и заодно чистит записи, срок которых истёк
+func (s *UserStorage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+	})
+}
+
+func (s *UserStorage) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+
+	err := s.adapter.WithContext(ctx).
+		Model(&models.RevokedToken{}).
+		Where("jti = ?", jti).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// GetByEmail возвращает первого активного пользователя с таким адресом
+func (s *UserStorage) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+
+	err := s.adapter.WithContext(ctx).
+		Where("email = ? AND user_status = ?", email, 0).
+		Order("id").
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return user, err
+}
+
+// CreateUserToken сохраняет токен и гасит прежние неиспользованные токены того же назначения:
+// действует только ссылка из последнего письма
+func (s *UserStorage) CreateUserToken(ctx context.Context, token models.UserToken) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&token).Error
+	})
+}
+
+// ConsumeUserToken гасит токен: повторно, после истечения срока или с другим назначением
+// он не принимается
+func (s *UserStorage) ConsumeUserToken(ctx context.Context, purpose string, hash string) (models.UserToken, error) {
+	var token models.UserToken
+	now := time.Now()
+
+	err := s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND purpose = ?", hash, purpose).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if token.UsedAt != nil || !token.ExpiresAt.After(now) {
+			return ErrUserTokenInvalid
+		}
+
+		return tx.Model(&token).Update("used_at", now).Error
+	})
+
+	return token, err
+}
+
+// MarkEmailVerified подтверждает адрес, только если пользователь не сменил его после отправки письма
+func (s *UserStorage) MarkEmailVerified(ctx context.Context, userID int, email string) error {
+	result := s.adapter.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND email = ? AND user_status = ?", userID, email, 0).
+		Updates(map[string]interface{}{
+			"email_verified": true,
+			"version":        gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserTokenInvalid
+	}
+
+	return nil
+}
+
+// ResetPassword меняет пароль и отзывает все refresh-токены: сессии,
+// открытые со старым паролем, должны закончиться
+func (s *UserStorage) ResetPassword(ctx context.Context, userID int, passwordHash string) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND user_status = ?", userID, 0).
+			Updates(map[string]interface{}{
+				"password": passwordHash,
+				"version":  gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func (s *UserStorage) GetTOTP(ctx context.Context, userID int) (models.UserTOTP, error) {
+	var totp models.UserTOTP
+
+	err := s.adapter.WithContext(ctx).Where("user_id = ?", userID).First(&totp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.UserTOTP{}, ErrTOTPNotFound
+	}
+
+	return totp, err
+}
+
+// SaveTOTP сохраняет секрет, заменяя прежний: повторная привязка начинается заново
+func (s *UserStorage) SaveTOTP(ctx context.Context, totp models.UserTOTP) error {
+	return s.adapter.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			UpdateAll: true,
+		}).
+		Create(&totp).Error
+}
+
+// ConfirmTOTP включает второй фактор, запоминает шаг подтверждающего кода
+// и сохраняет коды восстановления
+func (s *UserStorage) ConfirmTOTP(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.UserTOTP{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]interface{}{
+				"confirmed_at": time.Now(),
+				"last_step":    step,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrTOTPNotFound
+		}
+
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// UseTOTPStep запоминает шаг принятого кода. Код того же или более раннего шага
+// уже не принимается, даже если ещё не истёк
+func (s *UserStorage) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	result := s.adapter.WithContext(ctx).
+		Model(&models.UserTOTP{}).
+		Where("user_id = ? AND last_step < ?", userID, step).
+		Update("last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+func (s *UserStorage) DeleteTOTP(ctx context.Context, userID int) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error
+	})
+}
+
+func (s *UserStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return s.adapter.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (s *UserStorage) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	result := s.adapter.WithContext(ctx).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+func (s *UserStorage) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	err := s.adapter.WithContext(ctx).Create(&key).Error
+	return key, err
+}
+
+// ListAPIKeys возвращает неотозванные ключи пользователя, в том числе истёкшие
+func (s *UserStorage) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	var keys []models.APIKey
+
+	err := s.adapter.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("id").
+		Find(&keys).Error
+
+	return keys, err
+}
+
+// GetAPIKeyByHash ищет неотозванный ключ; срок действия проверяет сервис
+func (s *UserStorage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+
+	err := s.adapter.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+
+	return key, err
+}
+
+func (s *UserStorage) RevokeAPIKey(ctx context.Context, userID int, id int) error {
+	result := s.adapter.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStorage) TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error {
+	return s.adapter.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", usedAt).Error
+}
+
+// replaceRecoveryCodes удаляет все коды восстановления пользователя, в том числе
+// неиспользованные, и сохраняет новые
+func replaceRecoveryCodes(tx *gorm.DB, userID int, codeHashes []string) error {
+	err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	if err != nil {
+		return err
+	}
+
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+
+	return tx.Create(&codes).Error
+}
+
+// versionedResult превращает обновление без затронутых строк в конфликт версий
+func versionedResult(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return etag.ErrMismatch
+	}
+
+	return nil
 }
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
+)
+
+const (
+	// apiKeyPrefix отличает ключи от JWT и помогает сканерам секретов находить их в коде
+	apiKeyPrefix = "psk_"
+	// apiKeyVisibleLength - сколько первых символов ключа хранится открыто для списка ключей
+	apiKeyVisibleLength = 12
+	maxAPIKeyNameLength = 100
+	// apiKeyTouchInterval - время последнего использования обновляется не чаще, чтобы не писать в базу на каждый запрос
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrAPIKeyNotFound = repository.ErrAPIKeyNotFound
+
+	ErrAPIKeyInvalid = apperr.Unauthorized("api_key_invalid", "api key is invalid, expired or revoked")
+)
+
+// CreateAPIKey выпускает ключ с правами scopes. Сам ключ возвращается только здесь,
+// в базе остаётся его хэш
+func (s *UserService) CreateAPIKey(ctx context.Context, user models.User, form models.APIKeyForm) (models.NewAPIKey, error) {
+	scopes, err := validateAPIKey(form)
+	if err != nil {
+		return models.NewAPIKey{}, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return models.NewAPIKey{}, err
+	}
+	key := apiKeyPrefix + secret
+
+	record, err := s.storage.CreateAPIKey(ctx, models.APIKey{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(form.Name),
+		Prefix:    key[:apiKeyVisibleLength],
+		KeyHash:   hashToken(key),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: form.ExpiresAt,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return models.NewAPIKey{}, err
+	}
+
+	return models.NewAPIKey{APIKeyInfo: apiKeyInfo(record), Key: key}, nil
+}
+
+func (s *UserService) ListAPIKeys(ctx context.Context, user models.User) ([]models.APIKeyInfo, error) {
+	keys, err := s.storage.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]models.APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, apiKeyInfo(key))
+	}
+
+	return infos, nil
+}
+
+func (s *UserService) RevokeAPIKey(ctx context.Context, user models.User, id string) error {
+	intId, err := apperr.ParseID("keyId", id)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.RevokeAPIKey(ctx, user.ID, intId)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return apperr.NotFound("api_key_not_found", "%w: %d", err, intId)
+	}
+	return err
+}
+
+// AuthenticateAPIKey находит владельца ключа из заголовка api_key. Роль берётся текущая,
+// поэтому понижение роли или удаление пользователя сразу действует и на его ключи
+func (s *UserService) AuthenticateAPIKey(ctx context.Context, key string) (models.APIKeyPrincipal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return models.APIKeyPrincipal{}, ErrAPIKeyInvalid
+	}
+
+	record, err := s.storage.GetAPIKeyByHash(ctx, hashToken(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return models.APIKeyPrincipal{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return models.APIKeyPrincipal{}, err
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != nil && !now.Before(*record.ExpiresAt) {
+		return models.APIKeyPrincipal{}, ErrAPIKeyInvalid
+	}
+
+	user, err := s.storage.GetByID(ctx, record.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return models.APIKeyPrincipal{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return models.APIKeyPrincipal{}, err
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiKeyTouchInterval {
+		err = s.storage.TouchAPIKey(ctx, record.ID, now)
+		if err != nil {
+			return models.APIKeyPrincipal{}, err
+		}
+	}
+
+	role := user.Role
+	if role == "" {
+		role = models.RoleCustomer
+	}
+
+	return models.APIKeyPrincipal{
+		KeyID:     record.ID,
+		Username:  user.Username,
+		Role:      role,
+		Scopes:    strings.Fields(record.Scopes),
+		ExpiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// validateAPIKey проверяет форму и возвращает права без повторов в порядке запроса
+func validateAPIKey(form models.APIKeyForm) ([]string, error) {
+	var v apperr.Validator
+
+	if v.Required("name", form.Name, "name is required") && utf8.RuneCountInString(strings.TrimSpace(form.Name)) > maxAPIKeyNameLength {
+		v.Check("name", apperr.InvalidField("name", "too_long", "name must be at most %d characters", maxAPIKeyNameLength))
+	}
+
+	scopes := make([]string, 0, len(form.Scopes))
+	seen := map[string]bool{}
+	for _, scope := range form.Scopes {
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+
+		if !knownScope(scope) {
+			v.Check("scopes", apperr.InvalidField("scopes", "invalid_scope", "unknown scope: %q", scope))
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(form.Scopes) == 0 {
+		v.Check("scopes", apperr.InvalidField("scopes", "required", "at least one scope is required"))
+	}
+
+	if form.ExpiresAt != nil && !form.ExpiresAt.After(time.Now()) {
+		v.Check("expiresAt", apperr.InvalidField("expiresAt", "invalid_expiry", "expiresAt must be in the future"))
+	}
+
+	return scopes, v.Err()
+}
+
+func knownScope(scope string) bool {
+	for _, known := range models.APIKeyScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+func apiKeyInfo(key models.APIKey) models.APIKeyInfo {
+	return models.APIKeyInfo{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/lockout"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+)
+
+// Причины неудачного входа в журнале аудита
+const (
+	reasonUnknownUser = "unknown_user"
+	reasonBadPassword = "bad_password"
+	reasonBadCode     = "bad_code"
+)
+
+// Authenticate проверяет имя и пароль. Пока имя или адрес под ограничением, пароль не проверяется вовсе;
+// каждая неудача учитывается и попадает в журнал аудита. Для неизвестного имени ответ тот же,
+// что и для неверного пароля, и считается он так же, чтобы блокировка не выдавала существование пользователя
+func (s *UserService) Authenticate(ctx context.Context, query models.LoginForm, ip string) (models.User, error) {
+	var v apperr.Validator
+	v.Required("username", query.Username, "username is required")
+	v.Required("password", query.Password, "password is required")
+	err := v.Err()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = s.loginAllowed(ctx, query.Username, ip)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.UserExistenceCheck(ctx, query.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		return models.User{}, s.loginFailed(ctx, query.Username, ip, reasonUnknownUser, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = s.PasswordCheck(ctx, query, user)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return models.User{}, s.loginFailed(ctx, query.Username, ip, reasonBadPassword, err)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// LoginSucceeded сбрасывает счётчик неудач пользователя после выдачи токенов
+func (s *UserService) LoginSucceeded(ctx context.Context, user models.User) error {
+	return s.guard.Unlock(ctx, user.Username)
+}
+
+// UnlockUser снимает блокировку входа по просьбе администратора.
+// Блокировка адреса не снимается: она защищает не одного пользователя
+func (s *UserService) UnlockUser(ctx context.Context, user models.User) error {
+	return s.unlock(ctx, user.Username, "admin")
+}
+
+// ClientIP - адрес клиента для ограничения попыток. Заголовки прокси не учитываются:
+// их подставляет сам клиент, и перебор шёл бы с новым адресом на каждую попытку
+func (s *UserService) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *UserService) loginAllowed(ctx context.Context, username string, ip string) error {
+	status, err := s.guard.Check(ctx, username, ip)
+	if err != nil {
+		return err
+	}
+	if !status.Blocked() {
+		return nil
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Type:       audit.LoginBlocked,
+		Username:   username,
+		IP:         ip,
+		Failures:   status.Failures,
+		RetryAfter: status.RetryAfter,
+	})
+
+	if status.Locked {
+		return apperr.RateLimited("login_locked", status.RetryAfter,
+			"too many failed login attempts, try again in %s or reset the password", roundUp(status.RetryAfter))
+	}
+	return apperr.RateLimited("login_throttled", status.RetryAfter,
+		"too many failed login attempts, try again in %s", roundUp(status.RetryAfter))
+}
+
+// loginFailed учитывает неудачу и возвращает cause - ошибку для клиента
+func (s *UserService) loginFailed(ctx context.Context, username string, ip string, reason string, cause error) error {
+	user, address, err := s.guard.Fail(ctx, username, ip)
+	if err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Type:       audit.LoginFailed,
+		Username:   username,
+		IP:         ip,
+		Reason:     reason,
+		Failures:   user.Failures,
+		RetryAfter: user.RetryAfter,
+	})
+
+	if user.Locked {
+		s.recordLock(ctx, audit.AccountLocked, username, ip, user)
+	}
+	if address.Locked {
+		s.recordLock(ctx, audit.AddressLocked, username, ip, address)
+	}
+
+	return cause
+}
+
+func (s *UserService) recordLock(ctx context.Context, eventType string, username string, ip string, status lockout.Status) {
+	s.audit.Record(ctx, audit.Event{
+		Type:       eventType,
+		Username:   username,
+		IP:         ip,
+		Failures:   status.Failures,
+		RetryAfter: status.RetryAfter,
+	})
+}
+
+func (s *UserService) unlock(ctx context.Context, username string, reason string) error {
+	err := s.guard.Unlock(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Type:     audit.AccountUnlocked,
+		Username: username,
+		Reason:   reason,
+	})
+
+	return nil
+}
+
+// roundUp округляет ожидание до секунд вверх, как в заголовке Retry-After
+func roundUp(d time.Duration) time.Duration {
+	return (d + time.Second - 1).Truncate(time.Second)
+}
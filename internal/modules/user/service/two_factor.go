@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/totp"
+)
+
+// recoveryCodeCount - сколько кодов восстановления выдаётся за раз
+const recoveryCodeCount = 10
+
+// totpSkew - допуск в шагах на расхождение часов телефона и сервера
+const totpSkew = 1
+
+var (
+	ErrTOTPNotFound = repository.ErrTOTPNotFound
+
+	ErrTwoFactorCode     = apperr.Unauthorized("invalid_code", "invalid two-factor code")
+	ErrTwoFactorEnabled  = apperr.Conflict("totp_enabled", "two-factor authentication is already enabled")
+	ErrTwoFactorDisabled = apperr.Conflict("totp_not_enabled", "two-factor authentication is not enabled")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorEnabled сообщает, подтвердил ли пользователь привязку аутентификатора
+func (s *UserService) TwoFactorEnabled(ctx context.Context, user models.User) (bool, error) {
+	record, err := s.storage.GetTOTP(ctx, user.ID)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return record.ConfirmedAt != nil, nil
+}
+
+// LoginChallenge выдаётся вместо JWT после верного пароля, если включён второй фактор.
+// Токен одноразовый: неверный код требует снова войти с паролем
+func (s *UserService) LoginChallenge(ctx context.Context, user models.User) (models.LoginChallenge, error) {
+	token, err := s.issueUserToken(ctx, user, models.TokenLoginChallenge, s.opts.ChallengeTTL)
+	if err != nil {
+		return models.LoginChallenge{}, err
+	}
+
+	return models.LoginChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         time.Now().Add(s.opts.ChallengeTTL).UTC(),
+	}, nil
+}
+
+// CompleteLogin обменивает challenge-токен и код второго фактора на пользователя,
+// которому можно выпускать токены. Неверный код считается неудачным входом, как и неверный пароль
+func (s *UserService) CompleteLogin(ctx context.Context, form models.TwoFactorLoginForm, ip string) (models.User, error) {
+	record, err := s.consumeUserToken(ctx, models.TokenLoginChallenge, form.ChallengeToken)
+	if errors.Is(err, ErrUserTokenInvalid) {
+		return models.User{}, challengeError()
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.storage.GetByID(ctx, record.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return models.User{}, challengeError()
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, form.Code)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !ok {
+		return models.User{}, s.loginFailed(ctx, user.Username, ip, reasonBadCode, ErrTwoFactorCode)
+	}
+
+	return user, nil
+}
+
+func challengeError() error {
+	return apperr.Unauthorized("challenge_invalid", "%w: log in with the password again", ErrUserTokenInvalid)
+}
+
+// EnrollTOTP создаёт новый секрет. Второй фактор заработает только после ConfirmTOTP,
+// поэтому незавершённая привязка не мешает входу
+func (s *UserService) EnrollTOTP(ctx context.Context, user models.User) (models.TOTPEnrollment, error) {
+	enabled, err := s.TwoFactorEnabled(ctx, user)
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+	if enabled {
+		return models.TOTPEnrollment{}, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+
+	err = s.storage.SaveTOTP(ctx, models.UserTOTP{UserID: user.ID, Secret: secret})
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+
+	return models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.opts.TOTPIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP включает второй фактор по первому коду из приложения и возвращает коды восстановления
+func (s *UserService) ConfirmTOTP(ctx context.Context, user models.User, code string) (models.RecoveryCodes, error) {
+	record, err := s.storage.GetTOTP(ctx, user.ID)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return models.RecoveryCodes{}, apperr.Conflict("totp_not_enrolled", "%w: start the enrolment first", err)
+	}
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	if record.ConfirmedAt != nil {
+		return models.RecoveryCodes{}, ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(record.Secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return models.RecoveryCodes{}, invalidCode()
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+
+	err = s.storage.ConfirmTOTP(ctx, user.ID, step, hashes)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return models.RecoveryCodes{}, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+
+	return models.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP выключает второй фактор; нужен действующий код или код восстановления
+func (s *UserService) DisableTOTP(ctx context.Context, user models.User, code string) error {
+	err := s.requireSecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+
+	return s.ResetTwoFactor(ctx, user)
+}
+
+// ResetTwoFactor выключает второй фактор без кода: для администратора, когда пользователь
+// потерял и телефон, и коды восстановления
+func (s *UserService) ResetTwoFactor(ctx context.Context, user models.User) error {
+	return s.storage.DeleteTOTP(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новыми
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, user models.User, code string) (models.RecoveryCodes, error) {
+	err := s.requireSecondFactor(ctx, user, code)
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+
+	err = s.storage.ReplaceRecoveryCodes(ctx, user.ID, hashes)
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+
+	return models.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// requireSecondFactor проверяет код для действий над уже включённым вторым фактором
+func (s *UserService) requireSecondFactor(ctx context.Context, user models.User, code string) error {
+	enabled, err := s.TwoFactorEnabled(ctx, user)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorDisabled
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return invalidCode()
+	}
+
+	return nil
+}
+
+// checkSecondFactor принимает код из приложения или код восстановления. Оба гасятся:
+// код из приложения нельзя предъявить повторно, код восстановления - одноразовый
+func (s *UserService) checkSecondFactor(ctx context.Context, user models.User, code string) (bool, error) {
+	record, err := s.storage.GetTOTP(ctx, user.ID)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := totp.Validate(record.Secret, code, time.Now(), totpSkew)
+		if !ok {
+			return false, nil
+		}
+
+		err = s.storage.UseTOTPStep(ctx, user.ID, step)
+		if errors.Is(err, repository.ErrTOTPCodeReused) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err = s.storage.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func invalidCode() error {
+	return apperr.InvalidField("code", "invalid_code", "invalid two-factor code")
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes возвращает коды вида abcde-fghij для показа и их хэши для хранения
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode прощает регистр, пробелы и дефис при вводе
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -1,59 +1,149 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"net/mail"
+	netmail "net/mail"
 	"net/url"
 	"regexp"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
-	"github.com/go-passwd/validator"
 	"github.com/go-playground/form"
 	"golang.org/x/crypto/bcrypt"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/lockout"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
 )
 
 type Userer interface {
 	UserCreate(ctx context.Context, user models.User) error
 	UpdateUser(ctx context.Context, user models.User, updatedUser models.User) error
 	DeleteUser(ctx context.Context, user models.User) error
+	UpdateRole(ctx context.Context, user models.User, role string) error
+	ListRoles(ctx context.Context, role string) ([]models.UserRole, error)
+	DeletedUsers(ctx context.Context) ([]models.UserRole, error)
+	RestoreUser(ctx context.Context, username string) (models.User, error)
 	UserExistenceCheck(ctx context.Context, username string) (models.User, error)
 
+	ValidateUser(ctx context.Context, user models.User) error
+	ValidateUserUpdate(ctx context.Context, user models.User, updated models.User) error
 	UserValidation(ctx context.Context, username string) error
 	EmailValidation(email string) error
 	PasswordValidation(password string) error
+	PasswordStrength(password string) models.PasswordStrength
 	PhoneValidation(phone string) error
+	RoleValidation(role string) error
 
 	PasswordCheck(ctx context.Context, query models.LoginForm, user models.User) error
+	Authenticate(ctx context.Context, query models.LoginForm, ip string) (models.User, error)
+	LoginSucceeded(ctx context.Context, user models.User) error
+	UnlockUser(ctx context.Context, user models.User) error
+	ClientIP(r *http.Request) string
+	EmailVerifiedCheck(user models.User) error
+	SendVerification(ctx context.Context, user models.User) error
+	VerifyEmail(ctx context.Context, token string) error
+	ForgotPassword(ctx context.Context, form models.ForgotPasswordForm) error
+	ResetPassword(ctx context.Context, form models.ResetPasswordForm) error
+
+	TwoFactorEnabled(ctx context.Context, user models.User) (bool, error)
+	LoginChallenge(ctx context.Context, user models.User) (models.LoginChallenge, error)
+	CompleteLogin(ctx context.Context, form models.TwoFactorLoginForm, ip string) (models.User, error)
+	EnrollTOTP(ctx context.Context, user models.User) (models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, user models.User, code string) (models.RecoveryCodes, error)
+	DisableTOTP(ctx context.Context, user models.User, code string) error
+	ResetTwoFactor(ctx context.Context, user models.User) error
+	RegenerateRecoveryCodes(ctx context.Context, user models.User, code string) (models.RecoveryCodes, error)
 	PasswordEncryption(password string) (string, error)
 
-	UserRequestRedirection(user models.User) (*http.Response, error)
-	DecodeURl(params *models.LoginForm, values url.Values) error
+	CreateAPIKey(ctx context.Context, user models.User, form models.APIKeyForm) (models.NewAPIKey, error)
+	ListAPIKeys(ctx context.Context, user models.User) ([]models.APIKeyInfo, error)
+	RevokeAPIKey(ctx context.Context, user models.User, id string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (models.APIKeyPrincipal, error)
+
+	RegisterUser(ctx context.Context, user models.User) error
+	DecodeURl(params interface{}, values url.Values) error
+	DecodeLogin(r *http.Request) (models.LoginForm, error)
 	URLParam(r *http.Request, param string) string
-	MakeToken(name string) (string, error)
+	MakeToken(name string, role string, expiresAt time.Time) (string, error)
+	IssueTokens(ctx context.Context, user models.User) (models.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (models.TokenPair, error)
+	RevokeTokens(ctx context.Context, jti string, expiresAt time.Time, refreshToken string) error
+	IsRevoked(ctx context.Context, jti string) bool
+	RefreshTokenFromRequest(r *http.Request) string
 	SetCookie(w http.ResponseWriter, login bool, value string)
+	SetRefreshCookie(w http.ResponseWriter, value string)
 
 	Decode(r io.ReadCloser, data interface{}) error
 }
 
+const (
+	refreshCookie = "refresh_token"
+	refreshHeader = "X-Refresh-Token"
+
+	maxLoginBodySize = 1 << 16
+)
+
+var (
+	ErrRefreshTokenInvalid = repository.ErrRefreshTokenInvalid
+	ErrRefreshTokenReused  = repository.ErrRefreshTokenReused
+	ErrUserNotFound        = repository.ErrUserNotFound
+
+	ErrInvalidCredentials = apperr.Unauthorized("invalid_credentials", "invalid username or password")
+
+	ErrUnsupportedLoginBody = errors.New("unsupported login content type, use application/json or application/x-www-form-urlencoded")
+)
+
+// Options - настройки токенов и писем сервиса пользователей
+type Options struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	VerifyTTL  time.Duration
+	ResetTTL   time.Duration
+	// RequireVerifiedEmail закрывает вход до подтверждения адреса почты
+	RequireVerifiedEmail bool
+	// SigningKey подписывает токены из писем
+	SigningKey []byte
+	// BaseURL - адрес сайта для ссылок в письмах
+	BaseURL string
+	// ChallengeTTL - срок действия challenge-токена при входе со вторым фактором
+	ChallengeTTL time.Duration
+	// TOTPIssuer - имя сервиса в приложении-аутентификаторе
+	TOTPIssuer string
+}
+
 type UserService struct {
 	storage   repository.UserRepository
 	tokenAuth *jwtauth.JWTAuth
+	passwords *password.Checker
+	mailer    mail.Mailer
+	guard     *lockout.Guard
+	audit     audit.Recorder
+	opts      Options
 }
 
-func NewUserService(storage repository.UserRepository, tokenAuth *jwtauth.JWTAuth) *UserService {
+func NewUserService(storage repository.UserRepository, tokenAuth *jwtauth.JWTAuth, passwords *password.Checker, mailer mail.Mailer, guard *lockout.Guard, recorder audit.Recorder, opts Options) *UserService {
 	return &UserService{
 		storage:   storage,
 		tokenAuth: tokenAuth,
+		passwords: passwords,
+		mailer:    mailer,
+		guard:     guard,
+		audit:     recorder,
+		opts:      opts,
 	}
 }
 
@@ -61,8 +151,44 @@ func (s *UserService) Decode(r io.ReadCloser, data interface{}) error {
 	return json.NewDecoder(r).Decode(data)
 }
 
+// UserCreate создаёт пользователя и, если адрес ещё не подтверждён, отправляет письмо со ссылкой.
+// Пользователей из админки и фикстур создают уже подтверждёнными
 func (s *UserService) UserCreate(ctx context.Context, user models.User) error {
-	return s.storage.Create(ctx, user)
+	err := s.storage.Create(ctx, user)
+	if err != nil || user.EmailVerified {
+		return err
+	}
+
+	created, err := s.storage.GetByUsername(ctx, user.Username)
+	if err != nil {
+		return err
+	}
+
+	return s.SendVerification(ctx, created)
+}
+
+// ValidateUser проверяет все поля пользователя из запроса и возвращает ошибки по каждому полю сразу
+func (s *UserService) ValidateUser(ctx context.Context, user models.User) error {
+	return s.validateUser(ctx, user, "")
+}
+
+// ValidateUserUpdate проверяет новые данные пользователя так же, как ValidateUser,
+// но не считает конфликтом юзернейм, который у пользователя уже есть
+func (s *UserService) ValidateUserUpdate(ctx context.Context, user models.User, updated models.User) error {
+	return s.validateUser(ctx, updated, user.Username)
+}
+
+func (s *UserService) validateUser(ctx context.Context, user models.User, currentUsername string) error {
+	var v apperr.Validator
+
+	if v.Required("username", user.Username, "username is required") && user.Username != currentUsername {
+		v.Check("username", s.UserValidation(ctx, user.Username))
+	}
+	v.Check("email", s.EmailValidation(user.Email))
+	v.Check("password", s.PasswordValidation(user.Password))
+	v.Check("phone", s.PhoneValidation(user.Phone))
+
+	return v.Err()
 }
 
 func (s *UserService) UserValidation(ctx context.Context, username string) error {
@@ -71,26 +197,47 @@ func (s *UserService) UserValidation(ctx context.Context, username string) error
 		return err
 	}
 	if user.ID != 0 {
-		return fmt.Errorf("username not available")
+		return apperr.Conflict("username_taken", "username not available")
 	}
 	return nil
 }
 
 func (s *UserService) EmailValidation(email string) error {
-	_, err := mail.ParseAddress(email)
-	return err
+	_, err := netmail.ParseAddress(email)
+	if err != nil {
+		return apperr.InvalidField("email", "invalid_email", "invalid email: %v", err)
+	}
+	return nil
 }
 
+// PasswordValidation проверяет пароль по настроенной политике и возвращает все нарушения сразу
 func (s *UserService) PasswordValidation(password string) error {
-	passwordValidator := validator.New(
-		validator.MinLength(5, errors.New("password is to short")),
-		validator.MaxLength(16, errors.New("password is to long")),
-		validator.ContainsOnly(
-			"abcdefghijklmnopqrstuvwxyz-.@!$&",
-			errors.New("password contains invalid characters"),
-		),
-	)
-	return passwordValidator.Validate(password)
+	_, violations := s.passwords.Check(password)
+
+	var v apperr.Validator
+	for _, violation := range violations {
+		v.Check("password", apperr.InvalidField("password", violation.Code, "%s", violation.Message))
+	}
+
+	return v.Err()
+}
+
+// PasswordStrength оценивает пароль, не сохраняя его, чтобы форма могла подсказать пользователю
+func (s *UserService) PasswordStrength(password string) models.PasswordStrength {
+	strength, violations := s.passwords.Check(password)
+
+	result := models.PasswordStrength{
+		Score:   strength.Score,
+		Label:   strength.Label,
+		Entropy: strength.Entropy,
+		Valid:   len(violations) == 0,
+		Errors:  []models.PasswordError{},
+	}
+	for _, violation := range violations {
+		result.Errors = append(result.Errors, models.PasswordError{Code: violation.Code, Message: violation.Message})
+	}
+
+	return result
 }
 
 func (s *UserService) PhoneValidation(phone string) error {
@@ -98,34 +245,73 @@ func (s *UserService) PhoneValidation(phone string) error {
 	re := regexp.MustCompile(pattern)
 	phoneNumber := re.Find([]byte(phone))
 	if string(phoneNumber) != phone {
-		return errors.New("invalid phone number")
+		return apperr.InvalidField("phone", "invalid_phone", "invalid phone number")
 	}
 	return nil
 }
 
+func (s *UserService) RoleValidation(role string) error {
+	switch role {
+	case models.RoleCustomer, models.RoleStaff, models.RoleAdmin:
+		return nil
+	}
+	return apperr.InvalidField("role", "invalid_role", "invalid role: %s", role)
+}
+
 func (s *UserService) PasswordEncryption(password string) (string, error) {
 	hpass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(hpass), err
 }
 
-func (s *UserService) UserRequestRedirection(user models.User) (*http.Response, error) {
-	encodedUser, err := json.Marshal(user)
+// RegisterUser регистрирует покупателя из запроса: проверяет поля, хэширует пароль и создаёт
+// пользователя. Роль назначает только администратор, адрес подтверждается по ссылке из письма
+func (s *UserService) RegisterUser(ctx context.Context, user models.User) error {
+	user.Role = models.RoleCustomer
+	user.EmailVerified = false
+
+	err := s.ValidateUser(ctx, user)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequest("POST", "http://localhost:8080/user", bytes.NewBuffer(encodedUser))
+	user.Password, err = s.PasswordEncryption(user.Password)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	return client.Do(req)
+	return s.UserCreate(ctx, user)
 }
 
-func (s *UserService) DecodeURl(params *models.LoginForm, values url.Values) error {
-	return form.NewDecoder().Decode(&params, values)
+func (s *UserService) DecodeURl(params interface{}, values url.Values) error {
+	return form.NewDecoder().Decode(params, values)
+}
+
+// DecodeLogin читает имя и пароль из тела POST /user/login: JSON или HTML-форма.
+// В теле пароль не попадает в журналы доступа, историю браузера и логи прокси
+func (s *UserService) DecodeLogin(r *http.Request) (models.LoginForm, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return models.LoginForm{}, ErrUnsupportedLoginBody
+	}
+
+	var query models.LoginForm
+	switch mediaType {
+	case "application/json":
+		err = json.NewDecoder(io.LimitReader(r.Body, maxLoginBodySize)).Decode(&query)
+	case "application/x-www-form-urlencoded":
+		r.Body = io.NopCloser(io.LimitReader(r.Body, maxLoginBodySize))
+		err = r.ParseForm()
+		if err == nil {
+			err = s.DecodeURl(&query, r.PostForm)
+		}
+	default:
+		return models.LoginForm{}, ErrUnsupportedLoginBody
+	}
+	if err != nil {
+		return models.LoginForm{}, err
+	}
+
+	return query, nil
 }
 
 func (s *UserService) UserExistenceCheck(ctx context.Context, username string) (models.User, error) {
@@ -135,7 +321,7 @@ func (s *UserService) UserExistenceCheck(ctx context.Context, username string) (
 	}
 
 	if user.ID == 0 {
-		return models.User{}, fmt.Errorf("user does not exist: %s", username)
+		return models.User{}, apperr.NotFound("user_not_found", "%w: %s", ErrUserNotFound, username)
 	}
 
 	return user, nil
@@ -144,19 +330,184 @@ func (s *UserService) UserExistenceCheck(ctx context.Context, username string) (
 func (s *UserService) PasswordCheck(ctx context.Context, query models.LoginForm, user models.User) error {
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(query.Password))
 	if err != nil {
-		return fmt.Errorf("wrong password")
+		return ErrInvalidCredentials
 	}
 	return nil
 }
 
-func (s *UserService) MakeToken(name string) (string, error) {
-	_, tokenString, err := s.tokenAuth.Encode(map[string]interface{}{"username": name})
+// MakeToken выпускает короткоживущий access-токен; jti позволяет отозвать его до истечения срока
+func (s *UserService) MakeToken(name string, role string, expiresAt time.Time) (string, error) {
+	if role == "" {
+		role = models.RoleCustomer
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{
+		"username": name,
+		"role":     role,
+		"jti":      jti,
+	}
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiry(claims, expiresAt)
+
+	_, tokenString, err := s.tokenAuth.Encode(claims)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
+// IssueTokens выпускает пару access- и refresh-токенов для пользователя
+func (s *UserService) IssueTokens(ctx context.Context, user models.User) (models.TokenPair, error) {
+	refreshToken, record, err := s.newRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	record.UserID = user.ID
+
+	err = s.storage.CreateRefreshToken(ctx, record)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return s.tokenPair(user, refreshToken)
+}
+
+// RefreshTokens обменивает refresh-токен на новую пару токенов, старый refresh-токен при этом гасится
+func (s *UserService) RefreshTokens(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	if refreshToken == "" {
+		return models.TokenPair{}, refreshError(ErrRefreshTokenInvalid)
+	}
+
+	nextToken, record, err := s.newRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	current, err := s.storage.RotateRefreshToken(ctx, hashToken(refreshToken), record)
+	if errors.Is(err, ErrRefreshTokenInvalid) || errors.Is(err, ErrRefreshTokenReused) {
+		return models.TokenPair{}, refreshError(err)
+	}
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	user, err := s.storage.GetByID(ctx, current.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return models.TokenPair{}, refreshError(ErrRefreshTokenInvalid)
+	}
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return s.tokenPair(user, nextToken)
+}
+
+// refreshError помечает отказ в обмене refresh-токена; клиенту нужно войти заново
+func refreshError(err error) error {
+	code := "refresh_token_invalid"
+	if errors.Is(err, ErrRefreshTokenReused) {
+		code = "refresh_token_reused"
+	}
+	return apperr.Unauthorized(code, "%w", err)
+}
+
+// RevokeTokens отзывает access-токен по jti и refresh-токен, если он передан
+func (s *UserService) RevokeTokens(ctx context.Context, jti string, expiresAt time.Time, refreshToken string) error {
+	if jti != "" {
+		err := s.storage.RevokeToken(ctx, jti, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if refreshToken != "" {
+		return s.storage.RevokeRefreshToken(ctx, hashToken(refreshToken))
+	}
+
+	return nil
+}
+
+// IsRevoked сообщает, отозван ли access-токен. При ошибке базы токен считается отозванным
+func (s *UserService) IsRevoked(ctx context.Context, jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	revoked, err := s.storage.IsRevoked(ctx, jti)
+	if err != nil {
+		return true
+	}
+
+	return revoked
+}
+
+// RefreshTokenFromRequest ищет refresh-токен в теле запроса, заголовке X-Refresh-Token и cookie
+func (s *UserService) RefreshTokenFromRequest(r *http.Request) string {
+	var form models.RefreshForm
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&form)
+	}
+	if form.RefreshToken != "" {
+		return form.RefreshToken
+	}
+
+	if token := r.Header.Get(refreshHeader); token != "" {
+		return token
+	}
+
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (s *UserService) tokenPair(user models.User, refreshToken string) (models.TokenPair, error) {
+	expiresAt := time.Now().Add(s.opts.AccessTTL)
+
+	accessToken, err := s.MakeToken(user.Username, user.Role, expiresAt)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt.UTC(),
+	}, nil
+}
+
+func (s *UserService) newRefreshToken() (string, models.RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	return token, models.RefreshToken{
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.opts.RefreshTTL),
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *UserService) SetCookie(w http.ResponseWriter, login bool, value string) {
 	if login {
 		http.SetCookie(w, &http.Cookie{
@@ -178,14 +529,120 @@ func (s *UserService) SetCookie(w http.ResponseWriter, login bool, value string)
 	return
 }
 
+// SetRefreshCookie сохраняет refresh-токен в cookie, пустое значение удаляет cookie
+func (s *UserService) SetRefreshCookie(w http.ResponseWriter, value string) {
+	cookie := &http.Cookie{
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/user",
+		Name:     refreshCookie,
+		Value:    value,
+	}
+
+	if value == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = time.Now().Add(s.opts.RefreshTTL)
+	}
+
+	http.SetCookie(w, cookie)
+}
+
 func (s *UserService) URLParam(r *http.Request, param string) string {
 	return chi.URLParam(r, param)
 }
 
+// UpdateUser сохраняет изменения. Подтвердить адрес можно только по ссылке из письма,
+// поэтому флаг из запроса не применяется, а на новый адрес уходит письмо
 func (s *UserService) UpdateUser(ctx context.Context, user models.User, updatedUser models.User) error {
-	return s.storage.UpdateUser(ctx, user, updatedUser)
+	updatedUser.EmailVerified = false
+
+	err := s.storage.UpdateUser(ctx, user, updatedUser)
+	if err != nil {
+		return err
+	}
+
+	if updatedUser.Email == "" || updatedUser.Email == user.Email {
+		return nil
+	}
+
+	updated, err := s.storage.GetByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.SendVerification(ctx, updated)
 }
 
 func (s *UserService) DeleteUser(ctx context.Context, user models.User) error {
 	return s.storage.DeleteUser(ctx, user)
 }
+
+func (s *UserService) UpdateRole(ctx context.Context, user models.User, role string) error {
+	err := s.RoleValidation(role)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.UpdateRole(ctx, user, role)
+}
+
+func (s *UserService) ListRoles(ctx context.Context, role string) ([]models.UserRole, error) {
+	if role != "" {
+		err := s.RoleValidation(role)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := s.storage.ListRoles(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if users == nil {
+		users = []models.UserRole{}
+	}
+
+	return users, nil
+}
+
+func (s *UserService) DeletedUsers(ctx context.Context) ([]models.UserRole, error) {
+	users, err := s.storage.ListDeleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if users == nil {
+		users = []models.UserRole{}
+	}
+
+	return users, nil
+}
+
+// RestoreUser снимает пометку об удалении. Если имя уже занял другой пользователь,
+// восстановление невозможно
+func (s *UserService) RestoreUser(ctx context.Context, username string) (models.User, error) {
+	err := s.UserValidation(ctx, username)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.storage.GetDeletedByUsername(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		return models.User{}, apperr.NotFound("user_not_found", "%w: no deleted user %s", err, username)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = s.storage.RestoreUser(ctx, user)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user.UserStatus = 0
+	user.Version++
+
+	return user, nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/memdb"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
+)
+
+func newMemoryService(t *testing.T, usernames ...string) *UserService {
+	passwords, err := password.NewChecker(config.Default().Auth.Password)
+	require.NoError(t, err)
+
+	s := NewUserService(repository.NewUserMemory(memdb.New()), nil, passwords, nil, nil, nil, Options{})
+	for _, username := range usernames {
+		err := s.storage.Create(context.Background(), models.User{Username: username, Email: username + "@example.com"})
+		require.NoError(t, err)
+	}
+	return s
+}
+
+func TestValidateUserUpdate(t *testing.T) {
+	s := newMemoryService(t, "alice", "bob")
+	ctx := context.Background()
+
+	alice, err := s.UserExistenceCheck(ctx, "alice")
+	require.NoError(t, err)
+
+	updated := models.User{Username: "alice", Email: "alice@example.org", Password: "kettle-secret"}
+	assert.NoError(t, s.ValidateUserUpdate(ctx, alice, updated), "Неизменённый юзернейм не должен считаться занятым")
+
+	updated.Username = "carol"
+	assert.NoError(t, s.ValidateUserUpdate(ctx, alice, updated))
+
+	updated.Username = "bob"
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(s.ValidateUserUpdate(ctx, alice, updated)))
+
+	updated.Username = "alice"
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(s.ValidateUser(ctx, updated)))
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules/user/repository"
+)
+
+var (
+	ErrUserTokenInvalid = repository.ErrUserTokenInvalid
+
+	ErrEmailNotVerified = apperr.Forbidden("email_not_verified", "email address is not verified")
+)
+
+// EmailVerifiedCheck закрывает вход, пока адрес не подтверждён. Проверяется после пароля,
+// чтобы ответ не подсказывал, существует ли пользователь
+func (s *UserService) EmailVerifiedCheck(user models.User) error {
+	if s.opts.RequireVerifiedEmail && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// SendVerification отправляет на адрес пользователя ссылку для подтверждения
+func (s *UserService) SendVerification(ctx context.Context, user models.User) error {
+	token, err := s.issueUserToken(ctx, user, models.TokenVerifyEmail, s.opts.VerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Подтвердите адрес электронной почты",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Чтобы подтвердить адрес, перейдите по ссылке:\n%s\n\n"+
+			"Или передайте токен в POST /user/verify:\n%s\n\n"+
+			"Ссылка действует до %s.\n",
+			user.Username, s.link("/verify", token), token, s.expiry(s.opts.VerifyTTL)),
+	})
+}
+
+// VerifyEmail подтверждает адрес по токену из письма
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	record, err := s.consumeUserToken(ctx, models.TokenVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.MarkEmailVerified(ctx, record.UserID, record.Email)
+	if errors.Is(err, ErrUserTokenInvalid) {
+		return tokenError(err)
+	}
+
+	return err
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля. Неизвестное имя или адрес не считается
+// ошибкой: ответ не должен подсказывать, зарегистрирован ли пользователь
+func (s *UserService) ForgotPassword(ctx context.Context, form models.ForgotPasswordForm) error {
+	var user models.User
+	var err error
+
+	switch {
+	case form.Username != "":
+		user, err = s.storage.GetByUsername(ctx, form.Username)
+	case form.Email != "":
+		user, err = s.storage.GetByEmail(ctx, form.Email)
+	default:
+		return apperr.Invalid("required", "username or email is required")
+	}
+	if errors.Is(err, ErrUserNotFound) || (err == nil && (user.ID == 0 || user.Email == "")) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.issueUserToken(ctx, user, models.TokenResetPassword, s.opts.ResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Чтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Или передайте токен в POST /user/password/reset:\n%s\n\n"+
+			"Ссылка действует до %s. Если вы не запрашивали сброс, просто проигнорируйте это письмо.\n",
+			user.Username, s.link("/reset-password", token), token, s.expiry(s.opts.ResetTTL)),
+	})
+}
+
+// ResetPassword задаёт новый пароль по токену из письма, завершает все сессии пользователя
+// и снимает блокировку входа. Пароль проверяется до погашения токена, чтобы ошибка в пароле не сжигала ссылку
+func (s *UserService) ResetPassword(ctx context.Context, form models.ResetPasswordForm) error {
+	if !s.validSignature(models.TokenResetPassword, form.Token) {
+		return tokenError(ErrUserTokenInvalid)
+	}
+
+	err := s.PasswordValidation(form.Password)
+	if err != nil {
+		return err
+	}
+
+	hash, err := s.PasswordEncryption(form.Password)
+	if err != nil {
+		return err
+	}
+
+	record, err := s.consumeUserToken(ctx, models.TokenResetPassword, form.Token)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.ResetPassword(ctx, record.UserID, hash)
+	if errors.Is(err, ErrUserNotFound) {
+		return tokenError(ErrUserTokenInvalid)
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := s.storage.GetByID(ctx, record.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = s.unlock(ctx, user.Username, "password_reset")
+	if err != nil {
+		return err
+	}
+
+	// Письмо со ссылкой дошло до владельца адреса, значит, адрес заодно подтверждён
+	err = s.storage.MarkEmailVerified(ctx, record.UserID, record.Email)
+	if errors.Is(err, ErrUserTokenInvalid) {
+		return nil
+	}
+
+	return err
+}
+
+// issueUserToken сохраняет хэш нового токена и возвращает сам токен для письма.
+// Токен - случайная строка и её подпись, привязанная к назначению: подделанный
+// или предъявленный не в ту ручку токен отсекается без обращения к базе
+func (s *UserService) issueUserToken(ctx context.Context, user models.User, purpose string, ttl time.Duration) (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := secret + "." + s.sign(purpose, secret)
+
+	err = s.storage.CreateUserToken(ctx, models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *UserService) consumeUserToken(ctx context.Context, purpose string, token string) (models.UserToken, error) {
+	if !s.validSignature(purpose, token) {
+		return models.UserToken{}, tokenError(ErrUserTokenInvalid)
+	}
+
+	record, err := s.storage.ConsumeUserToken(ctx, purpose, hashToken(token))
+	if errors.Is(err, ErrUserTokenInvalid) {
+		return models.UserToken{}, tokenError(err)
+	}
+
+	return record, err
+}
+
+func (s *UserService) sign(purpose string, secret string) string {
+	mac := hmac.New(sha256.New, s.opts.SigningKey)
+	mac.Write([]byte(purpose + ":" + secret))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *UserService) validSignature(purpose string, token string) bool {
+	secret, signature, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(purpose, secret)))
+}
+
+// tokenError - токен из письма подделан, истёк или уже использован; нужно запросить новое письмо
+func tokenError(err error) error {
+	return apperr.Invalid("token_invalid", "%w", err)
+}
+
+func (s *UserService) send(ctx context.Context, msg mail.Message) error {
+	err := s.mailer.Send(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+	return nil
+}
+
+func (s *UserService) link(path string, token string) string {
+	return strings.TrimRight(s.opts.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func (s *UserService) expiry(ttl time.Duration) string {
+	return time.Now().Add(ttl).UTC().Format("02.01.2006 15:04 UTC")
+}
@@ -0,0 +1,178 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxBcryptLength - bcrypt не принимает пароли длиннее 72 байт
+const maxBcryptLength = 72
+
+//go:embed common.txt
+var commonPasswords string
+
+// Policy - требования к паролю. Пароль не короче PassphraseLength считается парольной фразой
+// и освобождается от требований к классам символов: длина важнее разнообразия
+type Policy struct {
+	MinLength        int    `yaml:"minLength" json:"minLength"`
+	MaxLength        int    `yaml:"maxLength" json:"maxLength"`
+	RequireLower     bool   `yaml:"requireLower" json:"requireLower"`
+	RequireUpper     bool   `yaml:"requireUpper" json:"requireUpper"`
+	RequireDigit     bool   `yaml:"requireDigit" json:"requireDigit"`
+	RequireSymbol    bool   `yaml:"requireSymbol" json:"requireSymbol"`
+	PassphraseLength int    `yaml:"passphraseLength" json:"passphraseLength"`
+	MinScore         int    `yaml:"minScore" json:"minScore"`
+	BreachedList     string `yaml:"breachedList" json:"breachedList"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:        8,
+		MaxLength:        64,
+		PassphraseLength: 20,
+		MinScore:         2,
+	}
+}
+
+// Validate возвращает все ошибки настроек сразу; имена полей - как в файле конфигурации
+func (p Policy) Validate() error {
+	var errs []error
+
+	if p.MinLength < 1 {
+		errs = append(errs, errors.New("auth.password.minLength must be positive"))
+	}
+	if p.MaxLength < p.MinLength {
+		errs = append(errs, errors.New("auth.password.maxLength must not be less than minLength"))
+	}
+	if p.MaxLength > maxBcryptLength {
+		errs = append(errs, fmt.Errorf("auth.password.maxLength must be at most %d", maxBcryptLength))
+	}
+	if p.PassphraseLength < 0 {
+		errs = append(errs, errors.New("auth.password.passphraseLength must not be negative"))
+	}
+	if p.MinScore < 0 || p.MinScore > MaxScore {
+		errs = append(errs, fmt.Errorf("auth.password.minScore must be between 0 and %d", MaxScore))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Violation - нарушенное требование политики; Code стабилен и отдаётся клиенту
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// Checker проверяет пароли по политике и списку распространённых и утёкших паролей
+type Checker struct {
+	policy   Policy
+	breached map[string]struct{}
+}
+
+// NewChecker загружает встроенный список распространённых паролей и,
+// если задан BreachedList, дополнительный список из файла: по одному паролю в строке
+func NewChecker(policy Policy) (*Checker, error) {
+	c := &Checker{
+		policy:   policy,
+		breached: map[string]struct{}{},
+	}
+
+	c.add(commonPasswords)
+
+	if policy.BreachedList != "" {
+		data, err := os.ReadFile(policy.BreachedList)
+		if err != nil {
+			return nil, fmt.Errorf("read breached password list: %w", err)
+		}
+		c.add(string(data))
+	}
+
+	return c, nil
+}
+
+func (c *Checker) add(list string) {
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c.breached[strings.ToLower(line)] = struct{}{}
+	}
+}
+
+func (c *Checker) Policy() Policy {
+	return c.policy
+}
+
+// Breached сообщает, есть ли пароль в списке; регистр не учитывается
+func (c *Checker) Breached(password string) bool {
+	_, ok := c.breached[strings.ToLower(strings.TrimSpace(password))]
+	return ok
+}
+
+// Check оценивает пароль и возвращает все нарушенные требования политики
+func (c *Checker) Check(password string) (Strength, []Violation) {
+	var violations []Violation
+	add := func(code string, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < c.policy.MinLength {
+		add("too_short", "password must be at least %d characters", c.policy.MinLength)
+	}
+	if length > c.policy.MaxLength || len(password) > maxBcryptLength {
+		add("too_long", "password must be at most %d characters", c.policy.MaxLength)
+	}
+
+	for _, r := range password {
+		if unicode.IsControl(r) {
+			add("invalid_characters", "password contains control characters")
+			break
+		}
+	}
+
+	classes := classify(password)
+	passphrase := c.policy.PassphraseLength > 0 && length >= c.policy.PassphraseLength
+	if !passphrase {
+		requirements := []struct {
+			required bool
+			present  bool
+			code     string
+			what     string
+		}{
+			{c.policy.RequireLower, classes.lower, "missing_lower", "a lowercase letter"},
+			{c.policy.RequireUpper, classes.upper, "missing_upper", "an uppercase letter"},
+			{c.policy.RequireDigit, classes.digit, "missing_digit", "a digit"},
+			{c.policy.RequireSymbol, classes.symbol, "missing_symbol", "a symbol"},
+		}
+		for _, req := range requirements {
+			if req.required && !req.present {
+				add(req.code, "password must contain %s", req.what)
+			}
+		}
+	}
+
+	breached := c.Breached(password)
+	if breached {
+		add("breached", "password is too common or has appeared in a data breach")
+	}
+
+	strength := Estimate(password)
+	if breached {
+		// Пароль из словаря подбирается первым, сколько бы символов в нём ни было
+		strength = newStrength(0)
+	}
+	if strength.Score < c.policy.MinScore {
+		add("too_weak", "password is too weak: score %d, at least %d required", strength.Score, c.policy.MinScore)
+	}
+
+	return strength, violations
+}
@@ -0,0 +1,105 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func codes(violations []Violation) []string {
+	var result []string
+	for _, v := range violations {
+		result = append(result, v.Code)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.RequireDigit = true
+	policy.RequireUpper = true
+
+	checker, err := NewChecker(policy)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		password string
+		expected []string
+	}{
+		{
+			name:     "strong",
+			password: "Blue-Kettle-42",
+			expected: nil,
+		},
+		{
+			name:     "passphrase skips character classes",
+			password: "correct horse battery staple",
+			expected: nil,
+		},
+		{
+			name:     "short and missing classes",
+			password: "kettle",
+			expected: []string{"too_short", "missing_upper", "missing_digit", "too_weak"},
+		},
+		{
+			name:     "common password",
+			password: "Password123",
+			expected: []string{"breached", "too_weak"},
+		},
+		{
+			name:     "too long",
+			password: "Aa1" + string(make([]byte, 70)),
+			expected: []string{"too_long", "invalid_characters"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, violations := checker.Check(tt.password)
+			assert.Equal(t, tt.expected, codes(violations))
+		})
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	assert.Equal(t, 0, Estimate("").Score)
+	assert.Equal(t, 0, Estimate("aaaaaaaa").Score)
+	assert.Less(t, Estimate("abcdefgh").Entropy, Estimate("kqzvmwrt").Entropy)
+	assert.Equal(t, "very strong", Estimate("correct horse battery staple").Label)
+}
+
+func TestNewChecker_BreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# leaked\nBlue-Kettle-42\n"), 0o600))
+
+	policy := DefaultPolicy()
+	policy.BreachedList = path
+
+	checker, err := NewChecker(policy)
+	require.NoError(t, err)
+
+	assert.True(t, checker.Breached("blue-kettle-42"))
+	assert.True(t, checker.Breached("qwerty"))
+	assert.False(t, checker.Breached("Green-Kettle-42"))
+
+	policy.BreachedList = filepath.Join(t.TempDir(), "missing.txt")
+	_, err = NewChecker(policy)
+	assert.Error(t, err)
+}
+
+func TestPolicyValidate(t *testing.T) {
+	assert.NoError(t, DefaultPolicy().Validate())
+
+	policy := DefaultPolicy()
+	policy.MinLength = 10
+	policy.MaxLength = 100
+	policy.MinScore = 5
+
+	err := policy.Validate()
+	assert.ErrorContains(t, err, "maxLength must be at most 72")
+	assert.ErrorContains(t, err, "minScore must be between 0 and 4")
+}
@@ -0,0 +1,103 @@
+package password
+
+import (
+	"math"
+	"unicode"
+)
+
+// MaxScore - оценка самого надёжного пароля; шкала 0-4, как у zxcvbn
+const MaxScore = 4
+
+// scoreThresholds - нижние границы энтропии в битах для оценок 1-4
+var scoreThresholds = []float64{28, 36, 60, 128}
+
+var scoreLabels = []string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// Strength - оценка надёжности пароля для клиента
+type Strength struct {
+	Score   int     `json:"score"`
+	Label   string  `json:"label"`
+	Entropy float64 `json:"entropy"`
+}
+
+func newStrength(entropy float64) Strength {
+	score := 0
+	for _, threshold := range scoreThresholds {
+		if entropy >= threshold {
+			score++
+		}
+	}
+
+	return Strength{
+		Score:   score,
+		Label:   scoreLabels[score],
+		Entropy: math.Round(entropy*10) / 10,
+	}
+}
+
+type charClasses struct {
+	lower, upper, digit, symbol, other bool
+}
+
+func classify(password string) charClasses {
+	var c charClasses
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < unicode.MaxASCII:
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// poolSize - размер алфавита, из которого мог быть набран пароль
+func (c charClasses) poolSize() int {
+	size := 0
+	if c.lower {
+		size += 26
+	}
+	if c.upper {
+		size += 26
+	}
+	if c.digit {
+		size += 10
+	}
+	if c.symbol {
+		size += 33
+	}
+	if c.other {
+		size += 100
+	}
+	return size
+}
+
+// Estimate оценивает энтропию пароля по размеру алфавита и длине. Повторы и
+// последовательности вроде "aaa" или "123" почти не добавляют перебора,
+// поэтому такие символы считаются за половину
+func Estimate(password string) Strength {
+	pool := classify(password).poolSize()
+	if pool == 0 {
+		return newStrength(0)
+	}
+
+	length := 0.0
+	var prev rune
+	for i, r := range password {
+		if i > 0 && (r == prev || r == prev+1 || r == prev-1) {
+			length += 0.5
+		} else {
+			length++
+		}
+		prev = r
+	}
+
+	return newStrength(length * math.Log2(float64(pool)))
+}
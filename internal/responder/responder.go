@@ -2,10 +2,15 @@ package responder
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 )
 
 type Logger interface {
@@ -13,16 +18,86 @@ type Logger interface {
 	Info(msg string, fields ...zapcore.Field)
 }
 
-type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
+// ProblemContentType - тип тела ответа об ошибке по RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix - тип проблемы строится из её кода, поэтому остаётся стабильным между версиями
+const problemTypePrefix = "urn:petstore:problem:"
+
+// Problem - тело ответа об ошибке по RFC 7807. Code дублирует хвост Type для удобства клиентов,
+// Errors перечисляет ошибки в отдельных полях запроса
+type Problem struct {
+	Type   string              `json:"type"`
+	Title  string              `json:"title"`
+	Status int                 `json:"status"`
+	Detail string              `json:"detail,omitempty"`
+	Code   string              `json:"code"`
+	Errors []apperr.FieldError `json:"errors,omitempty"`
+}
+
+// Коды ошибок, которые не пришли из сервисного слоя
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInternal             = "internal"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+)
+
+// kindStatuses сопоставляет категории ошибок сервисов HTTP-статусам
+var kindStatuses = map[apperr.Kind]int{
+	apperr.KindValidation:   http.StatusBadRequest,
+	apperr.KindNotFound:     http.StatusNotFound,
+	apperr.KindConflict:     http.StatusConflict,
+	apperr.KindUnauthorized: http.StatusUnauthorized,
+	apperr.KindForbidden:    http.StatusForbidden,
+	apperr.KindRateLimited:  http.StatusTooManyRequests,
+}
+
+// NewProblem собирает проблему; если err типизирована, её код и поля имеют приоритет над code
+func NewProblem(status int, code string, err error) Problem {
+	problem := Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+	}
+
+	if err != nil {
+		problem.Detail = err.Error()
+	}
+
+	if appErr, ok := apperr.As(err); ok {
+		problem.Code = appErr.Code
+		problem.Errors = appErr.Fields
+	}
+
+	problem.Type = problemTypePrefix + problem.Code
+
+	return problem
+}
+
+// WriteProblem отправляет проблему клиенту
+func WriteProblem(w http.ResponseWriter, problem Problem) error {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	return json.NewEncoder(w).Encode(problem)
 }
 
 type Responder interface {
 	OutputJSON(w http.ResponseWriter, responseData interface{})
+	Error(w http.ResponseWriter, err error)
 	ErrorBadRequest(w http.ResponseWriter, err error)
 	ErrorInternal(w http.ResponseWriter, err error)
+	ErrorNotFound(w http.ResponseWriter, err error)
+	ErrorPrecondition(w http.ResponseWriter, err error)
+	ErrorUnsupportedMediaType(w http.ResponseWriter, err error)
+	ErrorConflict(w http.ResponseWriter, err error)
+	ErrorUnauthorized(w http.ResponseWriter, err error)
+	ErrorForbidden(w http.ResponseWriter, err error)
 }
 
 type Respond struct {
@@ -40,28 +115,97 @@ func (r *Respond) OutputJSON(w http.ResponseWriter, responseData interface{}) {
 	}
 }
 
-func (r *Respond) ErrorBadRequest(w http.ResponseWriter, err error) {
-	r.log.Info("http response bad request status code", zap.Error(err))
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusBadRequest)
-	if err := json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: err.Error(),
-		Data:    nil,
-	}); err != nil {
-		r.log.Info("response writer error on write", zap.Error(err))
+// Error выбирает статус по категории ошибки. Ошибки без категории считаются внутренними
+func (r *Respond) Error(w http.ResponseWriter, err error) {
+	if errors.Is(err, etag.ErrMissing) || errors.Is(err, etag.ErrMismatch) {
+		r.ErrorPrecondition(w, err)
+		return
+	}
+
+	status, ok := kindStatuses[apperr.KindOf(err)]
+	if !ok {
+		r.ErrorInternal(w, err)
+		return
+	}
+
+	if appErr, ok := apperr.As(err); ok && appErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", retryAfter(appErr.RetryAfter))
 	}
+
+	r.problem(w, status, "", err)
 }
 
+// ProblemFor собирает проблему с тем же статусом, что отправил бы Error, но не отправляет её:
+// для ответов, где ошибки перечисляются по элементам. Причина внутренней ошибки не раскрывается
+func ProblemFor(err error) Problem {
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		return NewProblem(http.StatusPreconditionRequired, CodePreconditionRequired, err)
+	case errors.Is(err, etag.ErrMismatch):
+		return NewProblem(http.StatusPreconditionFailed, CodePreconditionFailed, err)
+	}
+
+	status, ok := kindStatuses[apperr.KindOf(err)]
+	if !ok {
+		return NewProblem(http.StatusInternalServerError, CodeInternal, nil)
+	}
+
+	return NewProblem(status, "", err)
+}
+
+// retryAfter - значение заголовка Retry-After в целых секундах с округлением вверх
+func retryAfter(d time.Duration) string {
+	seconds := (d + time.Second - 1) / time.Second
+	return strconv.FormatInt(int64(seconds), 10)
+}
+
+func (r *Respond) ErrorBadRequest(w http.ResponseWriter, err error) {
+	r.problem(w, http.StatusBadRequest, CodeBadRequest, err)
+}
+
+// ErrorInternal не раскрывает клиенту причину ошибки, она остаётся только в логе
 func (r *Respond) ErrorInternal(w http.ResponseWriter, err error) {
 	r.log.Error("http response internal error", zap.Error(err))
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusInternalServerError)
-	if err := json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: err.Error(),
-		Data:    nil,
-	}); err != nil {
+	problem := NewProblem(http.StatusInternalServerError, CodeInternal, nil)
+	if err := WriteProblem(w, problem); err != nil {
 		r.log.Error("response writer error on write", zap.Error(err))
 	}
 }
+
+func (r *Respond) ErrorNotFound(w http.ResponseWriter, err error) {
+	r.problem(w, http.StatusNotFound, CodeNotFound, err)
+}
+
+// ErrorPrecondition отвечает 428, если клиент не прислал If-Match, и 412, если версия устарела
+func (r *Respond) ErrorPrecondition(w http.ResponseWriter, err error) {
+	status, code := http.StatusPreconditionFailed, CodePreconditionFailed
+	if errors.Is(err, etag.ErrMissing) {
+		status, code = http.StatusPreconditionRequired, CodePreconditionRequired
+	}
+
+	r.problem(w, status, code, err)
+}
+
+func (r *Respond) ErrorUnsupportedMediaType(w http.ResponseWriter, err error) {
+	r.problem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, err)
+}
+
+func (r *Respond) ErrorConflict(w http.ResponseWriter, err error) {
+	r.problem(w, http.StatusConflict, CodeConflict, err)
+}
+
+func (r *Respond) ErrorUnauthorized(w http.ResponseWriter, err error) {
+	r.problem(w, http.StatusUnauthorized, CodeUnauthorized, err)
+}
+
+func (r *Respond) ErrorForbidden(w http.ResponseWriter, err error) {
+	r.problem(w, http.StatusForbidden, CodeForbidden, err)
+}
+
+// problem логирует клиентскую ошибку и отправляет её; code используется для нетипизированных ошибок
+func (r *Respond) problem(w http.ResponseWriter, status int, code string, err error) {
+	r.log.Info("http response client error", zap.Int("status", status), zap.Error(err))
+	if err := WriteProblem(w, NewProblem(status, code, err)); err != nil {
+		r.log.Info("response writer error on write", zap.Error(err))
+	}
+}
@@ -3,13 +3,17 @@ package responder
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/apperr"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/etag"
 )
 
 type MockLogger struct {
@@ -63,6 +67,18 @@ func TestOutputJSON_Error(t *testing.T) {
 	assert.Equal(t, http.StatusOK, recorder.Code)
 }
 
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder) Problem {
+	t.Helper()
+
+	assert.Equal(t, ProblemContentType, recorder.Header().Get("Content-Type"))
+
+	var problem Problem
+	err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+	assert.NoError(t, err, "Должно быть корректное JSON-сообщение")
+	assert.Equal(t, recorder.Code, problem.Status)
+	return problem
+}
+
 func TestErrorBadRequest_Success(t *testing.T) {
 	mockLogger := &MockLogger{}
 	responder := Respond{log: mockLogger}
@@ -72,47 +88,101 @@ func TestErrorBadRequest_Success(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	responder.ErrorBadRequest(recorder, testError)
 
-	assert.Equal(t, "application/json;charset=utf-8", recorder.Header().Get("Content-Type"))
-
 	assert.Equal(t, http.StatusBadRequest, recorder.Code)
-
-	expectedResponse := Response{
-		Success: false,
-		Message: testError.Error(),
-		Data:    nil,
-	}
-	var actualResponse Response
-	err := json.Unmarshal(recorder.Body.Bytes(), &actualResponse)
-	assert.NoError(t, err, "Должно быть корректное JSON-сообщение")
-	assert.Equal(t, expectedResponse, actualResponse)
-
-	mockLogger.Error("http response bad request status code")
-
-	assert.Equal(t, "http response bad request status code", mockLogger.LoggedError)
+	assert.Equal(t, Problem{
+		Type:   "urn:petstore:problem:bad_request",
+		Title:  "Bad Request",
+		Status: http.StatusBadRequest,
+		Detail: "invalid request",
+		Code:   CodeBadRequest,
+	}, decodeProblem(t, recorder))
+	assert.Empty(t, mockLogger.LoggedError, "Ошибки клиента не логируются как ошибки сервера")
 }
 
 func TestErrorInternal_Success(t *testing.T) {
 	mockLogger := &MockLogger{}
 	responder := Respond{log: mockLogger}
 
-	testError := errors.New("internal server error")
+	testError := errors.New("connection refused")
 
 	recorder := httptest.NewRecorder()
 	responder.ErrorInternal(recorder, testError)
 
-	assert.Equal(t, "application/json;charset=utf-8", recorder.Header().Get("Content-Type"))
-
 	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, CodeInternal, problem.Code)
+	assert.Empty(t, problem.Detail, "Причина внутренней ошибки не должна уходить клиенту")
+
+	assert.Equal(t, "http response internal error", mockLogger.LoggedError)
+}
+
+func TestErrorPrecondition(t *testing.T) {
+	mockLogger := &MockLogger{}
+	responder := Respond{log: mockLogger}
 
-	expectedResponse := Response{
-		Success: false,
-		Message: testError.Error(),
-		Data:    nil,
+	recorder := httptest.NewRecorder()
+	responder.ErrorPrecondition(recorder, etag.ErrMissing)
+	assert.Equal(t, http.StatusPreconditionRequired, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	responder.ErrorPrecondition(recorder, etag.ErrMismatch)
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, etag.ErrMismatch.Error(), problem.Detail)
+	assert.Equal(t, CodePreconditionFailed, problem.Code)
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"validation", apperr.InvalidField("status", "invalid_status", "invalid status: lost"), http.StatusBadRequest, "invalid_status"},
+		{"not found", apperr.NotFound("pet_not_found", "pet does not exist"), http.StatusNotFound, "pet_not_found"},
+		{"conflict", apperr.Conflict("username_taken", "username not available"), http.StatusConflict, "username_taken"},
+		{"unauthorized", apperr.Unauthorized("invalid_credentials", "wrong password"), http.StatusUnauthorized, "invalid_credentials"},
+		{"forbidden", apperr.Forbidden("not_owner", "not your order"), http.StatusForbidden, "not_owner"},
+		{"rate limited", apperr.RateLimited("login_throttled", time.Second, "too many attempts"), http.StatusTooManyRequests, "login_throttled"},
+		{"wrapped", fmt.Errorf("create: %w", apperr.Conflict("pet_unavailable", "pet is not available")), http.StatusConflict, "pet_unavailable"},
+		{"precondition", etag.ErrMismatch, http.StatusPreconditionFailed, CodePreconditionFailed},
+		{"untyped", errors.New("connection refused"), http.StatusInternalServerError, CodeInternal},
 	}
-	var actualResponse Response
-	err := json.Unmarshal(recorder.Body.Bytes(), &actualResponse)
-	assert.NoError(t, err, "Должно быть корректное JSON-сообщение")
-	assert.Equal(t, expectedResponse, actualResponse)
 
-	assert.Equal(t, "http response internal error", mockLogger.LoggedError)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responder := Respond{log: &MockLogger{}}
+
+			recorder := httptest.NewRecorder()
+			responder.Error(recorder, tt.err)
+
+			assert.Equal(t, tt.status, recorder.Code)
+			problem := decodeProblem(t, recorder)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, "urn:petstore:problem:"+tt.code, problem.Type)
+			assert.Equal(t, problem, ProblemFor(tt.err), "ProblemFor должен совпадать с ответом Error")
+		})
+	}
+}
+
+func TestError_RetryAfter(t *testing.T) {
+	responder := Respond{log: &MockLogger{}}
+
+	recorder := httptest.NewRecorder()
+	responder.Error(recorder, apperr.RateLimited("login_throttled", 1500*time.Millisecond, "too many attempts"))
+
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+}
+
+func TestError_FieldDetails(t *testing.T) {
+	responder := Respond{log: &MockLogger{}}
+
+	recorder := httptest.NewRecorder()
+	responder.Error(recorder, apperr.InvalidField("email", "invalid_email", "mail: missing '@'"))
+
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, []apperr.FieldError{{Field: "email", Code: "invalid_email", Message: "mail: missing '@'"}}, problem.Errors)
 }
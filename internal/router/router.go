@@ -1,71 +1,154 @@
 package router
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/middleware"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
 )
 
-func NewRouter(controllers *modules.Controllers, tokenAuth *jwtauth.JWTAuth) http.Handler {
+// NewRouter собирает маршруты API. legacyLogin оставляет устаревший GET /user/login;
+// без него GET отвечает 405, и клиент видит, что нужен POST.
+// Запросы с заголовком api_key ограничиваются правами ключа
+func NewRouter(controllers *modules.Controllers, tokenAuth *jwtauth.JWTAuth, revoker middleware.Revoker, keys middleware.APIKeys, legacyLogin bool) http.Handler {
 	r := chi.NewRouter()
-	r.Use(jwtauth.Verifier(tokenAuth))
+	r.Use(middleware.Verifier(tokenAuth, revoker, keys))
+	r.Use(middleware.APIKeyScopes)
 	r.Route("/user", func(r chi.Router) {
 		r.Post("/", controllers.User.CreateUser)
 		r.Post("/createWithArray", controllers.User.CreateWithListAndArray)
 		r.Post("/createWithList", controllers.User.CreateWithListAndArray)
 
-		r.With().Get("/login", controllers.User.Login)
+		r.Post("/login", controllers.User.Login)
+		if legacyLogin {
+			r.Get("/login", controllers.User.LoginLegacy)
+		} else {
+			r.Get("/login", loginMethodNotAllowed)
+		}
+		r.Post("/login/2fa", controllers.User.LoginTwoFactor)
 		r.Get("/logout", controllers.User.Logout)
+		r.Post("/refresh", controllers.User.Refresh)
+		r.Post("/password/strength", controllers.User.PasswordStrength)
+		r.Post("/verify", controllers.User.VerifyEmail)
+		r.Post("/password/forgot", controllers.User.ForgotPassword)
+		r.Post("/password/reset", controllers.User.ResetPassword)
 
 		r.Get("/{username}", controllers.User.GetUser)
 
 		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(models.RoleAdmin))
+
+			r.Get("/", controllers.User.ListRoles)
+			r.Put("/{username}/role", controllers.User.UpdateRole)
+			r.Delete("/{username}/lockout", controllers.User.UnlockUser)
+		})
+
+		r.With(middleware.UserUnloggedIn).Get("/{username}/orders", controllers.Store.UserOrders)
+
+		// Учётная запись, второй фактор и ключи меняются только из сессии с паролем: утёкший ключ
+		// не должен менять пароль, удалять пользователя, выпускать новые ключи или отключать 2FA
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.SessionOnly)
 			r.Use(middleware.UserUnloggedIn)
 
 			r.Put("/{username}", controllers.User.UpdateUser)
 			r.Delete("/{username}", controllers.User.DeleteUser)
+			r.Post("/{username}/2fa", controllers.User.EnrollTOTP)
+			r.Delete("/{username}/2fa", controllers.User.DisableTOTP)
+			r.Post("/{username}/2fa/confirm", controllers.User.ConfirmTOTP)
+			r.Post("/{username}/2fa/recovery-codes", controllers.User.RegenerateRecoveryCodes)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.SessionOnly)
+			r.Use(middleware.RequireSelfOrRole(models.RoleAdmin))
+
+			r.Post("/{username}/api-keys", controllers.User.CreateAPIKey)
+			r.Get("/{username}/api-keys", controllers.User.ListAPIKeys)
+			r.Delete("/{username}/api-keys/{keyId}", controllers.User.RevokeAPIKey)
 		})
 	})
 
 	r.Route("/store", func(r chi.Router) {
 		r.Route("/order", func(r chi.Router) {
-			r.Post("/", controllers.Store.Order)
+			r.With(middleware.UnloggedIn).Post("/", controllers.Store.Order)
+			r.With(middleware.RequireRole(models.RoleStaff, models.RoleAdmin)).Get("/", controllers.Store.ListOrders)
 
 			r.Route("/{orderId}", func(r chi.Router) {
+				r.Use(middleware.UnloggedIn)
+
+				// владельца заказа проверяет контроллер: в пути его нет
 				r.Get("/", controllers.Store.GetOrder)
 				r.Delete("/", controllers.Store.DeleteOrder)
+				r.With(middleware.RequireRole(models.RoleStaff, models.RoleAdmin)).Post("/status", controllers.Store.TransitionOrder)
+				r.Get("/history", controllers.Store.OrderHistory)
 			})
 		})
+		r.With(middleware.RequireRole(models.RoleStaff, models.RoleAdmin)).Get("/inventory", controllers.Store.Inventory)
+	})
+
+	r.Route("/pet", func(r chi.Router) {
+		// Изображения открыты без токена, чтобы их можно было встраивать через <img>
+		r.Get("/{petId}/images/{imageName}", controllers.Pet.GetImage)
+
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.UnloggedIn)
-			r.Get("/inventory", controllers.Store.Inventory)
+			r.Get("/findByStatus", controllers.Pet.FindByStatus)
+			r.Get("/findByTags", controllers.Pet.FindByTags)
 		})
-	})
 
-	r.Route("/pet", func(r chi.Router) {
-		r.Use(middleware.UnloggedIn)
+		r.With(middleware.RequireRole(models.RoleStaff, models.RoleAdmin)).Post("/", controllers.Pet.CreatePet)
+		r.With(middleware.RequireRole(models.RoleStaff, models.RoleAdmin)).Put("/", controllers.Pet.UpdatePet)
+
+		// GET живёт в том же подроутере: отдельный маршрут /{petId} перекрывается его монтированием
 		r.Route("/{petId}", func(r chi.Router) {
-			r.Route("/", func(r chi.Router) {
-				r.Get("/", controllers.Pet.GetByID)
+			r.With(middleware.UnloggedIn).Get("/", controllers.Pet.GetByID)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireRole(models.RoleStaff, models.RoleAdmin))
 				r.Post("/", controllers.Pet.UpdateByPetId)
+				r.Patch("/", controllers.Pet.PatchPet)
+				r.Delete("/", controllers.Pet.DeleteByPetId)
+				r.Post("/uploadImage", controllers.Pet.UploadImage)
+			})
+		})
+	})
+
+	r.Route("/category", func(r chi.Router) {
+		r.With(middleware.UnloggedIn).Get("/", controllers.Category.ListCategories)
+		r.With(middleware.UnloggedIn).Get("/{categoryId}", controllers.Category.GetCategory)
 
-				r.Group(func(r chi.Router) {
-					r.Use(middleware.UnloggedInDelete)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(models.RoleStaff, models.RoleAdmin))
+			r.Post("/", controllers.Category.CreateCategory)
 
-					r.Delete("/", controllers.Pet.DeleteByPetId)
-				})
+			r.Route("/{categoryId}", func(r chi.Router) {
+				r.Put("/", controllers.Category.RenameCategory)
+				r.Delete("/", controllers.Category.DeleteCategory)
+				r.Post("/merge", controllers.Category.MergeCategory)
 			})
-			r.Post("/uploadImage", controllers.Pet.UploadImage)
 		})
-		r.Route("/", func(r chi.Router) {
-			r.Post("/", controllers.Pet.CreatePet)
-			r.Put("/", controllers.Pet.UpdatePet)
+	})
+
+	r.Route("/tag", func(r chi.Router) {
+		r.With(middleware.UnloggedIn).Get("/", controllers.Tag.ListTags)
+		r.With(middleware.UnloggedIn).Get("/{tagId}", controllers.Tag.GetTag)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(models.RoleStaff, models.RoleAdmin))
+			r.Post("/", controllers.Tag.CreateTag)
+
+			r.Route("/{tagId}", func(r chi.Router) {
+				r.Put("/", controllers.Tag.RenameTag)
+				r.Delete("/", controllers.Tag.DeleteTag)
+				r.Post("/merge", controllers.Tag.MergeTag)
+			})
 		})
-		r.Get("/findByStatus", controllers.Pet.FindByStatus)
-		r.Get("/findByTags", controllers.Pet.FindByTags)
 	})
 
 	r.Get("/swagger/*", func(w http.ResponseWriter, r *http.Request) {
@@ -73,3 +156,11 @@ func NewRouter(controllers *modules.Controllers, tokenAuth *jwtauth.JWTAuth) htt
 	})
 	return r
 }
+
+// loginMethodNotAllowed занимает GET /user/login, когда устаревший вход выключен:
+// иначе запрос достался бы маршруту /{username}
+func loginMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", http.MethodPost)
+	_ = responder.WriteProblem(w, responder.NewProblem(http.StatusMethodNotAllowed, "method_not_allowed",
+		errors.New("credentials in the query string are no longer accepted, use POST /user/login")))
+}
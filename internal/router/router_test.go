@@ -1,12 +1,16 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/jwtauth"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
 )
 
@@ -22,6 +26,9 @@ func (m *MockUserController) CreateWithListAndArray(w http.ResponseWriter, r *ht
 func (m *MockUserController) Login(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
+func (m *MockUserController) LoginLegacy(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
 func (m *MockUserController) Logout(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
@@ -31,9 +38,57 @@ func (m *MockUserController) DeleteUser(w http.ResponseWriter, r *http.Request)
 func (m *MockUserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
+func (m *MockUserController) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) PasswordStrength(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) ListRoles(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
 func (m *MockUserController) GetUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
+func (m *MockUserController) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockUserController) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
 
 type MockPetController struct {
 }
@@ -59,9 +114,15 @@ func (m *MockPetController) DeleteByPetId(w http.ResponseWriter, r *http.Request
 func (m *MockPetController) UpdatePet(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusForbidden)
 }
+func (m *MockPetController) PatchPet(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusForbidden)
+}
 func (m *MockPetController) UploadImage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusForbidden)
 }
+func (m *MockPetController) GetImage(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
 
 type MockStoreController struct {
 }
@@ -78,6 +139,78 @@ func (m *MockStoreController) GetOrder(w http.ResponseWriter, r *http.Request) {
 func (m *MockStoreController) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
+func (m *MockStoreController) TransitionOrder(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockStoreController) OrderHistory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockStoreController) ListOrders(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockStoreController) UserOrders(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type MockCategoryController struct {
+}
+
+func (m *MockCategoryController) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockCategoryController) ListCategories(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockCategoryController) GetCategory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockCategoryController) RenameCategory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockCategoryController) MergeCategory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockCategoryController) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type MockTagController struct {
+}
+
+func (m *MockTagController) CreateTag(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockTagController) ListTags(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockTagController) GetTag(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockTagController) RenameTag(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockTagController) MergeTag(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+func (m *MockTagController) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type mockRevoker struct{}
+
+func (mockRevoker) IsRevoked(ctx context.Context, jti string) bool {
+	return false
+}
+
+type mockAPIKeys map[string]models.APIKeyPrincipal
+
+func (m mockAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (models.APIKeyPrincipal, error) {
+	principal, ok := m[key]
+	if !ok {
+		return models.APIKeyPrincipal{}, errors.New("unknown key")
+	}
+	return principal, nil
+}
 
 func TestNewRouter(t *testing.T) {
 	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
@@ -85,14 +218,18 @@ func TestNewRouter(t *testing.T) {
 	mockUserController := MockUserController{}
 	mockStoreController := MockStoreController{}
 	mockPetController := MockPetController{}
+	mockCategoryController := MockCategoryController{}
+	mockTagController := MockTagController{}
 
 	controllers := &modules.Controllers{
-		User:  &mockUserController,
-		Store: &mockStoreController,
-		Pet:   &mockPetController,
+		User:     &mockUserController,
+		Store:    &mockStoreController,
+		Pet:      &mockPetController,
+		Category: &mockCategoryController,
+		Tag:      &mockTagController,
 	}
 
-	router := NewRouter(controllers, tokenAuth)
+	router := NewRouter(controllers, tokenAuth, mockRevoker{}, mockAPIKeys{}, true)
 
 	tests := []struct {
 		method string
@@ -102,22 +239,57 @@ func TestNewRouter(t *testing.T) {
 		{"POST", "/user/createWithArray"},
 		{"POST", "/user/createWithList"},
 		{"GET", "/user/login"},
+		{"POST", "/user/login"},
+		{"POST", "/user/login/2fa"},
 		{"GET", "/user/logout"},
+		{"POST", "/user/refresh"},
+		{"POST", "/user/password/strength"},
+		{"POST", "/user/verify"},
+		{"POST", "/user/password/forgot"},
+		{"POST", "/user/password/reset"},
 		{"GET", "/user/testuser"},
 		{"PUT", "/user/testuser"},
 		{"DELETE", "/user/testuser"},
+		{"GET", "/user/testuser/orders"},
+		{"POST", "/user/testuser/2fa"},
+		{"DELETE", "/user/testuser/2fa"},
+		{"POST", "/user/testuser/2fa/confirm"},
+		{"POST", "/user/testuser/2fa/recovery-codes"},
+		{"GET", "/user"},
+		{"PUT", "/user/testuser/role"},
+		{"DELETE", "/user/testuser/lockout"},
+		{"POST", "/user/testuser/api-keys"},
+		{"GET", "/user/testuser/api-keys"},
+		{"DELETE", "/user/testuser/api-keys/1"},
 		{"POST", "/store/order"},
+		{"GET", "/store/order"},
 		{"GET", "/store/order/1"},
 		{"DELETE", "/store/order/1"},
+		{"POST", "/store/order/1/status"},
+		{"GET", "/store/order/1/history"},
 		{"GET", "/store/inventory"},
 		{"POST", "/pet"},
 		{"PUT", "/pet"},
 		{"GET", "/pet/1"},
 		{"POST", "/pet/1"},
 		{"DELETE", "/pet/1"},
+		{"PATCH", "/pet/1"},
 		{"POST", "/pet/1/uploadImage"},
+		{"GET", "/pet/1/images/image.png"},
 		{"GET", "/pet/findByStatus"},
 		{"GET", "/pet/findByTags"},
+		{"GET", "/category"},
+		{"POST", "/category"},
+		{"GET", "/category/1"},
+		{"PUT", "/category/1"},
+		{"DELETE", "/category/1"},
+		{"POST", "/category/1/merge"},
+		{"GET", "/tag"},
+		{"POST", "/tag"},
+		{"GET", "/tag/1"},
+		{"PUT", "/tag/1"},
+		{"DELETE", "/tag/1"},
+		{"POST", "/tag/1/merge"},
 		{"GET", "/swagger/"},
 	}
 
@@ -126,11 +298,21 @@ func TestNewRouter(t *testing.T) {
 		rr := httptest.NewRecorder()
 		router.ServeHTTP(rr, req)
 
-		if strings.Split(test.route, "/")[1] == "pet" || (test.route == "/user/testuser" && test.method != "GET") || test.route == "/store/inventory" {
+		if strings.Contains(test.route, "/images/") {
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler for %s %s returned wrong status code: got %v want %v",
+					test.method, test.route, status, http.StatusOK)
+			}
+		} else if prefix := strings.Split(test.route, "/")[1]; prefix == "pet" || prefix == "category" || prefix == "tag" || (test.route == "/user/testuser" && test.method != "GET") || test.route == "/user/testuser/orders" ||
+			strings.HasPrefix(test.route, "/user/testuser/2fa") || strings.HasPrefix(test.route, "/user/testuser/api-keys") ||
+			(test.route == "/user" && test.method == "GET") || test.route == "/user/testuser/role" || test.route == "/user/testuser/lockout" ||
+			test.route == "/store/order" || test.route == "/store/inventory" ||
+			strings.HasPrefix(test.route, "/store/order/1") {
+			// без токена защищённые маршруты отвечают 401
 			status := rr.Code
-			if status != http.StatusForbidden {
+			if status != http.StatusUnauthorized {
 				t.Errorf("handler for %s %s returned wrong status code: got %v want %v",
-					test.method, test.route, status, http.StatusForbidden)
+					test.method, test.route, status, http.StatusUnauthorized)
 			}
 		} else if test.route == "/swagger/" {
 			status := rr.Code
@@ -144,3 +326,186 @@ func TestNewRouter(t *testing.T) {
 		}
 	}
 }
+
+type readablePetController struct {
+	MockPetController
+}
+
+func (m *readablePetController) GetByID(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestNewRouter_PetReadableByCustomer(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	controllers := &modules.Controllers{
+		User:     &MockUserController{},
+		Store:    &MockStoreController{},
+		Pet:      &readablePetController{},
+		Category: &MockCategoryController{},
+		Tag:      &MockTagController{},
+	}
+
+	router := NewRouter(controllers, tokenAuth, mockRevoker{}, mockAPIKeys{}, true)
+
+	_, token, _ := tokenAuth.Encode(map[string]interface{}{
+		"username": "customer",
+		"role":     models.RoleCustomer,
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	})
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{"GET", http.StatusOK},
+		{"DELETE", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "/pet/1", nil)
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != test.want {
+			t.Errorf("handler for %s /pet/1 returned wrong status code: got %v want %v", test.method, rr.Code, test.want)
+		}
+	}
+}
+
+func TestNewRouter_OrderAccess(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	controllers := &modules.Controllers{
+		User:     &MockUserController{},
+		Store:    &MockStoreController{},
+		Pet:      &MockPetController{},
+		Category: &MockCategoryController{},
+		Tag:      &MockTagController{},
+	}
+
+	router := NewRouter(controllers, tokenAuth, mockRevoker{}, mockAPIKeys{}, true)
+
+	token := func(role string) string {
+		_, token, _ := tokenAuth.Encode(map[string]interface{}{
+			"username": role,
+			"role":     role,
+			"exp":      time.Now().Add(time.Minute).Unix(),
+		})
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		method string
+		route  string
+		token  string
+		want   int
+	}{
+		{"POST", "/store/order/1/status", "", http.StatusUnauthorized},
+		{"POST", "/store/order/1/status", token(models.RoleCustomer), http.StatusForbidden},
+		{"POST", "/store/order/1/status", token(models.RoleStaff), http.StatusOK},
+		// владельца заказа проверяет контроллер, маршрут требует только токен
+		{"GET", "/store/order/1/history", "", http.StatusUnauthorized},
+		{"GET", "/store/order/1/history", token(models.RoleCustomer), http.StatusOK},
+		{"GET", "/store/order/1", "", http.StatusUnauthorized},
+		{"GET", "/store/order/1", token(models.RoleCustomer), http.StatusOK},
+		{"DELETE", "/store/order/1", "", http.StatusUnauthorized},
+		{"DELETE", "/store/order/1", token(models.RoleCustomer), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.route, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", test.token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != test.want {
+			t.Errorf("handler for %s %s returned wrong status code: got %v want %v", test.method, test.route, rr.Code, test.want)
+		}
+	}
+}
+
+func TestNewRouter_LegacyLoginDisabled(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	controllers := &modules.Controllers{
+		User:     &MockUserController{},
+		Store:    &MockStoreController{},
+		Pet:      &MockPetController{},
+		Category: &MockCategoryController{},
+		Tag:      &MockTagController{},
+	}
+
+	router := NewRouter(controllers, tokenAuth, mockRevoker{}, mockAPIKeys{}, false)
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{"GET", http.StatusMethodNotAllowed},
+		{"POST", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "/user/login", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != test.want {
+			t.Errorf("handler for %s /user/login returned wrong status code: got %v want %v", test.method, rr.Code, test.want)
+		}
+	}
+}
+
+func TestNewRouter_APIKey(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+
+	controllers := &modules.Controllers{
+		User:     &MockUserController{},
+		Store:    &MockStoreController{},
+		Pet:      &readablePetController{},
+		Category: &MockCategoryController{},
+		Tag:      &MockTagController{},
+	}
+
+	keys := mockAPIKeys{
+		"psk_reader": {
+			KeyID:    1,
+			Username: "testuser",
+			Role:     models.RoleStaff,
+			Scopes:   []string{models.ScopePetRead, models.ScopeUserWrite},
+		},
+	}
+
+	router := NewRouter(controllers, tokenAuth, mockRevoker{}, keys, true)
+
+	tests := []struct {
+		method string
+		route  string
+		key    string
+		want   int
+	}{
+		{"GET", "/pet/1", "psk_reader", http.StatusOK},
+		{"DELETE", "/pet/1", "psk_reader", http.StatusForbidden},
+		{"GET", "/pet/1", "psk_unknown", http.StatusUnauthorized},
+		{"PUT", "/user/testuser", "psk_reader", http.StatusForbidden},
+		{"DELETE", "/user/testuser", "psk_reader", http.StatusForbidden},
+		{"POST", "/user/testuser/api-keys", "psk_reader", http.StatusForbidden},
+		{"POST", "/user/testuser/2fa", "psk_reader", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.route, nil)
+		req.Header.Set("api_key", test.key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != test.want {
+			t.Errorf("handler for %s %s with key %s returned wrong status code: got %v want %v",
+				test.method, test.route, test.key, rr.Code, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+var (
+	randomNames = []string{
+		"Bella", "Max", "Luna", "Charlie", "Lucy", "Cooper", "Daisy", "Milo", "Lola", "Rocky",
+		"Sadie", "Teddy", "Molly", "Oliver", "Stella", "Leo", "Zoe", "Bear", "Nala", "Tucker",
+	}
+	randomBreeds = map[string][]string{
+		"dogs":     {"beagle", "labrador", "poodle", "husky", "corgi"},
+		"cats":     {"siamese", "persian", "sphynx", "maine-coon", "bengal"},
+		"birds":    {"parrot", "canary", "cockatiel", "budgie"},
+		"fish":     {"goldfish", "guppy", "betta"},
+		"reptiles": {"gecko", "iguana", "python", "tortoise"},
+	}
+	randomCategories = []string{"dogs", "cats", "birds", "fish", "reptiles"}
+	randomTraits     = []string{"friendly", "playful", "calm", "trained", "young", "senior", "vaccinated"}
+	// Доступных больше, чем остальных, как в живом магазине
+	randomStatuses = []string{"available", "available", "available", "pending", "sold"}
+)
+
+// Random генерирует n питомцев со случайными категориями, тегами, статусами и фото.
+// Имена зависят только от номера, поэтому повторная генерация не создаёт дубликатов
+func Random(n int, rnd *rand.Rand) Fixture {
+	fixture := Fixture{
+		Categories: randomCategories,
+	}
+
+	for i := 0; i < n; i++ {
+		category := randomCategories[rnd.Intn(len(randomCategories))]
+		breeds := randomBreeds[category]
+
+		tags := []string{breeds[rnd.Intn(len(breeds))]}
+		for _, j := range rnd.Perm(len(randomTraits))[:rnd.Intn(3)] {
+			tags = append(tags, randomTraits[j])
+		}
+
+		var photos []string
+		for j := 0; j < 1+rnd.Intn(3); j++ {
+			photos = append(photos, fmt.Sprintf("https://images.example.com/%s/%d-%d.jpg", category, i+1, j+1))
+		}
+
+		fixture.Pets = append(fixture.Pets, Pet{
+			Name:      fmt.Sprintf("%s #%d", randomNames[i%len(randomNames)], i+1),
+			Category:  category,
+			Tags:      tags,
+			Status:    randomStatuses[rnd.Intn(len(randomStatuses))],
+			PhotoUrls: photos,
+		})
+	}
+
+	return fixture
+}
@@ -0,0 +1,401 @@
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+)
+
+// Fixture - декларативное описание демо-данных. Объекты ссылаются друг на друга по именам
+type Fixture struct {
+	Users      []User   `yaml:"users" json:"users"`
+	Categories []string `yaml:"categories" json:"categories"`
+	Tags       []string `yaml:"tags" json:"tags"`
+	Pets       []Pet    `yaml:"pets" json:"pets"`
+	Orders     []Order  `yaml:"orders" json:"orders"`
+}
+
+type User struct {
+	Username  string `yaml:"username" json:"username"`
+	Password  string `yaml:"password" json:"password"`
+	Email     string `yaml:"email" json:"email"`
+	FirstName string `yaml:"firstName" json:"firstName"`
+	LastName  string `yaml:"lastName" json:"lastName"`
+	Phone     string `yaml:"phone" json:"phone"`
+	Role      string `yaml:"role" json:"role"`
+}
+
+type Pet struct {
+	Name      string   `yaml:"name" json:"name"`
+	Category  string   `yaml:"category" json:"category"`
+	Tags      []string `yaml:"tags" json:"tags"`
+	Status    string   `yaml:"status" json:"status"`
+	PhotoUrls []string `yaml:"photoUrls" json:"photoUrls"`
+}
+
+// Order - заказ на питомца по имени. Status задаёт, до какого статуса довести заказ после создания
+type Order struct {
+	Pet      string `yaml:"pet" json:"pet"`
+	Username string `yaml:"username" json:"username"`
+	Quantity int    `yaml:"quantity" json:"quantity"`
+	Status   string `yaml:"status" json:"status"`
+	Comment  string `yaml:"comment" json:"comment"`
+}
+
+// Count - сколько объектов создано и сколько пропущено, потому что уже были в базе
+type Count struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+type Report struct {
+	Users      Count `json:"users"`
+	Categories Count `json:"categories"`
+	Tags       Count `json:"tags"`
+	Pets       Count `json:"pets"`
+	Orders     Count `json:"orders"`
+}
+
+const statusPlaced = "placed"
+
+// orderPaths - переходы, которыми новый заказ доводится до нужного статуса
+var orderPaths = map[string][]string{
+	statusPlaced: nil,
+	"approved":   {"approved"},
+	"shipped":    {"approved", "shipped"},
+	"delivered":  {"approved", "shipped", "delivered"},
+	"cancelled":  {"cancelled"},
+}
+
+// Load читает фикстуру из YAML или JSON, формат определяется по расширению
+func Load(path string) (Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixture{}, fmt.Errorf("read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &fixture)
+	} else {
+		err = yaml.Unmarshal(data, &fixture)
+	}
+	if err != nil {
+		return Fixture{}, fmt.Errorf("parse fixture %s: %w", path, err)
+	}
+
+	return fixture, nil
+}
+
+// Seeder загружает фикстуры через сервисы приложения, поэтому к ним применяются те же проверки,
+// что и к запросам API. Уже существующие объекты пропускаются, так что повторный запуск безопасен
+type Seeder struct {
+	services *modules.Services
+}
+
+func NewSeeder(services *modules.Services) *Seeder {
+	return &Seeder{
+		services: services,
+	}
+}
+
+// Apply создаёт недостающие объекты фикстуры и останавливается на первой ошибке
+func (s *Seeder) Apply(ctx context.Context, fixture Fixture) (Report, error) {
+	var report Report
+	var err error
+
+	report.Users, err = s.users(ctx, fixture.Users)
+	if err != nil {
+		return report, err
+	}
+
+	report.Categories, err = s.categories(ctx, fixture.Categories)
+	if err != nil {
+		return report, err
+	}
+
+	report.Tags, err = s.tags(ctx, fixture.Tags)
+	if err != nil {
+		return report, err
+	}
+
+	report.Pets, err = s.pets(ctx, fixture.Pets)
+	if err != nil {
+		return report, err
+	}
+
+	report.Orders, err = s.orders(ctx, fixture.Orders)
+
+	return report, err
+}
+
+func (s *Seeder) users(ctx context.Context, users []User) (Count, error) {
+	var count Count
+
+	for _, user := range users {
+		_, err := s.services.User.UserExistenceCheck(ctx, user.Username)
+		if err == nil {
+			count.Skipped++
+			continue
+		}
+
+		err = s.createUser(ctx, user)
+		if err != nil {
+			return count, fmt.Errorf("user %q: %w", user.Username, err)
+		}
+		count.Created++
+	}
+
+	return count, nil
+}
+
+func (s *Seeder) createUser(ctx context.Context, user User) error {
+	if user.Username == "" {
+		return fmt.Errorf("username is required")
+	}
+
+	if user.Role == "" {
+		user.Role = models.RoleCustomer
+	}
+
+	err := s.services.User.PasswordValidation(user.Password)
+	if err != nil {
+		return err
+	}
+
+	err = s.services.User.RoleValidation(user.Role)
+	if err != nil {
+		return err
+	}
+
+	if user.Email != "" {
+		err = s.services.User.EmailValidation(user.Email)
+		if err != nil {
+			return err
+		}
+	}
+
+	if user.Phone != "" {
+		err = s.services.User.PhoneValidation(user.Phone)
+		if err != nil {
+			return err
+		}
+	}
+
+	hpass, err := s.services.User.PasswordEncryption(user.Password)
+	if err != nil {
+		return err
+	}
+
+	return s.services.User.UserCreate(ctx, models.User{
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Password:  hpass,
+		Phone:     user.Phone,
+		Role:      user.Role,
+		// фикстуры загружаются без писем, адреса считаются подтверждёнными
+		EmailVerified: true,
+	})
+}
+
+func (s *Seeder) categories(ctx context.Context, names []string) (Count, error) {
+	var count Count
+
+	existing, err := s.services.Category.ListCategories(ctx)
+	if err != nil {
+		return count, err
+	}
+
+	known := map[string]bool{}
+	for _, category := range existing {
+		known[category.Name] = true
+	}
+
+	for _, name := range names {
+		if known[name] {
+			count.Skipped++
+			continue
+		}
+
+		_, err = s.services.Category.CreateCategory(ctx, name)
+		if err != nil {
+			return count, fmt.Errorf("category %q: %w", name, err)
+		}
+		known[name] = true
+		count.Created++
+	}
+
+	return count, nil
+}
+
+func (s *Seeder) tags(ctx context.Context, names []string) (Count, error) {
+	var count Count
+
+	existing, err := s.services.Tag.ListTags(ctx)
+	if err != nil {
+		return count, err
+	}
+
+	known := map[string]bool{}
+	for _, tag := range existing {
+		known[tag.Name] = true
+	}
+
+	for _, name := range names {
+		if known[name] {
+			count.Skipped++
+			continue
+		}
+
+		_, err = s.services.Tag.CreateTag(ctx, name)
+		if err != nil {
+			return count, fmt.Errorf("tag %q: %w", name, err)
+		}
+		known[name] = true
+		count.Created++
+	}
+
+	return count, nil
+}
+
+// pets создаёт питомцев так же, как POST /pet: категории и теги подбираются по имени
+func (s *Seeder) pets(ctx context.Context, pets []Pet) (Count, error) {
+	var count Count
+
+	for _, pet := range pets {
+		if pet.Name == "" {
+			return count, fmt.Errorf("pet name is required")
+		}
+
+		err := s.services.Pet.ExistingPet(ctx, pet.Name)
+		if err != nil {
+			count.Skipped++
+			continue
+		}
+
+		err = s.services.Pet.StatusCheck(pet.Status)
+		if err != nil {
+			return count, fmt.Errorf("pet %q: %w", pet.Name, err)
+		}
+
+		petJSON := models.PetJSON{
+			Name:      pet.Name,
+			Category:  models.Category{Name: pet.Category},
+			Status:    pet.Status,
+			PhotoUrls: pet.PhotoUrls,
+		}
+		for _, tag := range pet.Tags {
+			petJSON.Tags = append(petJSON.Tags, models.Tag{Name: tag})
+		}
+
+		dbPet := s.services.Pet.PetToDB(petJSON)
+		s.services.Pet.ExistingCategory(ctx, &dbPet)
+		s.services.Pet.ExistingTag(ctx, &dbPet)
+
+		err = s.services.Pet.CreatePet(ctx, dbPet)
+		if err != nil {
+			return count, fmt.Errorf("pet %q: %w", pet.Name, err)
+		}
+		count.Created++
+	}
+
+	return count, nil
+}
+
+// orders создаёт по одному заказу на питомца: если на питомца уже есть заказ, строка пропускается
+func (s *Seeder) orders(ctx context.Context, orders []Order) (Count, error) {
+	var count Count
+
+	for _, order := range orders {
+		created, err := s.order(ctx, order)
+		if err != nil {
+			return count, fmt.Errorf("order for pet %q: %w", order.Pet, err)
+		}
+
+		if created {
+			count.Created++
+		} else {
+			count.Skipped++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *Seeder) order(ctx context.Context, order Order) (bool, error) {
+	if order.Status == "" {
+		order.Status = statusPlaced
+	}
+
+	path, ok := orderPaths[order.Status]
+	if !ok {
+		return false, fmt.Errorf("invalid status: %s", order.Status)
+	}
+
+	if order.Quantity == 0 {
+		order.Quantity = 1
+	}
+
+	pet, err := s.services.Pet.GetPetByName(ctx, order.Pet)
+	if err != nil {
+		return false, err
+	}
+
+	page, err := s.services.Store.ListOrders(ctx, models.OrderListForm{PetID: pet.ID, PageForm: models.PageForm{Limit: 1}})
+	if err != nil {
+		return false, err
+	}
+	if page.Total > 0 {
+		return false, nil
+	}
+
+	newOrder := models.Order{
+		PetID:    pet.ID,
+		Quantity: order.Quantity,
+		Status:   statusPlaced,
+	}
+	err = s.services.Store.NewOrderCheck(&newOrder)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.services.Store.CreateOrder(ctx, newOrder, order.Username)
+	if err != nil {
+		return false, err
+	}
+
+	// CreateOrder не возвращает заказ, поэтому находим его по питомцу
+	page, err = s.services.Store.ListOrders(ctx, models.OrderListForm{PetID: pet.ID, PageForm: models.PageForm{Limit: 1}})
+	if err != nil {
+		return false, err
+	}
+	if len(page.Orders) == 0 {
+		return false, fmt.Errorf("created order is missing")
+	}
+
+	created := page.Orders[0]
+	id := strconv.Itoa(created.ID)
+	version := created.Version
+	for _, status := range path {
+		created, err = s.services.Store.TransitionOrder(ctx, id, version, models.OrderStatusForm{
+			Status:  status,
+			Comment: order.Comment,
+		})
+		if err != nil {
+			return false, err
+		}
+		version = created.Version
+	}
+
+	return true, nil
+}
@@ -0,0 +1,118 @@
+package seed
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
+)
+
+func newServices(t *testing.T) *modules.Services {
+	storages, err := modules.NewStorages(config.DriverMemory, nil)
+	require.NoError(t, err)
+
+	passwords, err := password.NewChecker(config.Default().Auth.Password)
+	require.NoError(t, err)
+
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	return modules.NewServices(*storages, tokenAuth, blob.NewLocalStore(t.TempDir()), passwords, mail.NewLogMailer(zap.NewNop()), audit.NewLogRecorder(zap.NewNop()), config.Default())
+}
+
+func TestSeeder_Apply(t *testing.T) {
+	services := newServices(t)
+	seeder := NewSeeder(services)
+	ctx := context.Background()
+
+	fixture, err := Load("testdata/demo.yaml")
+	require.NoError(t, err)
+
+	report, err := seeder.Apply(ctx, fixture)
+	require.NoError(t, err)
+	assert.Equal(t, Report{
+		Users:      Count{Created: 2},
+		Categories: Count{Created: 2},
+		Tags:       Count{Created: 2},
+		Pets:       Count{Created: 2},
+		Orders:     Count{Created: 1},
+	}, report)
+
+	pet, err := services.Pet.GetPetByName(ctx, "Rex")
+	require.NoError(t, err)
+	assert.Equal(t, "dogs", pet.Category.Name)
+	assert.Len(t, pet.Tags, 2)
+	assert.Equal(t, "pending", pet.Status, "Заказ резервирует питомца")
+
+	orders, err := services.Store.UserOrders(ctx, "bob", models.OrderListForm{})
+	require.NoError(t, err)
+	require.Len(t, orders.Orders, 1)
+	assert.Equal(t, "shipped", orders.Orders[0].Status)
+
+	// повторный запуск ничего не создаёт
+	report, err = seeder.Apply(ctx, fixture)
+	require.NoError(t, err)
+	assert.Equal(t, Report{
+		Users:      Count{Skipped: 2},
+		Categories: Count{Skipped: 2},
+		Tags:       Count{Skipped: 2},
+		Pets:       Count{Skipped: 2},
+		Orders:     Count{Skipped: 1},
+	}, report)
+}
+
+func TestSeeder_ApplyValidates(t *testing.T) {
+	seeder := NewSeeder(newServices(t))
+	ctx := context.Background()
+
+	_, err := seeder.Apply(ctx, Fixture{Users: []User{{Username: "carol", Password: "Short1"}}})
+	assert.ErrorContains(t, err, `user "carol"`)
+
+	_, err = seeder.Apply(ctx, Fixture{Pets: []Pet{{Name: "Rex", Category: "dogs", Status: "lost"}}})
+	assert.ErrorContains(t, err, "invalid status: lost")
+
+	_, err = seeder.Apply(ctx, Fixture{Orders: []Order{{Pet: "Ghost"}}})
+	assert.ErrorContains(t, err, `order for pet "Ghost"`)
+}
+
+func TestLoad_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"tags": ["big"], "pets": [{"name": "Rex", "photoUrls": ["a.jpg"]}]}`), 0o600))
+
+	fixture, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big"}, fixture.Tags)
+	assert.Equal(t, []string{"a.jpg"}, fixture.Pets[0].PhotoUrls)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestRandom(t *testing.T) {
+	services := newServices(t)
+	seeder := NewSeeder(services)
+	ctx := context.Background()
+
+	fixture := Random(30, rand.New(rand.NewSource(1)))
+	require.Len(t, fixture.Pets, 30)
+
+	report, err := seeder.Apply(ctx, fixture)
+	require.NoError(t, err)
+	assert.Equal(t, 30, report.Pets.Created)
+
+	// имена зависят только от номера, поэтому другой генератор даёт тех же питомцев
+	report, err = seeder.Apply(ctx, Random(30, rand.New(rand.NewSource(2))))
+	require.NoError(t, err)
+	assert.Equal(t, Count{Skipped: 30}, report.Pets)
+}
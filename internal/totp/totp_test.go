@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret - ключ "12345678901234567890" из приложения B RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP_RFC6238Vectors(t *testing.T) {
+	key, err := decode(rfcSecret)
+	require.NoError(t, err)
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+		assert.Equal(t, tt.code, hotp(key, uint64(step), 8), "t=%d", tt.unix)
+	}
+}
+
+func TestCode(t *testing.T) {
+	code, err := Code(rfcSecret, time.Unix(59, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	_, err = Code("not base32!", time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	previous, err := Code(secret, now.Add(-Period))
+	require.NoError(t, err)
+
+	step, ok := Validate(secret, previous, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now)-1, step)
+
+	_, ok = Validate(secret, previous, now, 0)
+	assert.False(t, ok, "Без допуска код предыдущего шага не принимается")
+
+	_, ok = Validate(secret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Petstore", "alice", "SECRET"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Petstore:alice", uri.Path)
+	assert.Equal(t, "SECRET", uri.Query().Get("secret"))
+	assert.Equal(t, "Petstore", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+}
@@ -0,0 +1,581 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-chi/jwtauth"
+	"go.uber.org/zap"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/db"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
+)
+
+const adminUsage = `usage: admin [config flags] <command> [flags]
+
+commands:
+  users create -username U -password P [-email E] [-role R]
+  users passwd -username U -password P
+  users role -username U -role R
+  users list [-role R] [-deleted]
+  users restore -username U
+  users reset-2fa -username U
+  pets status -to S [-from S] [ID...]
+  orders cancel [-comment C] ID...
+
+every command accepts -output table|json`
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var errAdminUsage = errors.New(adminUsage)
+
+// adminPageLimit - размер страницы при выборке питомцев для массовой смены статуса
+const adminPageLimit = 100
+
+// RunAdmin разбирает конфигурацию из args, подключается к базе и выполняет команду админки
+func RunAdmin(args []string, out io.Writer) error {
+	cfg, args, err := config.LoadArgs(args)
+	if err != nil {
+		return err
+	}
+
+	// Схему меняет только migrate или сервер, админка работает с тем, что есть
+	services, err := openServices(cfg, config.MigrationsCheck)
+	if err != nil {
+		return err
+	}
+
+	return Admin(context.Background(), services, args, out)
+}
+
+// openServices подключается к базе из cfg и собирает сервисы приложения для команд командной строки
+func openServices(cfg config.Config, migrations string) (*modules.Services, error) {
+	// Изменения в памяти исчезли бы вместе с процессом
+	if cfg.DB.Driver == config.DriverMemory {
+		return nil, fmt.Errorf("commands need a database, the %s driver keeps nothing", config.DriverMemory)
+	}
+
+	dbRaw, err := db.NewDB(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	err = prepareSchema(dbRaw, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	storages, err := modules.NewStorages(cfg.DB.Driver, dbRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := password.NewChecker(cfg.Auth.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer, err := mail.New(cfg.Mail, zap.NewNop())
+	if err != nil {
+		return nil, err
+	}
+
+	tokenAuth := jwtauth.New("HS256", []byte(cfg.Auth.JWTSecret), nil)
+
+	return modules.NewServices(*storages, tokenAuth, blob.NewLocalStore(cfg.Storage.UploadDir), passwords, mailer, audit.NewLogRecorder(zap.NewNop()), cfg), nil
+}
+
+// Admin выполняет команду админки над сервисами приложения
+func Admin(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errAdminUsage
+	}
+
+	command := args[0] + " " + args[1]
+	args = args[2:]
+
+	switch command {
+	case "users create":
+		return adminCreateUser(ctx, services, args, out)
+	case "users passwd":
+		return adminSetPassword(ctx, services, args, out)
+	case "users role":
+		return adminSetRole(ctx, services, args, out)
+	case "users list":
+		return adminListUsers(ctx, services, args, out)
+	case "users restore":
+		return adminRestoreUser(ctx, services, args, out)
+	case "users reset-2fa":
+		return adminResetTwoFactor(ctx, services, args, out)
+	case "pets status":
+		return adminPetStatus(ctx, services, args, out)
+	case "orders cancel":
+		return adminCancelOrders(ctx, services, args, out)
+	}
+
+	return errAdminUsage
+}
+
+// adminFlags создаёт набор флагов команды с общим флагом -output
+func adminFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	output := fs.String("output", outputTable, "output format: table or json")
+	return fs, output
+}
+
+// parseAdminFlags разбирает флаги и проверяет формат вывода
+func parseAdminFlags(fs *flag.FlagSet, output *string, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Name(), err)
+	}
+
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("%s: invalid output format: %s", fs.Name(), *output)
+	}
+
+	return nil
+}
+
+func requireFlag(fs *flag.FlagSet, name string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s: -%s is required", fs.Name(), name)
+	}
+	return nil
+}
+
+func adminCreateUser(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("users create")
+	username := fs.String("username", "", "username")
+	password := fs.String("password", "", "password")
+	email := fs.String("email", "", "email")
+	role := fs.String("role", models.RoleCustomer, "role")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	if err = requireFlag(fs, "username", *username); err != nil {
+		return err
+	}
+	if err = requireFlag(fs, "password", *password); err != nil {
+		return err
+	}
+
+	err = services.User.UserValidation(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	err = services.User.PasswordValidation(*password)
+	if err != nil {
+		return err
+	}
+
+	if *email != "" {
+		err = services.User.EmailValidation(*email)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = services.User.RoleValidation(*role)
+	if err != nil {
+		return err
+	}
+
+	hpass, err := services.User.PasswordEncryption(*password)
+	if err != nil {
+		return err
+	}
+
+	err = services.User.UserCreate(ctx, models.User{
+		Username: *username,
+		Email:    *email,
+		Password: hpass,
+		Role:     *role,
+		// адрес задаёт администратор, письмо с подтверждением не нужно
+		EmailVerified: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printAdminUser(ctx, services, *username, *output, out)
+}
+
+func adminSetPassword(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("users passwd")
+	username := fs.String("username", "", "username")
+	password := fs.String("password", "", "new password")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	if err = requireFlag(fs, "username", *username); err != nil {
+		return err
+	}
+	if err = requireFlag(fs, "password", *password); err != nil {
+		return err
+	}
+
+	err = services.User.PasswordValidation(*password)
+	if err != nil {
+		return err
+	}
+
+	user, err := services.User.UserExistenceCheck(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	hpass, err := services.User.PasswordEncryption(*password)
+	if err != nil {
+		return err
+	}
+
+	err = services.User.UpdateUser(ctx, user, models.User{Password: hpass})
+	if err != nil {
+		return err
+	}
+
+	return printAdminUser(ctx, services, *username, *output, out)
+}
+
+// adminResetTwoFactor выключает второй фактор пользователю, потерявшему и телефон, и коды восстановления
+func adminResetTwoFactor(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("users reset-2fa")
+	username := fs.String("username", "", "username")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	if err = requireFlag(fs, "username", *username); err != nil {
+		return err
+	}
+
+	user, err := services.User.UserExistenceCheck(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	err = services.User.ResetTwoFactor(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return printAdminUser(ctx, services, *username, *output, out)
+}
+
+func adminSetRole(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("users role")
+	username := fs.String("username", "", "username")
+	role := fs.String("role", "", "new role")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	if err = requireFlag(fs, "username", *username); err != nil {
+		return err
+	}
+	if err = requireFlag(fs, "role", *role); err != nil {
+		return err
+	}
+
+	user, err := services.User.UserExistenceCheck(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	err = services.User.UpdateRole(ctx, user, *role)
+	if err != nil {
+		return err
+	}
+
+	return printAdminUser(ctx, services, *username, *output, out)
+}
+
+func adminListUsers(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("users list")
+	role := fs.String("role", "", "only users with this role")
+	deleted := fs.Bool("deleted", false, "list soft-deleted users instead of active ones")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	var users []models.UserRole
+	if *deleted {
+		if *role != "" {
+			return fmt.Errorf("%s: -role and -deleted cannot be combined", fs.Name())
+		}
+		users, err = services.User.DeletedUsers(ctx)
+	} else {
+		users, err = services.User.ListRoles(ctx, *role)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printUsers(users, *output, out)
+}
+
+func adminRestoreUser(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("users restore")
+	username := fs.String("username", "", "username")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	if err = requireFlag(fs, "username", *username); err != nil {
+		return err
+	}
+
+	_, err = services.User.RestoreUser(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	return printAdminUser(ctx, services, *username, *output, out)
+}
+
+// adminResult - итог обработки одного объекта в массовой команде
+type adminResult struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status,omitempty"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+const (
+	resultUpdated = "updated"
+	resultSkipped = "skipped"
+	resultFailed  = "failed"
+)
+
+// adminPetStatus переводит питомцев в статус -to. Без списка ID берутся все питомцы в статусе -from
+func adminPetStatus(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("pets status")
+	to := fs.String("to", "", "new status")
+	from := fs.String("from", "", "change only pets in this status")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	if err = requireFlag(fs, "to", *to); err != nil {
+		return err
+	}
+
+	err = services.Pet.StatusCheck(*to)
+	if err != nil {
+		return err
+	}
+
+	if *from != "" {
+		err = services.Pet.StatusCheck(*from)
+		if err != nil {
+			return err
+		}
+	}
+
+	ids := fs.Args()
+	if len(ids) == 0 {
+		if *from == "" {
+			return fmt.Errorf("%s: pass pet IDs or -from", fs.Name())
+		}
+
+		ids, err = petIDsByStatus(ctx, services, *from)
+		if err != nil {
+			return err
+		}
+	}
+
+	results := make([]adminResult, 0, len(ids))
+	for _, id := range ids {
+		result := adminResult{Result: resultUpdated}
+		result.ID, _ = strconv.Atoi(id)
+
+		pet, err := services.Pet.GetPetByID(ctx, id)
+		if err != nil {
+			results = append(results, failedResult(result, err))
+			continue
+		}
+
+		result.Name = pet.Name
+		result.Status = pet.Status
+		if *from != "" && pet.Status != *from {
+			result.Result = resultSkipped
+			results = append(results, result)
+			continue
+		}
+
+		// UpdatePet меняет и имя, поэтому передаём текущее
+		err = services.Pet.UpdatePet(ctx, pet, models.PetIdForm{Name: pet.Name, Status: *to})
+		if err != nil {
+			results = append(results, failedResult(result, err))
+			continue
+		}
+
+		result.Status = *to
+		results = append(results, result)
+	}
+
+	return printResults(results, *output, out)
+}
+
+// petIDsByStatus собирает ID всех питомцев в статусе заранее, чтобы смена статуса не сбивала курсор
+func petIDsByStatus(ctx context.Context, services *modules.Services, status string) ([]string, error) {
+	var ids []string
+
+	query := models.StatusForm{
+		Statuses: []string{status},
+		PageForm: models.PageForm{Limit: adminPageLimit},
+	}
+	for {
+		page, err := services.Pet.FindByStatus(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pet := range page.Pets {
+			ids = append(ids, strconv.Itoa(pet.ID))
+		}
+
+		if page.NextCursor == "" {
+			return ids, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func adminCancelOrders(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs, output := adminFlags("orders cancel")
+	comment := fs.String("comment", "cancelled by admin", "comment saved in the order history")
+	err := parseAdminFlags(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	ids := fs.Args()
+	if len(ids) == 0 {
+		return fmt.Errorf("%s: pass order IDs", fs.Name())
+	}
+
+	results := make([]adminResult, 0, len(ids))
+	for _, id := range ids {
+		result := adminResult{Result: resultUpdated}
+		result.ID, _ = strconv.Atoi(id)
+
+		order, err := services.Store.GetByID(ctx, id)
+		if err != nil {
+			results = append(results, failedResult(result, err))
+			continue
+		}
+
+		result.Status = order.Status
+		order, err = services.Store.TransitionOrder(ctx, id, order.Version, models.OrderStatusForm{
+			Status:  "cancelled",
+			Comment: *comment,
+		})
+		if err != nil {
+			results = append(results, failedResult(result, err))
+			continue
+		}
+
+		result.Status = order.Status
+		results = append(results, result)
+	}
+
+	return printResults(results, *output, out)
+}
+
+func failedResult(result adminResult, err error) adminResult {
+	result.Result = resultFailed
+	result.Error = err.Error()
+	return result
+}
+
+func printAdminUser(ctx context.Context, services *modules.Services, username string, output string, out io.Writer) error {
+	user, err := services.User.UserExistenceCheck(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	return printUsers([]models.UserRole{{ID: user.ID, Username: user.Username, Role: user.Role}}, output, out)
+}
+
+func printUsers(users []models.UserRole, output string, out io.Writer) error {
+	if output == outputJSON {
+		return printJSON(users, out)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tROLE")
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", user.ID, user.Username, user.Role)
+	}
+
+	return w.Flush()
+}
+
+// printResults выводит итоги массовой команды и возвращает ошибку, если часть объектов не обработана
+func printResults(results []adminResult, output string, out io.Writer) error {
+	var err error
+	if output == outputJSON {
+		err = printJSON(results, out)
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tRESULT")
+		for _, result := range results {
+			outcome := result.Result
+			if result.Error != "" {
+				outcome += ": " + result.Error
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", result.ID, result.Name, result.Status, outcome)
+		}
+		err = w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, result := range results {
+		if result.Result == resultFailed {
+			failed = append(failed, strconv.Itoa(result.ID))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func printJSON(v interface{}, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
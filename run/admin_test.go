@@ -0,0 +1,118 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/db"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/models"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
+)
+
+func newAdminServices(t *testing.T) *modules.Services {
+	cfg := config.Default()
+	cfg.DB.Driver = config.DriverSQLite
+	cfg.DB.Name = filepath.Join(t.TempDir(), "petstore.db")
+
+	dbRaw, err := db.NewDB(cfg.DB)
+	require.NoError(t, err)
+	require.NoError(t, db.MigrateDB(dbRaw))
+
+	storages, err := modules.NewStorages(cfg.DB.Driver, dbRaw)
+	require.NoError(t, err)
+
+	passwords, err := password.NewChecker(cfg.Auth.Password)
+	require.NoError(t, err)
+
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	return modules.NewServices(*storages, tokenAuth, blob.NewLocalStore(t.TempDir()), passwords, mail.NewLogMailer(zap.NewNop()), audit.NewLogRecorder(zap.NewNop()), cfg)
+}
+
+func TestAdmin_Users(t *testing.T) {
+	services := newAdminServices(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	require.NoError(t, Admin(ctx, services, []string{"users", "create", "-username", "alice", "-password", "kettle-secret", "-role", "staff"}, &out))
+	assert.Regexp(t, `1\s+alice\s+staff`, out.String())
+
+	user, err := services.User.UserExistenceCheck(ctx, "alice")
+	require.NoError(t, err)
+	assert.NoError(t, services.User.PasswordCheck(ctx, models.LoginForm{Username: "alice", Password: "kettle-secret"}, user))
+
+	require.NoError(t, Admin(ctx, services, []string{"users", "passwd", "-username", "alice", "-password", "kettle-changed"}, &out))
+	user, err = services.User.UserExistenceCheck(ctx, "alice")
+	require.NoError(t, err)
+	assert.NoError(t, services.User.PasswordCheck(ctx, models.LoginForm{Username: "alice", Password: "kettle-changed"}, user))
+	// администратор создаёт пользователей с подтверждённым адресом, смена пароля его не сбрасывает
+	assert.NoError(t, services.User.EmailVerifiedCheck(user))
+
+	_, err = services.User.EnrollTOTP(ctx, user)
+	require.NoError(t, err)
+	require.NoError(t, Admin(ctx, services, []string{"users", "reset-2fa", "-username", "alice"}, &out))
+	_, err = services.User.ConfirmTOTP(ctx, user, "000000")
+	assert.Error(t, err, "После сброса привязку нужно начинать заново")
+
+	require.NoError(t, Admin(ctx, services, []string{"users", "role", "-username", "alice", "-role", "admin"}, &out))
+	require.NoError(t, services.User.DeleteUser(ctx, models.User{ID: user.ID, Version: user.Version + 1}))
+
+	out.Reset()
+	require.NoError(t, Admin(ctx, services, []string{"users", "list", "-deleted", "-output", "json"}, &out))
+	var deleted []models.UserRole
+	require.NoError(t, json.Unmarshal(out.Bytes(), &deleted))
+	assert.Equal(t, []models.UserRole{{ID: 1, Username: "alice", Role: "admin"}}, deleted)
+
+	require.NoError(t, Admin(ctx, services, []string{"users", "restore", "-username", "alice"}, &out))
+	_, err = services.User.UserExistenceCheck(ctx, "alice")
+	assert.NoError(t, err)
+
+	assert.Error(t, Admin(ctx, services, []string{"users", "restore", "-username", "alice"}, &out), "Активного пользователя восстанавливать нечего")
+	assert.Error(t, Admin(ctx, services, []string{"users", "create", "-username", "alice", "-password", "kettle-secret"}, &out))
+	assert.Error(t, Admin(ctx, services, []string{"users", "list", "-output", "yaml"}, &out))
+	assert.Error(t, Admin(ctx, services, []string{"users"}, &out))
+}
+
+func TestAdmin_PetsAndOrders(t *testing.T) {
+	services := newAdminServices(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	for _, name := range []string{"Rex", "Tom", "Max"} {
+		require.NoError(t, services.Pet.CreatePet(ctx, models.Pet{Name: name, Status: "available", Category: models.Category{ID: 1, Name: "dogs"}}))
+	}
+	require.NoError(t, services.Store.CreateOrder(ctx, models.Order{PetID: 1, Status: "placed"}, ""))
+
+	require.NoError(t, Admin(ctx, services, []string{"pets", "status", "-from", "available", "-to", "sold"}, &out))
+	assert.Regexp(t, `2\s+Tom\s+sold\s+updated`, out.String())
+
+	pet, err := services.Pet.GetPetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "pending", pet.Status, "Зарезервированного питомца фильтр -from пропускает")
+
+	out.Reset()
+	require.NoError(t, Admin(ctx, services, []string{"orders", "cancel", "-output", "json", "1"}, &out))
+	var results []adminResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Equal(t, []adminResult{{ID: 1, Status: "cancelled", Result: resultUpdated}}, results)
+
+	pet, err = services.Pet.GetPetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "available", pet.Status, "Отмена заказа должна снять резерв")
+
+	out.Reset()
+	err = Admin(ctx, services, []string{"orders", "cancel", "1", "7"}, &out)
+	assert.EqualError(t, err, "2 of 2 failed: 1, 7")
+	assert.Contains(t, out.String(), "illegal order status transition")
+}
@@ -2,6 +2,7 @@ package run
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,8 +12,14 @@ import (
 
 	"github.com/go-chi/jwtauth"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/audit"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/blob"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/db"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/mail"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/password"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/responder"
 	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/router"
 )
@@ -32,9 +39,14 @@ type Bootstraper interface {
 }
 
 type App struct {
-	srv Server
+	srv             Server
+	services        *modules.Services
+	shutdownTimeout time.Duration
 }
 
+// defaultShutdownTimeout используется, если приложение запущено без Bootstrap
+const defaultShutdownTimeout = 5 * time.Second
+
 func NewApp() *App {
 	return &App{}
 }
@@ -49,7 +61,11 @@ func (a *App) Run() {
 		log.Println("Shutdown signal received...")
 
 		// Таймаут для завершения сервера
-		shutdownCtx, cancel := context.WithTimeout(serverCtx, 5*time.Second)
+		shutdownTimeout := a.shutdownTimeout
+		if shutdownTimeout <= 0 {
+			shutdownTimeout = defaultShutdownTimeout
+		}
+		shutdownCtx, cancel := context.WithTimeout(serverCtx, shutdownTimeout)
 		defer cancel()
 
 		// Завершение работы сервера
@@ -59,6 +75,13 @@ func (a *App) Run() {
 			log.Println("Server stopped gracefully")
 		}
 
+		// Останавливаем фоновые задачи после того, как сервер перестал принимать запросы
+		if a.services != nil {
+			if err := a.services.Close(shutdownCtx); err != nil {
+				log.Printf("Background workers stop failed: %v", err)
+			}
+		}
+
 		// Завершаем основной контекст сервера
 		serverStopCtx()
 	}()
@@ -76,40 +99,98 @@ func (a *App) Run() {
 }
 
 func (a *App) Bootstrap() Runner {
-	var tokenAuth *jwtauth.JWTAuth
-	const Secret = "rixha9-kabtuJ-xizpej"
-	tokenAuth = jwtauth.New("HS256", []byte(Secret), nil)
+	cfg, args, err := config.LoadArgs(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Подкоманды выполняются вместо запуска сервера: ./main [flags] migrate up
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(cfg, args[1:], os.Stdout)
+		case "seed":
+			err = runSeed(cfg, args[1:], os.Stdout)
+		default:
+			log.Fatalf("unknown command: %s", args[0])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	tokenAuth := jwtauth.New("HS256", []byte(cfg.Auth.JWTSecret), nil)
 
 	logger, _ := zap.NewProduction()
 
 	responder := responder.NewResponder(logger)
 
-	dbConf := db.NewDbConf()
+	// In-memory хранилищу база не нужна
+	var dbRaw *gorm.DB
+	if cfg.DB.Driver != config.DriverMemory {
+		dbRaw, err = db.NewDB(cfg.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	dbRaw, err := db.NewDB(*dbConf)
+		err = prepareSchema(dbRaw, cfg.DB.Migrations)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	storages, err := modules.NewStorages(cfg.DB.Driver, dbRaw)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = db.MigrateDB(dbRaw)
+	blobs := blob.NewLocalStore(cfg.Storage.UploadDir)
+
+	passwords, err := password.NewChecker(cfg.Auth.Password)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	storages := modules.NewStorages(dbRaw)
+	mailer, err := mail.New(cfg.Mail, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	services := modules.NewServices(*storages, tokenAuth)
+	services := modules.NewServices(*storages, tokenAuth, blobs, passwords, mailer, audit.NewLogRecorder(logger), cfg)
 
+	a.services = services
 	controllers := modules.NewControllers(services, responder)
 
-	r := router.NewRouter(controllers, tokenAuth)
+	r := router.NewRouter(controllers, tokenAuth, services.User, services.User, cfg.Auth.LegacyLogin)
 
+	a.shutdownTimeout = cfg.Server.ShutdownTimeout.Std()
 	a.srv = &http.Server{
-		Addr:         ":8080",
+		Addr:         cfg.Server.Addr,
 		Handler:      r,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout.Std(),
+		WriteTimeout: cfg.Server.WriteTimeout.Std(),
 	}
 
 	return a
 }
+
+// prepareSchema применяет миграции в режиме auto, а в режиме check только проверяет,
+// что схема не отстаёт от бинарника
+func prepareSchema(dbRaw *gorm.DB, mode string) error {
+	if mode == config.MigrationsAuto {
+		return db.MigrateDB(dbRaw)
+	}
+
+	migrator, err := db.NewMigrator(dbRaw)
+	if err != nil {
+		return err
+	}
+
+	err = migrator.Check(context.Background())
+	if err != nil {
+		return fmt.Errorf("%w; run the migrate up command before starting the server", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/db"
+)
+
+const migrateUsage = "usage: migrate up|down|status|to N"
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// runMigrate подключается к базе из cfg и выполняет подкоманду migrate
+func runMigrate(cfg config.Config, args []string, out io.Writer) error {
+	if cfg.DB.Driver == config.DriverMemory {
+		return fmt.Errorf("migrations are not used by the %s driver", config.DriverMemory)
+	}
+
+	dbRaw, err := db.NewDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := db.NewMigrator(dbRaw)
+	if err != nil {
+		return err
+	}
+
+	return Migrate(context.Background(), migrator, args, out)
+}
+
+// Migrate выполняет подкоманду migrate: up, down, status или to N
+func Migrate(ctx context.Context, migrator *db.Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			return errMigrateUsage
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid migration version: %s", args[1])
+		}
+		err = migrator.To(ctx, version)
+	case "status":
+	default:
+		return errMigrateUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(ctx, migrator, out)
+}
+
+func printMigrationStatus(ctx context.Context, migrator *db.Migrator, out io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/db"
+)
+
+func TestMigrate(t *testing.T) {
+	conf := config.Default().DB
+	conf.Driver = config.DriverSQLite
+	conf.Name = filepath.Join(t.TempDir(), "petstore.db")
+
+	dbRaw, err := db.NewDB(conf)
+	require.NoError(t, err)
+
+	migrator, err := db.NewMigrator(dbRaw)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	require.NoError(t, Migrate(ctx, migrator, []string{"status"}, &out))
+	assert.Regexp(t, `0001\s+init\s+pending`, out.String())
+
+	out.Reset()
+	require.NoError(t, Migrate(ctx, migrator, []string{"up"}, &out))
+	assert.NotContains(t, out.String(), "pending")
+
+	out.Reset()
+	require.NoError(t, Migrate(ctx, migrator, []string{"to", "0"}, &out))
+	assert.Contains(t, out.String(), "pending")
+
+	for _, args := range [][]string{nil, {"sideways"}, {"to"}, {"to", "one"}} {
+		assert.Error(t, Migrate(ctx, migrator, args, &out), "args %v", args)
+	}
+}
+
+func TestPrepareSchema(t *testing.T) {
+	conf := config.Default().DB
+	conf.Driver = config.DriverSQLite
+	conf.Name = filepath.Join(t.TempDir(), "petstore.db")
+
+	dbRaw, err := db.NewDB(conf)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, prepareSchema(dbRaw, config.MigrationsCheck), db.ErrSchemaBehind)
+	require.NoError(t, prepareSchema(dbRaw, config.MigrationsAuto))
+	assert.NoError(t, prepareSchema(dbRaw, config.MigrationsCheck))
+}
@@ -0,0 +1,112 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"text/tabwriter"
+	"time"
+
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/config"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/modules"
+	"studentgit.kata.academy/ponomarenko.100299/go-petstore/internal/seed"
+)
+
+const seedUsage = "usage: seed [-random N] [-rand-seed S] [FILE...]"
+
+var errSeedUsage = errors.New(seedUsage)
+
+// runSeed подключается к базе из cfg и загружает в неё фикстуры
+func runSeed(cfg config.Config, args []string, out io.Writer) error {
+	services, err := openServices(cfg, cfg.DB.Migrations)
+	if err != nil {
+		return err
+	}
+
+	return Seed(context.Background(), services, args, out)
+}
+
+// Seed загружает фикстуры из файлов и, если задан -random, N случайных питомцев
+func Seed(ctx context.Context, services *modules.Services, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	random := fs.Int("random", 0, "number of random pets to generate")
+	randSeed := fs.Int64("rand-seed", 0, "seed for the random generator, the current time by default")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+
+	if *random < 0 || (*random == 0 && fs.NArg() == 0) {
+		return errSeedUsage
+	}
+
+	var fixtures []seed.Fixture
+	for _, path := range fs.Args() {
+		fixture, err := seed.Load(path)
+		if err != nil {
+			return err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	if *random > 0 {
+		if *randSeed == 0 {
+			*randSeed = time.Now().UnixNano()
+		}
+		fixtures = append(fixtures, seed.Random(*random, rand.New(rand.NewSource(*randSeed))))
+	}
+
+	seeder := seed.NewSeeder(services)
+
+	var total seed.Report
+	for _, fixture := range fixtures {
+		report, err := seeder.Apply(ctx, fixture)
+		total = addReports(total, report)
+		if err != nil {
+			printSeedReport(total, out)
+			return err
+		}
+	}
+
+	return printSeedReport(total, out)
+}
+
+func addReports(a seed.Report, b seed.Report) seed.Report {
+	add := func(x, y seed.Count) seed.Count {
+		return seed.Count{Created: x.Created + y.Created, Skipped: x.Skipped + y.Skipped}
+	}
+
+	return seed.Report{
+		Users:      add(a.Users, b.Users),
+		Categories: add(a.Categories, b.Categories),
+		Tags:       add(a.Tags, b.Tags),
+		Pets:       add(a.Pets, b.Pets),
+		Orders:     add(a.Orders, b.Orders),
+	}
+}
+
+func printSeedReport(report seed.Report, out io.Writer) error {
+	rows := []struct {
+		kind  string
+		count seed.Count
+	}{
+		{"users", report.Users},
+		{"categories", report.Categories},
+		{"tags", report.Tags},
+		{"pets", report.Pets},
+		{"orders", report.Orders},
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tCREATED\tSKIPPED")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", row.kind, row.count.Created, row.count.Skipped)
+	}
+
+	return w.Flush()
+}
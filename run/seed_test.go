@@ -0,0 +1,28 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	services := newAdminServices(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	require.NoError(t, Seed(ctx, services, []string{"-random", "5", "-rand-seed", "1", "../internal/seed/testdata/demo.yaml"}, &out))
+	assert.Regexp(t, `pets\s+7\s+0`, out.String())
+	assert.Regexp(t, `orders\s+1\s+0`, out.String())
+
+	out.Reset()
+	require.NoError(t, Seed(ctx, services, []string{"../internal/seed/testdata/demo.yaml"}, &out))
+	assert.Regexp(t, `users\s+0\s+2`, out.String())
+
+	for _, args := range [][]string{nil, {"-random", "-1"}, {"-bogus"}} {
+		assert.Error(t, Seed(ctx, services, args, &out), "args %v", args)
+	}
+}